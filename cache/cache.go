@@ -0,0 +1,285 @@
+// Package cache implements a read-through cache in front of a ddb.ClientInterface, for rows that are read far
+// more often than they are written.
+//
+// Get results, including ErrNotFound, are cached by PK and SK. Put, Update, Delete and TransactPuts made
+// through the cache invalidate the rows they write, so a process sees its own writes. Writes made by other
+// processes are seen once the entry expires. Concurrent misses for the same row share a single read. Rows read
+// into types with fields tagged `ddb:",encrypt"` are not cached, so their plaintext never reaches the Store.
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/danielwchapman/ddb"
+	"github.com/danielwchapman/ddb/internal/avjson"
+)
+
+// DefaultTTL is how long an entry is cached when Client.TTL is zero.
+const DefaultTTL = time.Minute
+
+// Entry is a cached Get result.
+type Entry struct {
+	// Type identifies the type the row was read into. A row cached for one type is read again for another,
+	// as a type can leave out attributes.
+	Type string
+
+	// Item is the row as DynamoDB JSON. It is empty when NotFound is set.
+	Item []byte
+
+	// NotFound records that the row did not exist.
+	NotFound bool
+}
+
+// Store holds cached entries. Implementations must be safe for concurrent use.
+type Store interface {
+	Get(key string) (Entry, bool)
+	Set(key string, entry Entry, ttl time.Duration)
+	Delete(key string)
+}
+
+// Client is a ClientInterface that caches the Gets of another. Gets into types with encrypted fields are passed
+// through without being cached, and so is GetWithOptions, as options can change what a Get returns.
+type Client struct {
+	Client ddb.ClientInterface
+
+	// Store holds the entries. If nil, an LRU of DefaultSize is used.
+	Store Store
+
+	// TTL is how long a row is cached. Zero uses DefaultTTL.
+	TTL time.Duration
+
+	// NotFoundTTL is how long a missing row is cached. Zero uses TTL and a negative value disables caching of
+	// ErrNotFound.
+	NotFoundTTL time.Duration
+
+	once     sync.Once
+	mu       sync.Mutex
+	inflight map[string]*call
+}
+
+var (
+	_ ddb.ClientInterface   = (*Client)(nil)
+	_ ddb.GetterWithOptions = (*Client)(nil)
+)
+
+// call is a Get that concurrent misses for the same row wait for.
+type call struct {
+	typ   string
+	done  chan struct{}
+	entry Entry
+	err   error
+
+	// stale is set, under Client.mu, when the row is written while it is being read.
+	stale bool
+}
+
+func (c *Client) init() {
+	c.once.Do(func() {
+		if c.Store == nil {
+			c.Store = NewLRU(DefaultSize)
+		}
+		if c.TTL == 0 {
+			c.TTL = DefaultTTL
+		}
+		if c.NotFoundTTL == 0 {
+			c.NotFoundTTL = c.TTL
+		}
+		c.inflight = map[string]*call{}
+	})
+}
+
+// Invalidate removes the row pk, sk from the cache, e.g. after it was written by another client.
+func (c *Client) Invalidate(pk, sk string) {
+	c.init()
+
+	key := cacheKey(pk, sk)
+	c.mu.Lock()
+	if inflight, ok := c.inflight[key]; ok {
+		inflight.stale = true
+		delete(c.inflight, key)
+	}
+	c.mu.Unlock()
+
+	c.Store.Delete(key)
+}
+
+func (c *Client) Get(ctx context.Context, pk, sk string, out any) error {
+	c.init()
+
+	if len(ddb.EncryptedAttributes(out)) > 0 {
+		return c.Client.Get(ctx, pk, sk, out)
+	}
+
+	key, typ := cacheKey(pk, sk), typeName(out)
+	if entry, ok := c.Store.Get(key); ok && entry.Type == typ {
+		return decode(entry, out)
+	}
+
+	c.mu.Lock()
+	if inflight, ok := c.inflight[key]; ok && inflight.typ == typ {
+		c.mu.Unlock()
+		select {
+		case <-inflight.done:
+		case <-ctx.Done():
+			return fmt.Errorf("Get: %w", ctx.Err())
+		}
+		if inflight.err != nil {
+			return inflight.err
+		}
+		return decode(inflight.entry, out)
+	}
+	leader := &call{typ: typ, done: make(chan struct{})}
+	c.inflight[key] = leader
+	c.mu.Unlock()
+
+	leader.entry, leader.err = c.load(ctx, pk, sk, typ, out)
+
+	c.mu.Lock()
+	if c.inflight[key] == leader {
+		delete(c.inflight, key)
+	}
+	// a write since the read started may have made the entry stale
+	fresh := !leader.stale
+	c.mu.Unlock()
+	close(leader.done)
+
+	if leader.err != nil {
+		return leader.err
+	}
+	if fresh {
+		switch {
+		case !leader.entry.NotFound:
+			c.Store.Set(key, leader.entry, c.TTL)
+		case c.NotFoundTTL > 0:
+			c.Store.Set(key, leader.entry, c.NotFoundTTL)
+		}
+	}
+	if leader.entry.NotFound {
+		return ddb.ErrNotFound
+	}
+	return nil
+}
+
+// GetWithOptions reads the row from the wrapped Client without caching it. Without options it is Get. The wrapped
+// Client must be a ddb.GetterWithOptions.
+func (c *Client) GetWithOptions(ctx context.Context, pk, sk string, out any, opts ...ddb.Option) error {
+	if len(opts) == 0 {
+		return c.Get(ctx, pk, sk, out)
+	}
+
+	getter, ok := c.Client.(ddb.GetterWithOptions)
+	if !ok {
+		return fmt.Errorf("GetWithOptions: %T does not take options", c.Client)
+	}
+	return getter.GetWithOptions(ctx, pk, sk, out, opts...)
+}
+
+// load reads a row into out and returns it as an Entry.
+func (c *Client) load(ctx context.Context, pk, sk, typ string, out any) (Entry, error) {
+	err := c.Client.Get(ctx, pk, sk, out)
+	if errors.Is(err, ddb.ErrNotFound) {
+		return Entry{Type: typ, NotFound: true}, nil
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+
+	item, err := attributevalue.MarshalMap(out)
+	if err != nil {
+		return Entry{}, fmt.Errorf("Get: MarshalMap: %w", err)
+	}
+	data, err := avjson.MarshalItem(item)
+	if err != nil {
+		return Entry{}, fmt.Errorf("Get: %w", err)
+	}
+	return Entry{Type: typ, Item: data}, nil
+}
+
+func decode(entry Entry, out any) error {
+	if entry.NotFound {
+		return ddb.ErrNotFound
+	}
+	item, err := avjson.UnmarshalItem(entry.Item)
+	if err != nil {
+		return fmt.Errorf("Get: %w", err)
+	}
+	if err := attributevalue.UnmarshalMap(item, out); err != nil {
+		return fmt.Errorf("Get: UnmarshalMap: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) Delete(ctx context.Context, pk, sk string, opts ...ddb.Option) error {
+	c.init()
+	defer c.Invalidate(pk, sk)
+	return c.Client.Delete(ctx, pk, sk, opts...)
+}
+
+func (c *Client) Put(ctx context.Context, row any, opts ...ddb.Option) error {
+	c.init()
+	if pk, sk, ok := rowKey(row); ok {
+		defer c.Invalidate(pk, sk)
+	}
+	return c.Client.Put(ctx, row, opts...)
+}
+
+func (c *Client) Query(ctx context.Context, keyCond ddb.KeyCondition, out any, opts ...ddb.Option) error {
+	return c.Client.Query(ctx, keyCond, out, opts...)
+}
+
+func (c *Client) TransactPuts(ctx context.Context, token string, rows ...ddb.PutRow) error {
+	c.init()
+	for _, row := range rows {
+		if pk, sk, ok := rowKey(row.Row); ok {
+			defer c.Invalidate(pk, sk)
+		}
+	}
+	return c.Client.TransactPuts(ctx, token, rows...)
+}
+
+func (c *Client) Update(ctx context.Context, pk, sk string, opts ...ddb.Option) error {
+	c.init()
+	defer c.Invalidate(pk, sk)
+	return c.Client.Update(ctx, pk, sk, opts...)
+}
+
+func cacheKey(pk, sk string) string {
+	return strconv.Itoa(len(pk)) + ":" + pk + sk
+}
+
+func typeName(out any) string {
+	t := reflect.TypeOf(out)
+	if t == nil {
+		return ""
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.PkgPath() + "." + t.String()
+}
+
+// rowKey returns the PK and SK of a row to write.
+func rowKey(row any) (pk, sk string, ok bool) {
+	item, err := attributevalue.MarshalMap(row)
+	if err != nil {
+		return "", "", false
+	}
+	pkValue, ok := item["PK"].(*types.AttributeValueMemberS)
+	if !ok {
+		return "", "", false
+	}
+	skValue, ok := item["SK"].(*types.AttributeValueMemberS)
+	if !ok {
+		return "", "", false
+	}
+	return pkValue.Value, skValue.Value, true
+}
@@ -0,0 +1,302 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+
+	"github.com/danielwchapman/ddb"
+	"github.com/danielwchapman/ddb/ddblocal"
+)
+
+type configRow struct {
+	ddb.RowHeader
+	Value string
+}
+
+// countingClient counts Gets and can hold them until release is closed.
+type countingClient struct {
+	ddb.ClientInterface
+	gets    atomic.Int32
+	release chan struct{}
+}
+
+func (c *countingClient) Get(ctx context.Context, pk, sk string, out any) error {
+	return c.GetWithOptions(ctx, pk, sk, out)
+}
+
+func (c *countingClient) GetWithOptions(ctx context.Context, pk, sk string, out any, opts ...ddb.Option) error {
+	c.gets.Add(1)
+	if c.release != nil {
+		<-c.release
+	}
+	return c.ClientInterface.(ddb.GetterWithOptions).GetWithOptions(ctx, pk, sk, out, opts...)
+}
+
+func newTestClient(t *testing.T) *countingClient {
+	t.Helper()
+
+	server := ddblocal.NewServer()
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	client := &ddb.Client{Ddb: server.DynamoDB(), Table: "Config"}
+	if err := client.CreateTable(ctx, ddb.TableSpec{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	row := configRow{RowHeader: ddb.RowHeader{PK: "CONFIG", SK: "flags", RowType: "CONFIG"}, Value: "v1"}
+	if err := client.Put(ctx, row); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return &countingClient{ClientInterface: client}
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	inner := newTestClient(t)
+	client := &Client{Client: inner}
+	ctx := context.Background()
+
+	get := func(t *testing.T, want string) {
+		t.Helper()
+		var got configRow
+		if err := client.Get(ctx, "CONFIG", "flags", &got); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.Value != want {
+			t.Errorf("expected %q, got: %+v", want, got)
+		}
+	}
+
+	get(t, "v1")
+	get(t, "v1")
+	if n := inner.gets.Load(); n != 1 {
+		t.Errorf("expected 1 read, got: %d", n)
+	}
+
+	if err := client.Put(ctx, configRow{RowHeader: ddb.RowHeader{PK: "CONFIG", SK: "flags", RowType: "CONFIG"}, Value: "v2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	get(t, "v2")
+
+	if err := client.Update(ctx, "CONFIG", "flags", ddb.WithFieldUpdates(map[string]any{"Value": "v3"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	get(t, "v3")
+
+	row := configRow{RowHeader: ddb.RowHeader{PK: "CONFIG", SK: "flags", RowType: "CONFIG"}, Value: "v4"}
+	if err := client.TransactPuts(ctx, "token", ddb.PutRow{Row: row}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	get(t, "v4")
+
+	// a failed write still invalidates
+	err := client.Update(ctx, "CONFIG", "flags",
+		ddb.WithFieldUpdates(map[string]any{"Value": "v5"}),
+		ddb.WithCondition(expression.Name("Value").Equal(expression.Value("other"))),
+	)
+	if err == nil {
+		t.Errorf("expected an error")
+	}
+	get(t, "v4")
+
+	if n := inner.gets.Load(); n != 5 {
+		t.Errorf("expected 5 reads, got: %d", n)
+	}
+
+	if err := client.Delete(ctx, "CONFIG", "flags"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		var got configRow
+		if err := client.Get(ctx, "CONFIG", "flags", &got); !errors.Is(err, ddb.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got: %v", err)
+		}
+	}
+	if n := inner.gets.Load(); n != 6 {
+		t.Errorf("expected ErrNotFound to be cached, got %d reads", n)
+	}
+}
+
+func TestClientOptionsBypass(t *testing.T) {
+	t.Parallel()
+
+	inner := newTestClient(t)
+	client := &Client{Client: inner}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		var got configRow
+		if err := client.GetWithOptions(ctx, "CONFIG", "flags", &got, ddb.WithConsistentRead()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if n := inner.gets.Load(); n != 2 {
+		t.Errorf("expected 2 reads, got: %d", n)
+	}
+}
+
+func TestClientNotFoundTTL(t *testing.T) {
+	t.Parallel()
+
+	inner := newTestClient(t)
+	client := &Client{Client: inner, NotFoundTTL: -1}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		var got configRow
+		if err := client.Get(ctx, "CONFIG", "missing", &got); !errors.Is(err, ddb.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got: %v", err)
+		}
+	}
+	if n := inner.gets.Load(); n != 2 {
+		t.Errorf("expected 2 reads, got: %d", n)
+	}
+}
+
+func TestClientSingleflight(t *testing.T) {
+	t.Parallel()
+
+	inner := newTestClient(t)
+	inner.release = make(chan struct{})
+	client := &Client{Client: inner}
+	ctx := context.Background()
+
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var got configRow
+			if err := client.Get(ctx, "CONFIG", "flags", &got); err != nil {
+				errs <- err
+			} else if got.Value != "v1" {
+				errs <- errors.New("unexpected value " + got.Value)
+			}
+		}()
+	}
+
+	// wait for the first read to start, then give the other callers time to join it
+	for inner.gets.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if n := inner.gets.Load(); n != 1 {
+		t.Errorf("expected 1 read, got: %d", n)
+	}
+}
+
+type secretRow struct {
+	ddb.RowHeader
+	Value string `ddb:",encrypt"`
+}
+
+func TestClientEncryptedFields(t *testing.T) {
+	t.Parallel()
+
+	inner := newTestClient(t)
+	keys := &ddb.StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+	inner.ClientInterface.(*ddb.Client).Encryption = &ddb.Encryption{Keys: keys}
+	store := NewLRU(DefaultSize)
+	client := &Client{Client: inner, Store: store}
+	ctx := context.Background()
+
+	row := secretRow{RowHeader: ddb.RowHeader{PK: "CONFIG", SK: "secret", RowType: "SECRET"}, Value: "hunter2"}
+	if err := client.Put(ctx, row); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		var got secretRow
+		if err := client.Get(ctx, "CONFIG", "secret", &got); err != nil || got.Value != "hunter2" {
+			t.Fatalf("unexpected row: %+v, %v", got, err)
+		}
+	}
+	if n := inner.gets.Load(); n != 2 {
+		t.Errorf("expected 2 reads, got: %d", n)
+	}
+	if _, ok := store.Get(cacheKey("CONFIG", "secret")); ok {
+		t.Errorf("expected the row not to be cached")
+	}
+}
+
+func TestClientInvalidateOtherRow(t *testing.T) {
+	t.Parallel()
+
+	inner := newTestClient(t)
+	inner.release = make(chan struct{})
+	client := &Client{Client: inner}
+	ctx := context.Background()
+
+	done := make(chan error)
+	go func() {
+		var got configRow
+		done <- client.Get(ctx, "CONFIG", "flags", &got)
+	}()
+	for inner.gets.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// a write to another row does not keep this one from being cached
+	client.Invalidate("CONFIG", "other")
+	close(inner.release)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got configRow
+	if err := client.Get(ctx, "CONFIG", "flags", &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := inner.gets.Load(); n != 1 {
+		t.Errorf("expected 1 read, got: %d", n)
+	}
+}
+
+func TestLRU(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	lru := NewLRU(2)
+	lru.now = func() time.Time { return now }
+
+	lru.Set("a", Entry{Type: "a"}, time.Minute)
+	lru.Set("b", Entry{Type: "b"}, time.Minute)
+	if _, ok := lru.Get("a"); !ok {
+		t.Errorf("expected a to be cached")
+	}
+
+	// b is the least recently used
+	lru.Set("c", Entry{Type: "c"}, time.Minute)
+	if _, ok := lru.Get("b"); ok {
+		t.Errorf("expected b to be evicted")
+	}
+	if lru.Len() != 2 {
+		t.Errorf("expected 2 entries, got: %d", lru.Len())
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := lru.Get("a"); ok {
+		t.Errorf("expected a to expire")
+	}
+
+	lru.Delete("c")
+	if lru.Len() != 0 {
+		t.Errorf("expected no entries, got: %d", lru.Len())
+	}
+}
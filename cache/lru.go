@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DefaultSize is the number of entries an LRU holds when its size is zero.
+const DefaultSize = 10_000
+
+// LRU is an in-process Store that evicts the least recently used entry when it is full. Expired entries are
+// removed when they are next read.
+type LRU struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+type lruEntry struct {
+	key       string
+	entry     Entry
+	expiresAt time.Time
+}
+
+var _ Store = (*LRU)(nil)
+
+// NewLRU returns an LRU holding up to size entries. Zero uses DefaultSize.
+func NewLRU(size int) *LRU {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &LRU{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+		now:     time.Now,
+	}
+}
+
+func (l *LRU) Get(key string) (Entry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	elem, ok := l.entries[key]
+	if !ok {
+		return Entry{}, false
+	}
+	e := elem.Value.(*lruEntry)
+	if !l.now().Before(e.expiresAt) {
+		l.remove(elem)
+		return Entry{}, false
+	}
+	l.order.MoveToFront(elem)
+	return e.entry, true
+}
+
+func (l *LRU) Set(key string, entry Entry, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	expiresAt := l.now().Add(ttl)
+	if elem, ok := l.entries[key]; ok {
+		elem.Value = &lruEntry{key: key, entry: entry, expiresAt: expiresAt}
+		l.order.MoveToFront(elem)
+		return
+	}
+
+	l.entries[key] = l.order.PushFront(&lruEntry{key: key, entry: entry, expiresAt: expiresAt})
+	for l.order.Len() > l.size {
+		l.remove(l.order.Back())
+	}
+}
+
+func (l *LRU) Delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if elem, ok := l.entries[key]; ok {
+		l.remove(elem)
+	}
+}
+
+// Len returns the number of entries, including expired entries that have not been removed yet.
+func (l *LRU) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
+
+// remove must be called with l.mu held.
+func (l *LRU) remove(elem *list.Element) {
+	l.order.Remove(elem)
+	delete(l.entries, elem.Value.(*lruEntry).key)
+}
@@ -5,6 +5,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
@@ -32,15 +35,54 @@ const (
 	gsi4sk = "GSI4SK"
 	gsi5pk = "GSI5PK"
 	gsi5sk = "GSI5SK"
+
+	indexNameLSI1 = "LSI1"
+	indexNameLSI2 = "LSI2"
+	indexNameLSI3 = "LSI3"
+	indexNameLSI4 = "LSI4"
+	indexNameLSI5 = "LSI5"
+
+	lsi1sk = "LSI1SK"
+	lsi2sk = "LSI2SK"
+	lsi3sk = "LSI3SK"
+	lsi4sk = "LSI4SK"
+	lsi5sk = "LSI5SK"
 )
 
 // Client provides convenience methods for working with a DynamoDB table following Single Table Design.
 type Client struct {
 	Ddb   *dynamodb.Client
 	Table string
+
+	// FilterExpired makes Get and Query treat rows whose ExpiresAt is in the past as missing, because Time to
+	// Live deletes expired rows lazily. It can be overridden per call with WithFilterExpired.
+	FilterExpired bool
+
+	// SoftDelete, if set, makes Delete and TransactDeletes mark rows as deleted instead of removing them.
+	SoftDelete *SoftDelete
+
+	// PageTokenKeys, if set, seals the page tokens Query returns so they cannot be read, edited or used with
+	// a different query. Plain tokens are rejected.
+	PageTokenKeys *PageTokenKeys
+
+	// Encryption, if set, encrypts fields tagged `ddb:",encrypt"` and optionally signs rows.
+	Encryption *Encryption
+
+	// Compression, if set, configures how fields tagged `ddb:",compress"` are compressed and offloaded.
+	Compression *Compression
+
+	// Upcasters, if set, upgrade rows written with an older shape when Get and Query read them.
+	Upcasters *Upcasters
+
+	// RateLimiter, if set, paces reads and writes to stay under a target capacity. It can be overridden per
+	// call with WithRateLimiter.
+	RateLimiter *RateLimiter
 }
 
-var _ ClientInterface = (*Client)(nil)
+var (
+	_ ClientInterface   = (*Client)(nil)
+	_ GetterWithOptions = (*Client)(nil)
+)
 
 func (c *Client) Delete(ctx context.Context, pk, sk string, opts ...Option) error {
 	var deleteOptions options
@@ -53,6 +95,10 @@ func (c *Client) Delete(ctx context.Context, pk, sk string, opts ...Option) erro
 
 	// TODO throw error if unsupported options are provided
 
+	if c.SoftDelete != nil && !deleteOptions.hardDelete {
+		return c.softDelete(ctx, pk, sk, &deleteOptions)
+	}
+
 	var (
 		expressionAttributeValues map[string]types.AttributeValue
 		expressionAttributeNames  map[string]string
@@ -68,6 +114,10 @@ func (c *Client) Delete(ctx context.Context, pk, sk string, opts ...Option) erro
 			return fmt.Errorf("Put: expression builder: %w", err)
 		}
 
+		if _, err := deleteOptions.scopeExpression(expr, expr.Condition()); err != nil {
+			return fmt.Errorf("Delete: %w", err)
+		}
+
 		expressionAttributeValues = expr.Values()
 		expressionAttributeNames = expr.Names()
 		condition = expr.Condition()
@@ -82,7 +132,7 @@ func (c *Client) Delete(ctx context.Context, pk, sk string, opts ...Option) erro
 		ConditionExpression:       condition,
 		ExpressionAttributeNames:  expressionAttributeNames,
 		ExpressionAttributeValues: expressionAttributeValues,
-	})
+	}, c.rateLimit(ctx)...)
 
 	if err != nil {
 		// TODO check for conditional errors
@@ -93,32 +143,91 @@ func (c *Client) Delete(ctx context.Context, pk, sk string, opts ...Option) erro
 }
 
 func (c *Client) Get(ctx context.Context, pk, sk string, out any) error {
+	return c.GetWithOptions(ctx, pk, sk, out)
+}
+
+// GetWithOptions is Get with options.
+func (c *Client) GetWithOptions(ctx context.Context, pk, sk string, out any, opts ...Option) error {
 	// TODO validate out is a pointer
 
+	var getOptions options
+	for _, opt := range opts {
+		if err := opt(&getOptions); err != nil {
+			return fmt.Errorf("Get: %w", err)
+		}
+	}
+
 	req := dynamodb.GetItemInput{
 		TableName: &c.Table,
 		Key: map[string]types.AttributeValue{
 			defaultPK: &types.AttributeValueMemberS{Value: pk},
 			defaultSK: &types.AttributeValueMemberS{Value: sk},
 		},
+		ConsistentRead: getOptions.consistentRead(),
 	}
 
-	resp, err := c.Ddb.GetItem(ctx, &req)
+	resp, err := c.Ddb.GetItem(ctx, &req, c.rateLimit(ctx)...)
 	if err != nil {
 		return fmt.Errorf("Get: GetItem: %w", err)
 	}
 
-	if len(resp.Item) == 0 {
+	return c.readItem(ctx, resp.Item, out, &getOptions)
+}
+
+// readItem unmarshals an item read by Get or Loader.Get into out. A missing, expired or deleted item is
+// ErrNotFound.
+func (c *Client) readItem(ctx context.Context, item map[string]types.AttributeValue, out any, getOptions *options) error {
+	if len(item) == 0 {
 		return ErrNotFound
 	}
 
-	if err := attributevalue.UnmarshalMap(resp.Item, out); err != nil {
+	if getOptions.shouldFilterExpired(c.FilterExpired) && isExpired(item, time.Now()) {
+		return ErrNotFound
+	}
+
+	if c.excludeDeleted(getOptions) && isDeleted(item) {
+		return ErrNotFound
+	}
+
+	read := c.readImage(item)
+	if err := c.decodeItem(ctx, item, reflect.TypeOf(out)); err != nil {
+		return fmt.Errorf("Get: %w", err)
+	}
+	item, err := c.upcastItem(ctx, item, read, reflect.TypeOf(out))
+	if err != nil {
+		return fmt.Errorf("Get: %w", err)
+	}
+	if err := getOptions.unscopeItem(item); err != nil {
+		return fmt.Errorf("Get: %w", err)
+	}
+
+	if err := attributevalue.UnmarshalMap(item, out); err != nil {
 		return fmt.Errorf("Get: UnmarshalMap: %w", err)
 	}
 
 	return nil
 }
 
+// UnmarshalItem unmarshals an item read outside the Client, such as a stream image, into out. Like Get, it
+// verifies, decrypts, decompresses and upcasts the item, but it does not filter out deleted or expired items or
+// write upcast items back. item is not modified.
+func (c *Client) UnmarshalItem(ctx context.Context, item map[string]types.AttributeValue, out any) error {
+	item = copyItem(item)
+	if err := c.decodeItem(ctx, item, reflect.TypeOf(out)); err != nil {
+		return fmt.Errorf("UnmarshalItem: %w", err)
+	}
+	item, err := c.upcastItem(ctx, item, nil, reflect.TypeOf(out))
+	if err != nil {
+		return fmt.Errorf("UnmarshalItem: %w", err)
+	}
+
+	if err := attributevalue.UnmarshalMap(item, out); err != nil {
+		return fmt.Errorf("UnmarshalItem: UnmarshalMap: %w", err)
+	}
+
+	return nil
+}
+
 func (c *Client) Put(ctx context.Context, row any, opts ...Option) error {
 	var putOptions options
 	for _, opt := range opts {
@@ -147,6 +256,10 @@ func (c *Client) Put(ctx context.Context, row any, opts ...Option) error {
 			return fmt.Errorf("Put: expression builder: %w", err)
 		}
 
+		if _, err := putOptions.scopeExpression(expr, expr.Condition()); err != nil {
+			return fmt.Errorf("Put: %w", err)
+		}
+
 		expressionAttributeValues = expr.Values()
 		expressionAttributeNames = expr.Names()
 		condition = expr.Condition()
@@ -156,6 +269,20 @@ func (c *Client) Put(ctx context.Context, row any, opts ...Option) error {
 	if err != nil {
 		return fmt.Errorf("Put: MarshalMap: %w", err)
 	}
+	omitEmptyIndexKeys(item)
+	c.stampSchemaVersion(item)
+
+	if err := putOptions.scopeItem(item); err != nil {
+		return fmt.Errorf("Put: %w", err)
+	}
+
+	if putOptions.expiresAt != 0 {
+		item[ttlColumn] = &types.AttributeValueMemberN{Value: strconv.FormatInt(int64(putOptions.expiresAt), 10)}
+	}
+
+	if err := c.encodeItem(ctx, item, reflect.TypeOf(row)); err != nil {
+		return fmt.Errorf("Put: %w", err)
+	}
 
 	req := dynamodb.PutItemInput{
 		TableName:                 &c.Table,
@@ -166,13 +293,21 @@ func (c *Client) Put(ctx context.Context, row any, opts ...Option) error {
 		ReturnValues:              putOptions.returnValues,
 	}
 
-	out, err := c.Ddb.PutItem(ctx, &req)
+	out, err := c.Ddb.PutItem(ctx, &req, c.rateLimit(ctx)...)
 	if err != nil {
 		// TODO check for conditional errors
 		return fmt.Errorf("Put: PutItem: %w", err)
 	}
 
 	if putOptions.returnValues != "" {
+		if len(out.Attributes) > 0 {
+			if err := c.decodeItem(ctx, out.Attributes, reflect.TypeOf(putOptions.returnValuesOut)); err != nil {
+				return fmt.Errorf("Put: %w", err)
+			}
+			if err := putOptions.unscopeItem(out.Attributes); err != nil {
+				return fmt.Errorf("Put: %w", err)
+			}
+		}
 		if err := attributevalue.UnmarshalMap(out.Attributes, putOptions.returnValuesOut); err != nil {
 			return fmt.Errorf("Put: UnmarshalMap: %w", err)
 		}
@@ -201,18 +336,52 @@ func (c *Client) Query(ctx context.Context, keyCond KeyCondition, out any, opts
 		skColumnName = queryOptions.skName
 	}
 
+	if queryOptions.consistent && isGlobalIndex(queryOptions.indexName) {
+		return &InvalidArgumentError{err: fmt.Errorf("Query: consistent reads are not supported on %s", queryOptions.indexName)}
+	}
+
 	keyCondition := keyCond(pkColumnName, skColumnName)
 
-	var (
-		expr expression.Expression
-		err  error
-	)
+	var binding []byte
+	if c.PageTokenKeys != nil && (queryOptions.pageToken != "" || queryOptions.pageOut != nil) {
+		var err error
+		binding, err = pageBinding(c.Table, queryOptions.tenant, queryOptions.indexName, keyCondition, queryOptions.filter)
+		if err != nil {
+			return fmt.Errorf("Query: page binding: %w", err)
+		}
+	}
+
+	startKey, err := c.openPage(queryOptions.pageToken, binding)
+	if err != nil {
+		return fmt.Errorf("Query: %w", err)
+	}
+	if err := queryOptions.checkStartKey(startKey); err != nil {
+		return fmt.Errorf("Query: %w", err)
+	}
+
+	filter := queryOptions.filter
+	if queryOptions.shouldFilterExpired(c.FilterExpired) {
+		notExpired := notExpiredFilter(time.Now())
+		if filter != nil {
+			notExpired = filter.And(notExpired)
+		}
+		filter = &notExpired
+	}
+	if c.excludeDeleted(&queryOptions) {
+		notDeleted := notDeletedFilter()
+		if filter != nil {
+			notDeleted = filter.And(notDeleted)
+		}
+		filter = &notDeleted
+	}
 
-	if queryOptions.filter != nil {
+	var expr expression.Expression
+
+	if filter != nil {
 		expr, err = expression.
 			NewBuilder().
 			WithKeyCondition(keyCondition).
-			WithFilter(*queryOptions.filter).
+			WithFilter(*filter).
 			Build()
 	} else {
 		expr, err = expression.
@@ -225,6 +394,16 @@ func (c *Client) Query(ctx context.Context, keyCond KeyCondition, out any, opts
 		return fmt.Errorf("Query: expression builder: %w", err)
 	}
 
+	if queryOptions.tenant != "" {
+		scoped, err := queryOptions.scopeExpression(expr, expr.KeyCondition(), expr.Filter())
+		if err != nil {
+			return fmt.Errorf("Query: %w", err)
+		}
+		if scoped == 0 {
+			return &InvalidArgumentError{err: errors.New("Query: key condition has no partition key")}
+		}
+	}
+
 	var indexName *string
 	if queryOptions.indexName != "" {
 		indexName = &queryOptions.indexName
@@ -233,7 +412,7 @@ func (c *Client) Query(ctx context.Context, keyCond KeyCondition, out any, opts
 	scanForward := !queryOptions.scanBackwards
 
 	req := dynamodb.QueryInput{
-		ExclusiveStartKey:         queryOptions.startKey,
+		ExclusiveStartKey:         startKey,
 		KeyConditionExpression:    expr.KeyCondition(),
 		ExpressionAttributeValues: expr.Values(),
 		ExpressionAttributeNames:  expr.Names(),
@@ -241,18 +420,50 @@ func (c *Client) Query(ctx context.Context, keyCond KeyCondition, out any, opts
 		IndexName:                 indexName,
 		Limit:                     queryOptions.pageSize,
 		ScanIndexForward:          &scanForward,
+		ConsistentRead:            queryOptions.consistentRead(),
 		TableName:                 &c.Table,
 	}
 
-	result, err := c.Ddb.Query(ctx, &req)
+	result, err := c.Ddb.Query(ctx, &req, c.rateLimit(ctx)...)
 	if err != nil {
 		return fmt.Errorf("Query: %w", err)
 	}
 
+	if queryOptions.pageOut != nil && len(result.LastEvaluatedKey) > 0 {
+		lastEvaluatedKey, err := c.sealPage(result.LastEvaluatedKey, binding)
+		if err != nil {
+			return &InternalError{err: fmt.Errorf("Query: %w", err)}
+		}
+		*queryOptions.pageOut = lastEvaluatedKey
+	}
+
 	if len(result.Items) == 0 {
+		// a filter can leave a page empty with more pages after it
 		return ErrNotFound
 	}
 
+	rowType := rowElemType(out)
+	for i, item := range result.Items {
+		if queryOptions.rowTypes != nil {
+			rowType = queryOptions.rowTypes.typeOf(item)
+		}
+
+		var read map[string]types.AttributeValue
+		if indexName == nil {
+			read = c.readImage(item)
+		}
+		if err := c.decodeItem(ctx, item, rowType); err != nil {
+			return fmt.Errorf("Query: %w", err)
+		}
+		if item, err = c.upcastItem(ctx, item, read, rowType); err != nil {
+			return fmt.Errorf("Query: %w", err)
+		}
+		result.Items[i] = item
+		if err := queryOptions.unscopeItem(item); err != nil {
+			return fmt.Errorf("Query: %w", err)
+		}
+	}
+
 	if queryOptions.unmarshalFn == nil {
 		if err = attributevalue.UnmarshalListOfMaps(result.Items, out); err != nil {
 			return &InternalError{err: fmt.Errorf("Query: UnmarshalListOfMaps: %w", err)}
@@ -263,31 +474,35 @@ func (c *Client) Query(ctx context.Context, keyCond KeyCondition, out any, opts
 		}
 	}
 
-	if queryOptions.pageOut != nil && len(result.LastEvaluatedKey) > 0 {
-		lastEvaluatedKey, err := SerializeExclusiveStartKey(result.LastEvaluatedKey)
-		if err != nil {
-			return &InternalError{err: fmt.Errorf("Query: SerializeExclusiveStartKey: %w", err)}
-		}
-		*queryOptions.pageOut = lastEvaluatedKey
-	}
-
 	return nil
 }
 
-// TransactDeletes uses a DynamoDB transaction to delete multiple items in one atomic request.
+// TransactDeletes uses a DynamoDB transaction to delete multiple items in one atomic request. If the Client
+// soft deletes, the rows are soft-deleted in one transaction instead. Archiving takes two writes per row.
 func (c *Client) TransactDeletes(ctx context.Context, token string, rows ...DeleteRow) error {
 	if len(rows) > 100 {
 		return &InvalidArgumentError{errors.New("cannot exceed 100 rows")}
 	}
 
-	items := makeDeletes(c.Table, rows...)
+	var transactItems []types.TransactWriteItem
+	if c.SoftDelete != nil {
+		var err error
+		if transactItems, err = c.makeSoftDeletes(ctx, rows...); err != nil {
+			return fmt.Errorf("TransactDeletes: %w", err)
+		}
+		if len(transactItems) > 100 {
+			return &InvalidArgumentError{errors.New("cannot exceed 100 items when archiving soft deletes")}
+		}
+	} else {
+		transactItems = makeTransactionWriteItems(nil, makeDeletes(c.Table, rows...), nil)
+	}
 
 	req := dynamodb.TransactWriteItemsInput{
-		TransactItems:      makeTransactionWriteItems(nil, items, nil),
+		TransactItems:      transactItems,
 		ClientRequestToken: &token,
 	}
 
-	if _, err := c.Ddb.TransactWriteItems(ctx, &req); err != nil {
+	if _, err := c.Ddb.TransactWriteItems(ctx, &req, c.rateLimit(ctx)...); err != nil {
 		var condFailedErr *types.ConditionalCheckFailedException
 		if errors.As(err, &condFailedErr) {
 			return fmt.Errorf("TransactDeletes: TransactWriteItems: Condition failed %w", condFailedErr)
@@ -306,6 +521,10 @@ func (c *Client) TransactDeletes(ctx context.Context, token string, rows ...Dele
 
 // TransactPuts uses a DynamoDB transaction to put multiple items in one atomic request.
 func (c *Client) TransactPuts(ctx context.Context, token string, rows ...PutRow) error {
+	return c.transactPuts(ctx, token, &options{}, rows...)
+}
+
+func (c *Client) transactPuts(ctx context.Context, token string, putOptions *options, rows ...PutRow) error {
 	if len(rows) > 100 {
 		return &InvalidArgumentError{errors.New("cannot exceed 100 rows")}
 	}
@@ -315,12 +534,22 @@ func (c *Client) TransactPuts(ctx context.Context, token string, rows ...PutRow)
 		return fmt.Errorf("TransactionPuts: %w", err)
 	}
 
+	for i := range items {
+		c.stampSchemaVersion(items[i].Item)
+		if err := putOptions.scopeItem(items[i].Item); err != nil {
+			return fmt.Errorf("TransactPuts: %w", err)
+		}
+		if err := c.encodeItem(ctx, items[i].Item, reflect.TypeOf(rows[i].Row)); err != nil {
+			return fmt.Errorf("TransactPuts: %w", err)
+		}
+	}
+
 	req := dynamodb.TransactWriteItemsInput{
 		TransactItems:      makeTransactionWriteItems(items, nil, nil),
 		ClientRequestToken: &token,
 	}
 
-	if _, err := c.Ddb.TransactWriteItems(ctx, &req); err != nil {
+	if _, err := c.Ddb.TransactWriteItems(ctx, &req, c.rateLimit(ctx)...); err != nil {
 		var condFailedErr *types.ConditionalCheckFailedException
 		if errors.As(err, &condFailedErr) {
 			return fmt.Errorf("TransactPuts: TransactWriteItems: Condition failed %w", condFailedErr)
@@ -392,6 +621,23 @@ func (c *Client) Update(ctx context.Context, pk, sk string, opts ...Option) erro
 		}
 	}
 
+	if updateOptions.expiresAt != 0 {
+		updateOptions.setAttribute(ttlColumn, &types.AttributeValueMemberN{Value: strconv.FormatInt(int64(updateOptions.expiresAt), 10)})
+	}
+
+	if len(updateOptions.encryptedUpdates) > 0 {
+		if err := c.encryptUpdates(ctx, pk, sk, &updateOptions); err != nil {
+			return fmt.Errorf("Update: %w", err)
+		}
+	}
+
+	if c.Encryption != nil && c.Encryption.Sign {
+		if err := c.updateSigned(ctx, pk, sk, &updateOptions); err != nil {
+			return fmt.Errorf("Update: %w", err)
+		}
+		return nil
+	}
+
 	var (
 		conditionExpression *string
 		expr                expression.Expression
@@ -413,6 +659,10 @@ func (c *Client) Update(ctx context.Context, pk, sk string, opts ...Option) erro
 		return fmt.Errorf("Update: expression builder: %w", err)
 	}
 
+	if _, err := updateOptions.scopeExpression(expr, expr.Condition(), expr.Update()); err != nil {
+		return fmt.Errorf("Update: %w", err)
+	}
+
 	if updateOptions.conditionsCount > 0 {
 		conditionExpression = expr.Condition()
 	}
@@ -434,7 +684,7 @@ func (c *Client) Update(ctx context.Context, pk, sk string, opts ...Option) erro
 		return &InvalidArgumentError{err: errors.New("no updates provided")}
 	}
 
-	out, err := c.Ddb.UpdateItem(ctx, &req)
+	out, err := c.Ddb.UpdateItem(ctx, &req, c.rateLimit(ctx)...)
 
 	if err != nil {
 		// TODO add conditional check failed error and map to
@@ -444,6 +694,14 @@ func (c *Client) Update(ctx context.Context, pk, sk string, opts ...Option) erro
 	}
 
 	if updateOptions.returnValues != "" {
+		if len(out.Attributes) > 0 {
+			if err := c.decodeItemKey(ctx, out.Attributes, pk, sk, reflect.TypeOf(updateOptions.returnValuesOut)); err != nil {
+				return fmt.Errorf("Update: %w", err)
+			}
+			if err := updateOptions.unscopeItem(out.Attributes); err != nil {
+				return fmt.Errorf("Update: %w", err)
+			}
+		}
 		if err := attributevalue.UnmarshalMap(out.Attributes, updateOptions.returnValuesOut); err != nil {
 			return fmt.Errorf("Update: UnmarshalMap: %w", err)
 		}
@@ -14,14 +14,17 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/google/uuid"
 
+	"github.com/danielwchapman/ddb/ddblocal"
+
 	"github.com/google/go-cmp/cmp"
 )
 
 var now = time.Now().Truncate(0)
 
+// uut runs against a real table when INTEGRATION is set, otherwise against an in-process ddblocal server.
 var uut = func() *Client {
 	if os.Getenv("INTEGRATION") == "" {
-		return nil
+		return newLocalClient()
 	}
 
 	cfg, err := config.LoadDefaultConfig(context.TODO())
@@ -41,6 +44,41 @@ var uut = func() *Client {
 	}
 }()
 
+// newLocalClient creates the integration test table described in the Makefile on a ddblocal server. The
+// server lives for the duration of the test binary.
+func newLocalClient() *Client {
+	server := ddblocal.NewServer()
+
+	client := &Client{
+		Ddb:   server.DynamoDB(),
+		Table: "IntegrationTest",
+	}
+
+	if err := client.CreateTable(context.Background(), TableSpec{GSIs: []int{1}, LSIs: []int{1}}); err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+// newTestClient creates a table described by spec on its own ddblocal server, which is closed when t ends.
+// configure, if not nil, sets up the Client before the table is created.
+func newTestClient(t *testing.T, spec TableSpec, configure func(*Client)) (*Client, *ddblocal.Server) {
+	t.Helper()
+
+	server := ddblocal.NewServer()
+	t.Cleanup(server.Close)
+
+	client := &Client{Ddb: server.DynamoDB(), Table: "Test"}
+	if configure != nil {
+		configure(client)
+	}
+	if err := client.CreateTable(context.Background(), spec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return client, server
+}
+
 type testRow struct {
 	PK         string
 	SK         string
@@ -92,10 +130,6 @@ func makeQueryTestRows(pkSuffix string, count int) []testRow {
 func TestIntegrationGet(t *testing.T) {
 	t.Parallel()
 
-	if os.Getenv("INTEGRATION") == "" {
-		t.Skip("skipping integration tests")
-	}
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -110,10 +144,6 @@ func TestIntegrationGet(t *testing.T) {
 func TestIntegrationPut(t *testing.T) {
 	t.Parallel()
 
-	if os.Getenv("INTEGRATION") == "" {
-		t.Skip("skipping integration tests")
-	}
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -182,11 +212,8 @@ func TestIntegrationPut(t *testing.T) {
 func TestIntegrationQuery(t *testing.T) {
 	t.Parallel()
 
-	if os.Getenv("INTEGRATION") == "" {
-		t.Skip("skipping integration tests")
-	}
-
-	ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
 
 	testRows := makeQueryTestRows(t.Name(), 8)
 	testTime, err := time.Parse(time.RFC3339, "2023-10-25T09:17:47.855071-04:00")
@@ -324,8 +351,63 @@ func TestIntegrationQuery(t *testing.T) {
 	})
 
 	t.Run("LSI", func(t *testing.T) {
-		// TODO
-		t.Skip("needs implemented")
+		type lsiRow struct {
+			PK string
+			SK string
+			RowLSI1Header
+		}
+
+		// LSI1SK sorts in the opposite order to SK
+		const count = 5
+		rows := make([]lsiRow, count)
+		for i := range rows {
+			rows[i] = lsiRow{
+				PK:            testRows[0].PK + "#LSI",
+				SK:            fmt.Sprintf("SK#%d", i),
+				RowLSI1Header: RowLSI1Header{LSI1SK: fmt.Sprintf("LSI#%d", count-1-i)},
+			}
+			if err := uut.Put(ctx, rows[i]); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}
+
+		t.Cleanup(func() {
+			for i := range rows {
+				if err := uut.Delete(ctx, rows[i].PK, rows[i].SK); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+		})
+
+		// page tokens carry LSI1SK so the second page continues in index order
+		var (
+			got       []lsiRow
+			pageToken string
+		)
+		for page := 0; page < 2; page++ {
+			var pageRows []lsiRow
+			if err := uut.Query(
+				ctx,
+				KeySkBeginsWith(testRows[0].PK+"#LSI", "LSI#"),
+				&pageRows,
+				WithIndexLSI1(),
+				WithConsistentRead(),
+				WithPageSize(2),
+				WithPage(pageToken, &pageToken),
+			); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got = append(got, pageRows...)
+		}
+
+		want := []lsiRow{rows[4], rows[3], rows[2], rows[1]}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("unexpected diff: %s", diff)
+		}
+
+		if err := uut.Query(ctx, KeyPkOnly(testRows[0].PK), &got, WithIndexGSI1(), WithConsistentRead()); err == nil {
+			t.Errorf("expected consistent reads on a GSI to be rejected")
+		}
 	})
 
 	t.Run("Ignore Zero PageSize", func(t *testing.T) {
@@ -354,6 +436,30 @@ func TestIntegrationQuery(t *testing.T) {
 		}
 	})
 
+	t.Run("WithFilter empty page", func(t *testing.T) {
+		// the filter leaves the first page empty, but its token still leads to the rows after it
+		filter := WithFilters(expression.Name("TestInt").GreaterThanEqual(expression.Value(2)))
+		var (
+			got       []testRow
+			pageToken string
+		)
+		err := uut.Query(ctx, KeyPkOnly(testRows[0].PK), &got, filter, WithPageSize(2), WithPage(pageToken, &pageToken))
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got: %v", err)
+		}
+		if pageToken == "" {
+			t.Fatalf("expected a token for the next page")
+		}
+
+		err = uut.Query(ctx, KeyPkOnly(testRows[0].PK), &got, filter, WithPageSize(2), WithPage(pageToken, &pageToken))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 2 || got[0].TestInt != 2 {
+			t.Errorf("unexpected rows: %+v", got)
+		}
+	})
+
 	t.Run("KeySkGreaterThan", func(t *testing.T) {
 		var got []testRow
 		err := uut.Query(
@@ -433,10 +539,6 @@ func TestIntegrationQuery(t *testing.T) {
 func TestIntegrationTransactPuts(t *testing.T) {
 	t.Parallel()
 
-	if os.Getenv("INTEGRATION") == "" {
-		t.Skip("skipping integration tests")
-	}
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -510,10 +612,6 @@ func TestIntegrationTransactPuts(t *testing.T) {
 func TestIntegrationUpdate(t *testing.T) {
 	t.Parallel()
 
-	if os.Getenv("INTEGRATION") == "" {
-		t.Skip("skipping integration tests")
-	}
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -687,3 +785,54 @@ func TestIntegrationUpdate(t *testing.T) {
 		}
 	})
 }
+
+func TestIntegrationSparseGSI(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	type gsiRow struct {
+		RowHeader
+		RowGSI1Header
+	}
+
+	row := gsiRow{RowHeader: RowHeader{PK: "PK#" + uuid.NewString(), SK: "SK#1", RowType: "SPARSE"}}
+	gsiPK := "GSI1PK#" + uuid.NewString()
+
+	t.Cleanup(func() {
+		if err := uut.Delete(ctx, row.PK, row.SK); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	// empty GSI keys are omitted instead of failing validation
+	if err := uut.Put(ctx, row); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []gsiRow
+	if err := uut.Query(ctx, KeyPkOnly(gsiPK), &got, WithIndexGSI1()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got: %v", err)
+	}
+
+	if err := uut.Update(ctx, row.PK, row.SK, WithGSIKeys(1, gsiPK, "GSI1SK#1")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := uut.Query(ctx, KeyPkOnly(gsiPK), &got, WithIndexGSI1()); err != nil || len(got) != 1 {
+		t.Errorf("expected the row in GSI1, got: %+v, %v", got, err)
+	}
+
+	if err := uut.Update(ctx, row.PK, row.SK, WithoutGSI(1)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := uut.Query(ctx, KeyPkOnly(gsiPK), &got, WithIndexGSI1()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got: %v", err)
+	}
+
+	if err := uut.Update(ctx, row.PK, row.SK, WithGSIKeys(1, "", "")); err == nil {
+		t.Errorf("expected empty GSI keys to be rejected")
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/danielwchapman/ddb"
+	"github.com/danielwchapman/ddb/internal/avjson"
+)
+
+// rawItem passes items through Client unchanged, keeping the type of every attribute.
+type rawItem map[string]types.AttributeValue
+
+func (r rawItem) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	return &types.AttributeValueMemberM{Value: r}, nil
+}
+
+func (r *rawItem) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
+	m, ok := av.(*types.AttributeValueMemberM)
+	if !ok {
+		return fmt.Errorf("expected an item, got %T", av)
+	}
+	*r = m.Value
+	return nil
+}
+
+var indexes = map[string]func() ddb.Option{
+	"GSI1": ddb.WithIndexGSI1,
+	"GSI2": ddb.WithIndexGSI2,
+	"GSI3": ddb.WithIndexGSI3,
+	"GSI4": ddb.WithIndexGSI4,
+	"GSI5": ddb.WithIndexGSI5,
+	"LSI1": ddb.WithIndexLSI1,
+	"LSI2": ddb.WithIndexLSI2,
+	"LSI3": ddb.WithIndexLSI3,
+	"LSI4": ddb.WithIndexLSI4,
+	"LSI5": ddb.WithIndexLSI5,
+}
+
+func newFlagSet(e *env, name, args string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(e.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(e.stderr, "usage: ddb %s %s\n", name, args)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parse parses flags given before, between or after the positional arguments, which it returns, and checks
+// there are n of them.
+func parse(flags *flag.FlagSet, args []string, n int) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(positional) != n {
+		flags.Usage()
+		return nil, errUsage
+	}
+	return positional, nil
+}
+
+func parseFormat(flags *flag.FlagSet, format string) (ddb.JSONFormat, error) {
+	switch format {
+	case "dynamodb":
+		return ddb.DynamoDBJSON, nil
+	case "plain":
+		return ddb.PlainJSON, nil
+	default:
+		fmt.Fprintf(flags.Output(), "unknown format %q\n", format)
+		return 0, errUsage
+	}
+}
+
+func runGet(ctx context.Context, e *env, args []string) error {
+	flags := newFlagSet(e, "get", "[-consistent] PK SK")
+	consistent := flags.Bool("consistent", false, "use a strongly consistent read")
+	keys, err := parse(flags, args, 2)
+	if err != nil {
+		return err
+	}
+
+	var opts []ddb.Option
+	if *consistent {
+		opts = append(opts, ddb.WithConsistentRead())
+	}
+
+	var item rawItem
+	if err := e.client.GetWithOptions(ctx, keys[0], keys[1], &item, opts...); err != nil {
+		return err
+	}
+	return e.print([]map[string]types.AttributeValue{item})
+}
+
+func runQuery(ctx context.Context, e *env, args []string) error {
+	flags := newFlagSet(e, "query", "[-sk SK | -sk-begins-with PREFIX] [-index GSI1] [-limit N] [-reverse] [-page TOKEN] PK")
+	sk := flags.String("sk", "", "match rows with this sort key")
+	skPrefix := flags.String("sk-begins-with", "", "match rows whose sort key begins with this prefix")
+	index := flags.String("index", "", "query an index: GSI1 to GSI5 or LSI1 to LSI5")
+	limit := flags.Int("limit", 0, "read at most N rows, printing the token for the next page")
+	reverse := flags.Bool("reverse", false, "read rows in descending sort key order")
+	page := flags.String("page", "", "start at the page token printed by a previous query")
+	consistent := flags.Bool("consistent", false, "use a strongly consistent read")
+	keys, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	pk := keys[0]
+
+	keyCond := ddb.KeyPkOnly(pk)
+	switch {
+	case *sk != "" && *skPrefix != "":
+		fmt.Fprintln(e.stderr, "-sk and -sk-begins-with cannot be used together")
+		return errUsage
+	case *sk != "":
+		keyCond = ddb.KeySkBetween(pk, *sk, *sk)
+	case *skPrefix != "":
+		keyCond = ddb.KeySkBeginsWith(pk, *skPrefix)
+	}
+
+	var nextPage string
+	opts := []ddb.Option{
+		ddb.WithPage(*page, &nextPage),
+		ddb.WithUnmarshalFunc(func(items []map[string]types.AttributeValue, out any) error {
+			*out.(*[]map[string]types.AttributeValue) = items
+			return nil
+		}),
+	}
+	if *index != "" {
+		withIndex, ok := indexes[strings.ToUpper(*index)]
+		if !ok {
+			fmt.Fprintf(e.stderr, "unknown index %q\n", *index)
+			return errUsage
+		}
+		opts = append(opts, withIndex())
+	}
+	if *limit > 0 {
+		opts = append(opts, ddb.WithPageSize(*limit))
+	}
+	if *reverse {
+		opts = append(opts, ddb.WithScanBackwards())
+	}
+	if *consistent {
+		opts = append(opts, ddb.WithConsistentRead())
+	}
+
+	var items []map[string]types.AttributeValue
+	if err := e.client.Query(ctx, keyCond, &items, opts...); err != nil && !errors.Is(err, ddb.ErrNotFound) {
+		return err
+	}
+	if err := e.print(items); err != nil {
+		return err
+	}
+	if nextPage != "" {
+		fmt.Fprintf(e.stderr, "next page: %s\n", nextPage)
+	}
+	return nil
+}
+
+func runPut(ctx context.Context, e *env, args []string) error {
+	flags := newFlagSet(e, "put", "[-f row.json] [-format dynamodb|plain]")
+	file := flags.String("f", "-", "read the row from this file, or - for stdin")
+	format := flags.String("format", "dynamodb", "the JSON format of the row: dynamodb or plain")
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	jsonFormat, err := parseFormat(flags, *format)
+	if err != nil {
+		return err
+	}
+
+	data, err := readFile(e, *file)
+	if err != nil {
+		return err
+	}
+	unmarshal := avjson.UnmarshalItem
+	if jsonFormat == ddb.PlainJSON {
+		unmarshal = avjson.UnmarshalPlainItem
+	}
+	item, err := unmarshal(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *file, err)
+	}
+	return e.client.Put(ctx, rawItem(item))
+}
+
+func runDelete(ctx context.Context, e *env, args []string) error {
+	flags := newFlagSet(e, "delete", "PK SK")
+	keys, err := parse(flags, args, 2)
+	if err != nil {
+		return err
+	}
+	return e.client.Delete(ctx, keys[0], keys[1])
+}
+
+func runExport(ctx context.Context, e *env, args []string) error {
+	flags := newFlagSet(e, "export", "[-pk PK] [-o rows.jsonl] [-format dynamodb|plain]")
+	pk := flags.String("pk", "", "export one partition instead of the whole table")
+	file := flags.String("o", "-", "write rows to this file, or - for stdout")
+	format := flags.String("format", "dynamodb", "the JSON format of the rows: dynamodb or plain")
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	jsonFormat, err := parseFormat(flags, *format)
+	if err != nil {
+		return err
+	}
+
+	opts := []ddb.ExportOption{ddb.WithExportFormat(jsonFormat)}
+	if *pk != "" {
+		opts = append(opts, ddb.WithExportPartition(*pk))
+	}
+
+	if *file == "-" {
+		n, err := e.client.Export(ctx, e.stdout, opts...)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stderr, "exported %d rows\n", n)
+		return nil
+	}
+
+	f, err := os.Create(*file)
+	if err != nil {
+		return err
+	}
+	n, err := e.client.Export(ctx, f, opts...)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stderr, "exported %d rows\n", n)
+	return nil
+}
+
+func runImport(ctx context.Context, e *env, args []string) error {
+	flags := newFlagSet(e, "import", "[-f rows.jsonl] [-format dynamodb|plain]")
+	file := flags.String("f", "-", "read rows from this file, or - for stdin")
+	format := flags.String("format", "dynamodb", "the JSON format of the rows: dynamodb or plain")
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	jsonFormat, err := parseFormat(flags, *format)
+	if err != nil {
+		return err
+	}
+
+	r := e.stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	n, err := e.client.Import(ctx, r, ddb.WithImportFormat(jsonFormat))
+	fmt.Fprintf(e.stderr, "imported %d rows\n", n)
+	return err
+}
+
+func readFile(e *env, name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(e.stdin)
+	}
+	return os.ReadFile(name)
+}
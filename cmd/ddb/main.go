@@ -0,0 +1,162 @@
+// Command ddb inspects and edits the rows of a single-table DynamoDB table from the command line.
+//
+// Usage:
+//
+//	ddb [flags] get PK SK
+//	ddb [flags] query [-sk SK | -sk-begins-with PREFIX] [-index GSI1] [-limit N] [-reverse] [-page TOKEN] PK
+//	ddb [flags] put [-f row.json] [-format dynamodb|plain]
+//	ddb [flags] delete PK SK
+//	ddb [flags] export [-pk PK] [-o rows.jsonl] [-format dynamodb|plain]
+//	ddb [flags] import [-f rows.jsonl] [-format dynamodb|plain]
+//
+// The flags before the command select the table and how to reach it:
+//
+//	-table     the table name, or $DDB_TABLE
+//	-endpoint  a custom endpoint, such as a local server, or $DDB_ENDPOINT
+//	-region    the AWS region, if not configured in the environment
+//	-output    how get and query print rows: table, json or dynamodb
+//
+// With -index, PK and SK name the partition and sort keys of the index, e.g. GSI1PK and GSI1SK. When a query
+// has more rows than -limit, the token for the next page is printed to stderr and is passed back with -page.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"github.com/danielwchapman/ddb"
+)
+
+const usage = `usage: ddb [-table TABLE] [-endpoint URL] [-region REGION] [-output table|json|dynamodb] COMMAND [ARGS]
+
+commands:
+  get PK SK          print one row
+  query PK           print the rows of a partition
+  put                write a row read from a JSON file
+  delete PK SK       delete one row
+  export             write rows as JSON Lines
+  import             write rows read from JSON Lines
+
+Run ddb COMMAND -h for the flags of a command.
+`
+
+// errUsage is returned for invalid arguments, after the usage has been printed.
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	err := run(context.Background(), os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	switch {
+	case err == nil:
+	case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+		os.Exit(2)
+	default:
+		fmt.Fprintln(os.Stderr, "ddb:", err)
+		os.Exit(1)
+	}
+}
+
+// env holds what every command needs.
+type env struct {
+	client *ddb.Client
+	output string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command func(ctx context.Context, e *env, args []string) error
+
+var commands = map[string]command{
+	"get":    runGet,
+	"query":  runQuery,
+	"put":    runPut,
+	"delete": runDelete,
+	"export": runExport,
+	"import": runImport,
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("ddb", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprint(stderr, usage) }
+
+	table := flags.String("table", os.Getenv("DDB_TABLE"), "table name")
+	endpoint := flags.String("endpoint", os.Getenv("DDB_ENDPOINT"), "custom endpoint URL")
+	region := flags.String("region", "", "AWS region")
+	output := flags.String("output", "table", "output format: table, json or dynamodb")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errUsage
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n", flags.Arg(0))
+		flags.Usage()
+		return errUsage
+	}
+	if *table == "" {
+		fmt.Fprintln(stderr, "-table or $DDB_TABLE is required")
+		return errUsage
+	}
+	switch *output {
+	case "table", "json", "dynamodb":
+	default:
+		fmt.Fprintf(stderr, "unknown output %q\n", *output)
+		return errUsage
+	}
+
+	client, err := newClient(ctx, *table, *endpoint, *region)
+	if err != nil {
+		return err
+	}
+
+	e := &env{client: client, output: *output, stdin: stdin, stdout: stdout, stderr: stderr}
+	return cmd(ctx, e, flags.Args()[1:])
+}
+
+func newClient(ctx context.Context, table, endpoint, region string) (*ddb.Client, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("load AWS config: %w", err)
+	}
+	if endpoint != "" {
+		// local servers accept any region and credentials
+		if cfg.Region == "" {
+			cfg.Region = "local"
+		}
+		if cfg.Credentials == nil || !hasCredentials(ctx, cfg.Credentials) {
+			cfg.Credentials = credentials.NewStaticCredentialsProvider("local", "local", "")
+		}
+	}
+
+	return &ddb.Client{
+		Ddb: dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+			if endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+			}
+		}),
+		Table: table,
+	}, nil
+}
+
+func hasCredentials(ctx context.Context, provider aws.CredentialsProvider) bool {
+	_, err := provider.Retrieve(ctx)
+	return err == nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/danielwchapman/ddb"
+	"github.com/danielwchapman/ddb/ddblocal"
+)
+
+// cli runs the command against a server, with -endpoint and -table given first.
+type cli struct {
+	t        *testing.T
+	endpoint string
+	table    string
+}
+
+func (c cli) run(stdin string, args ...string) (string, string, error) {
+	c.t.Helper()
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-endpoint", c.endpoint, "-table", c.table}, args...)
+	err := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), stderr.String(), err
+}
+
+func newCLI(t *testing.T, server *ddblocal.Server, table string) cli {
+	t.Helper()
+	client := &ddb.Client{Ddb: server.DynamoDB(), Table: table}
+	if err := client.CreateTable(context.Background(), ddb.TableSpec{GSIs: []int{1}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return cli{t: t, endpoint: server.URL, table: table}
+}
+
+func TestCLI(t *testing.T) {
+	// static credentials from the environment, so nothing else is looked up
+	t.Setenv("AWS_ACCESS_KEY_ID", "local")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "local")
+	t.Setenv("AWS_REGION", "local")
+
+	server := ddblocal.NewServer()
+	t.Cleanup(server.Close)
+	c := newCLI(t, server, "CLI")
+
+	rows := []string{
+		`{"PK":"USER#1","SK":"PROFILE","RowType":"USER","Name":"Ada","Age":36,"GSI1PK":"ORG#1","GSI1SK":"USER#1"}`,
+		`{"PK":"USER#1","SK":"ORDER#1","RowType":"ORDER","Total":12.5}`,
+		`{"PK":"USER#1","SK":"ORDER#2","RowType":"ORDER","Total":7}`,
+		`{"PK":"USER#2","SK":"PROFILE","RowType":"USER","Name":"Grace","GSI1PK":"ORG#1","GSI1SK":"USER#2"}`,
+		`{"PK":"USER#3","SK":"PROFILE","RowType":"USER","Name":"Edsger","GSI1PK":"ORG#1","GSI1SK":"USER#3"}`,
+	}
+	for _, row := range rows {
+		if _, _, err := c.run(row, "put", "-format", "plain"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	t.Run("get", func(t *testing.T) {
+		stdout, _, err := c.run("", "get", "USER#1", "PROFILE")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(stdout), "\n")
+		if len(lines) != 2 || strings.Fields(lines[0])[0] != "PK" || !strings.Contains(lines[1], "Ada") {
+			t.Errorf("unexpected table:\n%s", stdout)
+		}
+
+		stdout, _, err = c.run("", "-output", "dynamodb", "get", "USER#1", "PROFILE")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(stdout, `"Age":{"N":"36"}`) {
+			t.Errorf("unexpected output: %s", stdout)
+		}
+	})
+
+	t.Run("query with flags after the partition key", func(t *testing.T) {
+		stdout, _, err := c.run("", "-output", "json", "query", "USER#1", "--sk-begins-with", "ORDER#", "--reverse")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := `{"PK":"USER#1","RowType":"ORDER","SK":"ORDER#2","Total":7}` + "\n" +
+			`{"PK":"USER#1","RowType":"ORDER","SK":"ORDER#1","Total":12.5}` + "\n"
+		if stdout != want {
+			t.Errorf("unexpected output:\n%s", stdout)
+		}
+	})
+
+	t.Run("query an index by page", func(t *testing.T) {
+		stdout, stderr, err := c.run("", "-output", "json", "query", "-index", "GSI1", "-limit", "2", "ORG#1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.Count(stdout, "\n") != 2 {
+			t.Errorf("expected 2 rows, got:\n%s", stdout)
+		}
+		_, token, ok := strings.Cut(strings.TrimSpace(stderr), "next page: ")
+		if !ok {
+			t.Fatalf("expected a page token, got: %s", stderr)
+		}
+
+		stdout, stderr, err = c.run("", "-output", "json", "query", "-index", "GSI1", "-limit", "2", "-page", token, "ORG#1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(stdout, "Edsger") || strings.Count(stdout, "\n") != 1 || stderr != "" {
+			t.Errorf("unexpected last page:\n%s%s", stdout, stderr)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if _, _, err := c.run("", "delete", "USER#1", "ORDER#2"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, _, err := c.run("", "get", "USER#1", "ORDER#2"); !errors.Is(err, ddb.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got: %v", err)
+		}
+	})
+
+	t.Run("export and import", func(t *testing.T) {
+		exported, stderr, err := c.run("", "export", "-pk", "USER#1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stderr != "exported 2 rows\n" {
+			t.Errorf("unexpected output: %s", stderr)
+		}
+
+		target := newCLI(t, server, "Imported")
+		if _, stderr, err := target.run(exported, "import"); err != nil || stderr != "imported 2 rows\n" {
+			t.Fatalf("unexpected result: %s, %v", stderr, err)
+		}
+		stdout, _, err := target.run("", "-output", "json", "get", "USER#1", "ORDER#1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stdout != `{"PK":"USER#1","RowType":"ORDER","SK":"ORDER#1","Total":12.5}`+"\n" {
+			t.Errorf("unexpected output: %s", stdout)
+		}
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"scan"},
+			{"get", "USER#1"},
+			{"query", "-index", "GSI9", "ORG#1"},
+			{"put", "-format", "yaml"},
+		} {
+			if _, _, err := c.run("", args...); !errors.Is(err, errUsage) {
+				t.Errorf("%v: expected errUsage, got: %v", args, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/danielwchapman/ddb/internal/avjson"
+)
+
+// leadingColumns are printed first in tables, in this order, when rows have them.
+var leadingColumns = []string{"PK", "SK", "RowType"}
+
+// print writes items to stdout in the format chosen with -output.
+func (e *env) print(items []map[string]types.AttributeValue) error {
+	switch e.output {
+	case "json":
+		return printLines(e, items, avjson.MarshalPlainItem)
+	case "dynamodb":
+		return printLines(e, items, avjson.MarshalItem)
+	default:
+		return printTable(e, items)
+	}
+}
+
+// printLines writes one item per line.
+func printLines(e *env, items []map[string]types.AttributeValue, marshal func(map[string]types.AttributeValue) ([]byte, error)) error {
+	out := bufio.NewWriter(e.stdout)
+	for _, item := range items {
+		line, err := marshal(item)
+		if err != nil {
+			return err
+		}
+		out.Write(append(line, '\n'))
+	}
+	return out.Flush()
+}
+
+// printTable writes items as a table with a column for every attribute of any item.
+func printTable(e *env, items []map[string]types.AttributeValue) error {
+	if len(items) == 0 {
+		fmt.Fprintln(e.stderr, "no rows")
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var rest []string
+	for _, item := range items {
+		for name := range item {
+			if !seen[name] {
+				seen[name] = true
+				rest = append(rest, name)
+			}
+		}
+	}
+	sort.Strings(rest)
+
+	var columns []string
+	for _, name := range leadingColumns {
+		if seen[name] {
+			columns = append(columns, name)
+		}
+	}
+	for _, name := range rest {
+		if !isLeadingColumn(name) {
+			columns = append(columns, name)
+		}
+	}
+
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+	for _, item := range items {
+		cells := make([]string, len(columns))
+		for i, name := range columns {
+			if av, ok := item[name]; ok {
+				cell, err := formatValue(av)
+				if err != nil {
+					return err
+				}
+				cells[i] = cell
+			}
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	return w.Flush()
+}
+
+func isLeadingColumn(name string) bool {
+	for _, leading := range leadingColumns {
+		if name == leading {
+			return true
+		}
+	}
+	return false
+}
+
+// formatValue renders strings and numbers as they are and everything else as plain JSON, on one line.
+func formatValue(av types.AttributeValue) (string, error) {
+	var s string
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		s = v.Value
+	case *types.AttributeValueMemberN:
+		s = v.Value
+	default:
+		b, err := avjson.MarshalPlainItem(map[string]types.AttributeValue{"": av})
+		if err != nil {
+			return "", err
+		}
+		// strip the {"": ...} wrapper
+		s = string(b[len(`{"":`) : len(b)-1])
+	}
+	return strings.NewReplacer("\t", `\t`, "\n", `\n`).Replace(s), nil
+}
@@ -0,0 +1,322 @@
+package ddb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/danielwchapman/ddb/internal/avjson"
+	"github.com/danielwchapman/ddb/internal/itemsize"
+)
+
+const (
+	// MaxItemSize is the largest item DynamoDB stores.
+	MaxItemSize = 400 * 1024
+
+	// DefaultOffloadSize is the compressed size at which attributes are moved to the blob store.
+	DefaultOffloadSize = 64 * 1024
+)
+
+// Compressed attributes start with compressedVersion, then whether the data is inline or in the blob store, then
+// the name of the compressor.
+const (
+	compressedVersion = 1
+	compressedInline  = 'i'
+	compressedBlob    = 'b'
+)
+
+// ErrItemTooLarge is returned by Put and TransactPuts, before writing, for items over MaxItemSize.
+var ErrItemTooLarge = errors.New("item too large")
+
+// Compressor compresses attributes tagged `ddb:",compress"`. Its name is stored with every compressed attribute.
+type Compressor interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// Gzip is the default Compressor.
+type Gzip struct {
+	// Level is a compress/gzip level. Zero means gzip.DefaultCompression.
+	Level int
+}
+
+func (g Gzip) Name() string { return "gzip" }
+
+func (g Gzip) Compress(data []byte) ([]byte, error) {
+	level := g.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (g Gzip) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// BlobStore holds attributes too large to keep in the table. Blobs are named by the hash of their contents, so
+// they are never overwritten with different data.
+type BlobStore interface {
+	PutBlob(ctx context.Context, key string, data []byte) error
+	GetBlob(ctx context.Context, key string) ([]byte, error)
+}
+
+// FileBlobStore is a BlobStore that keeps one file per blob in Dir.
+type FileBlobStore struct {
+	Dir string
+}
+
+func (s *FileBlobStore) PutBlob(_ context.Context, key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so that readers never see part of a blob
+	tmp, err := os.CreateTemp(s.Dir, ".blob-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileBlobStore) GetBlob(_ context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// path checks that key is a blob key, as keys are read back from the table.
+func (s *FileBlobStore) path(key string) (string, error) {
+	if _, err := hex.DecodeString(key); err != nil || key == "" {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.Dir, key), nil
+}
+
+// Compression configures how attributes tagged `ddb:",compress"` are stored. Without it they are compressed with
+// gzip. Compressed attributes are stored as binary and cannot be used in conditions, filters or keys.
+type Compression struct {
+	// Compressor compresses new writes. Attributes written by gzip can always be read.
+	Compressor Compressor
+
+	// Blobs, if set, stores compressed attributes of at least OffloadSize bytes outside the table, leaving a
+	// pointer in the row. Blobs are not removed when their rows are. Attributes that are also encrypted stay in
+	// the row, because blobs are not encrypted.
+	Blobs       BlobStore
+	OffloadSize int
+}
+
+// compressedAttributes returns the attribute names of the fields tagged with compress.
+func compressedAttributes(t reflect.Type) []string {
+	return taggedAttributes(t, "compress")
+}
+
+func (c *Client) compressor() Compressor {
+	if c.Compression != nil && c.Compression.Compressor != nil {
+		return c.Compression.Compressor
+	}
+	return Gzip{}
+}
+
+func (c *Client) decompressor(name string) (Compressor, error) {
+	if compressor := c.compressor(); compressor.Name() == name {
+		return compressor, nil
+	}
+	if name == (Gzip{}).Name() {
+		return Gzip{}, nil
+	}
+	return nil, fmt.Errorf("unknown compressor %q", name)
+}
+
+// encodeItem prepares a marshalled row for writing: compressing, encrypting and signing it, then checking that
+// it fits in DynamoDB.
+func (c *Client) encodeItem(ctx context.Context, item map[string]types.AttributeValue, rowType reflect.Type) error {
+	if err := c.compressItem(ctx, item, rowType); err != nil {
+		return err
+	}
+	if err := c.sealItem(ctx, item, rowType); err != nil {
+		return err
+	}
+	if size := ItemSize(item); size > MaxItemSize {
+		pk, sk := c.rowKey(item)
+		return fmt.Errorf("PK %s SK %s is %d bytes: %w", pk, sk, size, ErrItemTooLarge)
+	}
+	return nil
+}
+
+// decodeItem reverses encodeItem for an item read from the table.
+func (c *Client) decodeItem(ctx context.Context, item map[string]types.AttributeValue, rowType reflect.Type) error {
+	pk, sk := c.rowKey(item)
+	return c.decodeItemKey(ctx, item, pk, sk, rowType)
+}
+
+// decodeItemKey is decodeItem for items that may not include their key, such as the attributes Update returns.
+func (c *Client) decodeItemKey(ctx context.Context, item map[string]types.AttributeValue, pk, sk string, rowType reflect.Type) error {
+	if err := c.openItemKey(ctx, item, pk, sk, rowType); err != nil {
+		return err
+	}
+	return c.decompressItem(ctx, item, rowType)
+}
+
+func (c *Client) compressItem(ctx context.Context, item map[string]types.AttributeValue, rowType reflect.Type) error {
+	compressor := c.compressor()
+	encrypted := encryptedAttributes(rowType)
+	for _, name := range compressedAttributes(rowType) {
+		av, ok := item[name]
+		if !ok {
+			continue
+		}
+
+		// compress the typed DynamoDB JSON so that decompression restores the original type
+		data, err := json.Marshal(avjson.Value{AttributeValue: av})
+		if err != nil {
+			return fmt.Errorf("compress %s: json.Marshal: %w", name, err)
+		}
+		compressed, err := compressor.Compress(data)
+		if err != nil {
+			return fmt.Errorf("compress %s: %w", name, err)
+		}
+
+		kind := byte(compressedInline)
+		if c.shouldOffload(len(compressed)) && !slices.Contains(encrypted, name) {
+			sum := sha256.Sum256(compressed)
+			key := hex.EncodeToString(sum[:])
+			if err := c.Compression.Blobs.PutBlob(ctx, key, compressed); err != nil {
+				return fmt.Errorf("compress %s: PutBlob: %w", name, err)
+			}
+			kind, compressed = compressedBlob, []byte(key)
+		}
+
+		item[name] = &types.AttributeValueMemberB{Value: compressedEnvelope(kind, compressor.Name(), compressed)}
+	}
+	return nil
+}
+
+func (c *Client) shouldOffload(size int) bool {
+	if c.Compression == nil || c.Compression.Blobs == nil {
+		return false
+	}
+	threshold := c.Compression.OffloadSize
+	if threshold <= 0 {
+		threshold = DefaultOffloadSize
+	}
+	return size >= threshold
+}
+
+func (c *Client) decompressItem(ctx context.Context, item map[string]types.AttributeValue, rowType reflect.Type) error {
+	for _, name := range compressedAttributes(rowType) {
+		av, ok := item[name]
+		if !ok {
+			continue
+		}
+		compressed, ok := av.(*types.AttributeValueMemberB)
+		if !ok {
+			return &InternalError{err: fmt.Errorf("attribute %s is not compressed", name)}
+		}
+		decompressed, err := c.decompressAttribute(ctx, compressed.Value)
+		if err != nil {
+			return &InternalError{err: fmt.Errorf("decompress %s: %w", name, err)}
+		}
+		item[name] = decompressed
+	}
+	return nil
+}
+
+func (c *Client) decompressAttribute(ctx context.Context, data []byte) (types.AttributeValue, error) {
+	if len(data) < 3 || data[0] != compressedVersion || len(data) < 3+int(data[2]) {
+		return nil, errors.New("malformed compressed attribute")
+	}
+	kind, name, payload := data[1], string(data[3:3+int(data[2])]), data[3+int(data[2]):]
+
+	compressor, err := c.decompressor(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case compressedInline:
+	case compressedBlob:
+		if c.Compression == nil || c.Compression.Blobs == nil {
+			return nil, errors.New("attribute is in the blob store but the client has no Blobs")
+		}
+		if payload, err = c.Compression.Blobs.GetBlob(ctx, string(payload)); err != nil {
+			return nil, fmt.Errorf("GetBlob: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown compressed attribute kind %q", kind)
+	}
+
+	decompressed, err := compressor.Decompress(payload)
+	if err != nil {
+		return nil, err
+	}
+	return avjson.UnmarshalValue(decompressed)
+}
+
+func compressedEnvelope(kind byte, name string, data []byte) []byte {
+	out := make([]byte, 0, 3+len(name)+len(data))
+	out = append(out, compressedVersion, kind, byte(len(name)))
+	out = append(out, name...)
+	return append(out, data...)
+}
+
+// EstimateItemSize returns the size DynamoDB counts for a row, before compression or encryption, to check it
+// against MaxItemSize.
+func EstimateItemSize(row any) (int, error) {
+	item, err := attributevalue.MarshalMap(row)
+	if err != nil {
+		return 0, fmt.Errorf("EstimateItemSize: MarshalMap: %w", err)
+	}
+	return ItemSize(item), nil
+}
+
+// ItemSize returns the size DynamoDB counts for an item: the lengths of the attribute names plus the sizes of
+// the values. Numbers are estimated from their significant digits.
+func ItemSize(item map[string]types.AttributeValue) int {
+	return itemsize.Of(item)
+}
@@ -0,0 +1,130 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type auditRow struct {
+	RowHeader
+	Entries []string `ddb:",compress"`
+	Detail  string   `ddb:",compress,encrypt"`
+}
+
+func withCompression(compression *Compression) func(*Client) {
+	return func(c *Client) {
+		withEncryption(false)(c)
+		c.Compression = compression
+	}
+}
+
+func TestCompression(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newTestClient(t, TableSpec{}, withCompression(nil))
+	ctx := context.Background()
+
+	// about 500 KB uncompressed, well over the item limit
+	row := auditRow{
+		RowHeader: RowHeader{PK: "AUDIT#1", SK: "LOG", RowType: "AUDIT"},
+		Entries:   []string{strings.Repeat("user signed in; ", 32*1024)},
+		Detail:    strings.Repeat("x", 1024),
+	}
+	if err := client.Put(ctx, row); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	item := rawItem(t, client, "AUDIT#1", "LOG")
+	if _, ok := item["Entries"].(*types.AttributeValueMemberB); !ok {
+		t.Errorf("expected Entries to be compressed, got: %T", item["Entries"])
+	}
+	if size := ItemSize(item); size > 10*1024 {
+		t.Errorf("expected a small item, got %d bytes", size)
+	}
+
+	var got auditRow
+	if err := client.Get(ctx, "AUDIT#1", "LOG", &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Entries) != 1 || got.Entries[0] != row.Entries[0] || got.Detail != row.Detail {
+		t.Errorf("unexpected row after decompression")
+	}
+}
+
+func TestErrItemTooLarge(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newTestClient(t, TableSpec{}, withCompression(nil))
+
+	row := pageTokenRow{RowHeader: RowHeader{PK: "AUDIT#1", SK: "LOG", RowType: "AUDIT"}, Name: strings.Repeat("x", MaxItemSize)}
+
+	size, err := EstimateItemSize(row)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if size <= MaxItemSize {
+		t.Errorf("expected more than %d bytes, got %d", MaxItemSize, size)
+	}
+
+	if err := client.Put(context.Background(), row); !errors.Is(err, ErrItemTooLarge) {
+		t.Errorf("expected ErrItemTooLarge, got: %v", err)
+	}
+	if err := client.TransactPuts(context.Background(), "token", PutRow{Row: row}); !errors.Is(err, ErrItemTooLarge) {
+		t.Errorf("expected ErrItemTooLarge, got: %v", err)
+	}
+}
+
+func TestCompressionOffload(t *testing.T) {
+	t.Parallel()
+
+	blobs := &FileBlobStore{Dir: t.TempDir()}
+	client, _ := newTestClient(t, TableSpec{}, withCompression(&Compression{Blobs: blobs, OffloadSize: 1}))
+	ctx := context.Background()
+
+	row := auditRow{
+		RowHeader: RowHeader{PK: "AUDIT#1", SK: "LOG", RowType: "AUDIT"},
+		Entries:   []string{"a", "b"},
+		Detail:    "secret",
+	}
+	if err := client.Put(ctx, row); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// only Entries is offloaded, Detail is encrypted and stays in the row
+	files, err := os.ReadDir(blobs.Dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expected 1 blob, got: %d", len(files))
+	}
+
+	var got auditRow
+	if err := client.Get(ctx, "AUDIT#1", "LOG", &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Entries) != 2 || got.Detail != "secret" {
+		t.Errorf("unexpected row: %+v", got)
+	}
+}
+
+func TestItemSize(t *testing.T) {
+	t.Parallel()
+
+	item := map[string]types.AttributeValue{
+		"PK":   &types.AttributeValueMemberS{Value: "USER#1"},   // 2 + 6
+		"N":    &types.AttributeValueMemberN{Value: "-12.3400"}, // 1 + 3
+		"Flag": &types.AttributeValueMemberBOOL{Value: true},    // 4 + 1
+		"L": &types.AttributeValueMemberL{Value: []types.AttributeValue{ // 1 + 3 + 1 + 1
+			&types.AttributeValueMemberS{Value: "a"},
+		}},
+	}
+	if got := ItemSize(item); got != 23 {
+		t.Errorf("expected 23 bytes, got %d", got)
+	}
+}
@@ -4,16 +4,39 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/danielwchapman/ddb/internal/avjson"
 )
 
+// typedPagePrefix starts page tokens that keep DynamoDB types. Tokens without it are legacy tokens, which are
+// base64 encoded plain JSON and so cannot start with a dot-separated prefix.
+const typedPagePrefix = "t1."
+
+// DeserializeExclusiveStartKey decodes a token from SerializeExclusiveStartKey. Tokens from earlier versions,
+// which did not keep number, binary and set types, are still accepted.
 func DeserializeExclusiveStartKey(key string) (map[string]types.AttributeValue, error) {
 	if key == "" {
 		return nil, nil
 	}
 
+	if encoded, ok := strings.CutPrefix(key, typedPagePrefix); ok {
+		jsonBytes, err := base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("DeserializeExclusiveStartKey: RawURLEncoding.DecodeString %w", err)
+		}
+
+		startKey, err := avjson.UnmarshalItem(jsonBytes)
+		if err != nil {
+			return nil, fmt.Errorf("DeserializeExclusiveStartKey: avjson.UnmarshalItem %w", err)
+		}
+		return startKey, nil
+	}
+
 	jsonBytes, err := base64.StdEncoding.DecodeString(key)
 	if err != nil {
 		return nil, fmt.Errorf("DeserializeExclusiveStartKey: StdEncoding.DecodeString %w", err)
@@ -27,22 +50,35 @@ func DeserializeExclusiveStartKey(key string) (map[string]types.AttributeValue,
 	return attributevalue.MarshalMap(outputJSON)
 }
 
+// SerializeExclusiveStartKey encodes a LastEvaluatedKey as a URL-safe token that keeps the DynamoDB type of
+// every attribute, so that number and binary sort keys page correctly.
 func SerializeExclusiveStartKey(key map[string]types.AttributeValue) (string, error) {
 	if len(key) == 0 {
 		return "", nil
 	}
 
-	convertedMap := map[string]any{}
-	if err := attributevalue.UnmarshalMap(key, &convertedMap); err != nil {
-		return "", fmt.Errorf("SerializeExclusiveStartKey: attributevalue.UnmarshalMap %w", err)
+	jsonBytes, err := avjson.MarshalItem(key)
+	if err != nil {
+		return "", fmt.Errorf("SerializeExclusiveStartKey: avjson.MarshalItem %w", err)
 	}
 
-	jsonBytes, err := json.Marshal(convertedMap)
-	if err != nil {
-		return "", fmt.Errorf("SerializeExclusiveStartKey: json.Marshal %w", err)
+	return typedPagePrefix + base64.RawURLEncoding.EncodeToString(jsonBytes), nil
+}
+
+// UnchangedCondition holds while every attribute of item, as it was read, still has the value it was read
+// with. Attributes added since are not checked.
+func UnchangedCondition(item map[string]types.AttributeValue) expression.ConditionBuilder {
+	names := make([]string, 0, len(item))
+	for name := range item {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	return base64.StdEncoding.EncodeToString(jsonBytes), nil
+	cond := expression.AttributeExists(expression.Name(defaultPK))
+	for _, name := range names {
+		cond = cond.And(expression.Name(name).Equal(expression.Value(item[name])))
+	}
+	return cond
 }
 
 func marshalMapList(items []any) ([]map[string]types.AttributeValue, error) {
@@ -72,6 +108,7 @@ func makePuts(table string, rows ...PutRow) ([]types.Put, error) {
 		if err != nil {
 			return nil, fmt.Errorf("TransactionPuts: MarshalMap: %w", err)
 		}
+		omitEmptyIndexKeys(item)
 
 		items[i] = types.Put{
 			Item:                item,
@@ -83,6 +120,29 @@ func makePuts(table string, rows ...PutRow) ([]types.Put, error) {
 	return items, nil
 }
 
+// omitEmptyIndexKeys removes empty or NULL secondary index key attributes, which DynamoDB rejects, so that
+// rows with an unset RowGSInHeader are left out of the sparse index instead of failing to write.
+func omitEmptyIndexKeys(item map[string]types.AttributeValue) {
+	for _, keys := range gsiKeys {
+		omitEmptyAttribute(item, keys.pk)
+		omitEmptyAttribute(item, keys.sk)
+	}
+	for _, keys := range lsiKeys {
+		omitEmptyAttribute(item, keys.sk)
+	}
+}
+
+func omitEmptyAttribute(item map[string]types.AttributeValue, name string) {
+	switch v := item[name].(type) {
+	case *types.AttributeValueMemberS:
+		if v.Value == "" {
+			delete(item, name)
+		}
+	case *types.AttributeValueMemberNULL:
+		delete(item, name)
+	}
+}
+
 func makeDeletes(table string, rows ...DeleteRow) []types.Delete {
 	items := make([]types.Delete, len(rows))
 	for i := range rows {
@@ -0,0 +1,57 @@
+package ddb
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestSerializeExclusiveStartKey(t *testing.T) {
+	t.Parallel()
+
+	key := map[string]types.AttributeValue{
+		"PK":     &types.AttributeValueMemberS{Value: "USER#1"},
+		"SK":     &types.AttributeValueMemberN{Value: "12345678901234567890"},
+		"LSI1SK": &types.AttributeValueMemberB{Value: []byte{0, 1, 2, 255}},
+		"Flag":   &types.AttributeValueMemberBOOL{Value: true},
+		"Empty":  &types.AttributeValueMemberNULL{Value: true},
+		"Set":    &types.AttributeValueMemberNS{Value: []string{"1", "2.5"}},
+	}
+
+	token, err := SerializeExclusiveStartKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := DeserializeExclusiveStartKey(token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if diff := cmp.Diff(key, got, cmpopts.IgnoreUnexported(
+		types.AttributeValueMemberS{}, types.AttributeValueMemberN{}, types.AttributeValueMemberB{},
+		types.AttributeValueMemberBOOL{}, types.AttributeValueMemberNULL{}, types.AttributeValueMemberNS{},
+	)); diff != "" {
+		t.Errorf("unexpected key (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeserializeExclusiveStartKeyLegacy(t *testing.T) {
+	t.Parallel()
+
+	// tokens issued before typed tokens were base64 encoded plain JSON
+	legacy := base64.StdEncoding.EncodeToString([]byte(`{"PK":"USER#1","SK":"NOTE#1"}`))
+
+	got, err := DeserializeExclusiveStartKey(legacy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := itemKey("USER#1", "NOTE#1")
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(types.AttributeValueMemberS{})); diff != "" {
+		t.Errorf("unexpected key (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,85 @@
+package ddblocal
+
+import (
+	"math"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/danielwchapman/ddb/internal/itemsize"
+)
+
+const (
+	readUnitSize  = 4096
+	writeUnitSize = 1024
+)
+
+// consumedCapacity is returned when a request sets ReturnConsumedCapacity. Only the table's capacity is
+// counted; writes to indexes are not.
+type consumedCapacity struct {
+	TableName     string
+	CapacityUnits float64
+}
+
+// readUnits is the capacity of reading size bytes: one unit per 4 KB, halved for eventually consistent reads.
+func readUnits(size int, consistent bool) float64 {
+	units := math.Max(1, math.Ceil(float64(size)/readUnitSize))
+	if !consistent {
+		units /= 2
+	}
+	return units
+}
+
+// writeUnits is the capacity of writing an item that was old and is new: one unit per 1 KB of the larger.
+func writeUnits(old, new map[string]types.AttributeValue) float64 {
+	size := max(itemsize.Of(old), itemsize.Of(new))
+	return math.Max(1, math.Ceil(float64(size)/writeUnitSize))
+}
+
+// capacity returns the consumed capacity to include in a response, or nil if mode does not ask for it.
+func capacity(mode, tableName string, units float64) *consumedCapacity {
+	if mode == "" || types.ReturnConsumedCapacity(mode) == types.ReturnConsumedCapacityNone {
+		return nil
+	}
+	return &consumedCapacity{TableName: tableName, CapacityUnits: units}
+}
+
+// capacities is capacity for requests that can span tables.
+func capacities(mode string, units map[string]float64) []consumedCapacity {
+	var out []consumedCapacity
+	for tableName, u := range units {
+		if c := capacity(mode, tableName, u); c != nil {
+			out = append(out, *c)
+		}
+	}
+	return out
+}
+
+// dataOperations are the operations that consume capacity and can be throttled.
+var dataOperations = map[string]bool{
+	"BatchGetItem":       true,
+	"BatchWriteItem":     true,
+	"DeleteItem":         true,
+	"GetItem":            true,
+	"PutItem":            true,
+	"Query":              true,
+	"Scan":               true,
+	"TransactWriteItems": true,
+	"UpdateItem":         true,
+}
+
+// Throttle makes the next n item operations fail with ProvisionedThroughputExceededException, so tests can
+// check how clients back off.
+func (s *Store) Throttle(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.throttle = n
+}
+
+func throughputExceeded() error {
+	return &apiError{
+		code:    "ProvisionedThroughputExceededException",
+		message: "The level of configured provisioned throughput for the table was exceeded",
+		status:  http.StatusBadRequest,
+	}
+}
@@ -0,0 +1,63 @@
+package ddblocal
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/danielwchapman/ddb/internal/avjson"
+)
+
+const errorTypePrefix = "com.amazonaws.dynamodb.v20120810#"
+
+// apiError is an error returned to clients in the DynamoDB JSON error format.
+type apiError struct {
+	code    string
+	message string
+	status  int
+	reasons []cancellationReason
+}
+
+type cancellationReason struct {
+	Code    string
+	Message string      `json:",omitempty"`
+	Item    avjson.Item `json:",omitempty"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s: %s", e.code, e.message)
+}
+
+func (e *apiError) body() map[string]any {
+	body := map[string]any{
+		"__type":  errorTypePrefix + e.code,
+		"message": e.message,
+	}
+	if len(e.reasons) > 0 {
+		body["CancellationReasons"] = e.reasons
+	}
+	return body
+}
+
+func validationError(message string) error {
+	return &apiError{code: "ValidationException", message: message, status: http.StatusBadRequest}
+}
+
+func resourceNotFound(message string) error {
+	return &apiError{code: "ResourceNotFoundException", message: message, status: http.StatusBadRequest}
+}
+
+func resourceInUse(message string) error {
+	return &apiError{code: "ResourceInUseException", message: message, status: http.StatusBadRequest}
+}
+
+func conditionalCheckFailed() error {
+	return &apiError{
+		code:    "ConditionalCheckFailedException",
+		message: "The conditional request failed",
+		status:  http.StatusBadRequest,
+	}
+}
+
+func unknownOperation(target string) error {
+	return &apiError{code: "UnknownOperationException", message: target, status: http.StatusBadRequest}
+}
@@ -0,0 +1,936 @@
+package ddblocal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// This file implements a parser for the DynamoDB expression language: condition, filter and key condition
+// expressions, update expressions and projection expressions. Attribute name (#n) and value (:v)
+// placeholders are resolved while parsing.
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenName
+	tokenValue
+	tokenNumber
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '#' || c == ':':
+			j := i + 1
+			for j < len(s) && isIdentChar(rune(s[j])) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("invalid placeholder at position %d", i)
+			}
+			kind := tokenName
+			if c == ':' {
+				kind = tokenValue
+			}
+			tokens = append(tokens, token{kind: kind, text: s[i:j]})
+			i = j
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(s) && unicode.IsDigit(rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: s[i:j]})
+			i = j
+		case isIdentChar(c):
+			j := i
+			for j < len(s) && isIdentChar(rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: s[i:j]})
+			i = j
+		case strings.HasPrefix(s[i:], "<>") || strings.HasPrefix(s[i:], "<=") || strings.HasPrefix(s[i:], ">="):
+			tokens = append(tokens, token{kind: tokenPunct, text: s[i : i+2]})
+			i += 2
+		case strings.ContainsRune("(),.[]=<>+-", c):
+			tokens = append(tokens, token{kind: tokenPunct, text: string(c)})
+			i++
+		default:
+			return nil, fmt.Errorf("invalid character %q at position %d", c, i)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+func isIdentChar(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	names  map[string]string
+	values map[string]types.AttributeValue
+}
+
+func newParser(expr string, names map[string]string, values map[string]types.AttributeValue) (*parser, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{tokens: tokens, names: names, values: values}, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isPunct(text string) bool {
+	t := p.peek()
+	return t.kind == tokenPunct && t.text == text
+}
+
+func (p *parser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && strings.EqualFold(t.text, keyword)
+}
+
+func (p *parser) expectPunct(text string) error {
+	if !p.isPunct(text) {
+		return fmt.Errorf("expected %q, got %q", text, p.peek().text)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) expectEOF() error {
+	if t := p.peek(); t.kind != tokenEOF {
+		return fmt.Errorf("unexpected token %q", t.text)
+	}
+	return nil
+}
+
+// pathElement is either a map key or a list index.
+type pathElement struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+type path []pathElement
+
+func (p path) String() string {
+	var b strings.Builder
+	for i, e := range p {
+		switch {
+		case e.isIndex:
+			fmt.Fprintf(&b, "[%d]", e.index)
+		case i > 0:
+			b.WriteString("." + e.name)
+		default:
+			b.WriteString(e.name)
+		}
+	}
+	return b.String()
+}
+
+func (p *parser) parsePath() (path, error) {
+	name, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+	out := path{{name: name}}
+
+	for {
+		switch {
+		case p.isPunct("."):
+			p.next()
+			name, err := p.parseName()
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, pathElement{name: name})
+		case p.isPunct("["):
+			p.next()
+			t := p.next()
+			if t.kind != tokenNumber {
+				return nil, fmt.Errorf("expected list index, got %q", t.text)
+			}
+			index, err := strconv.Atoi(t.text)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct("]"); err != nil {
+				return nil, err
+			}
+			out = append(out, pathElement{index: index, isIndex: true})
+		default:
+			return out, nil
+		}
+	}
+}
+
+func (p *parser) parseName() (string, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenName:
+		name, ok := p.names[t.text]
+		if !ok {
+			return "", fmt.Errorf("undefined attribute name %s", t.text)
+		}
+		return name, nil
+	case tokenIdent:
+		return t.text, nil
+	default:
+		return "", fmt.Errorf("expected attribute name, got %q", t.text)
+	}
+}
+
+// operand is a value in an expression: an attribute path, a value placeholder or a function of those.
+type operand interface {
+	eval(item map[string]types.AttributeValue) (types.AttributeValue, error)
+}
+
+type pathOperand struct{ path path }
+
+type valueOperand struct{ value types.AttributeValue }
+
+type sizeOperand struct{ path path }
+
+type ifNotExistsOperand struct {
+	path     path
+	fallback operand
+}
+
+type listAppendOperand struct{ a, b operand }
+
+type arithmeticOperand struct {
+	op   string
+	a, b operand
+}
+
+func (o pathOperand) eval(item map[string]types.AttributeValue) (types.AttributeValue, error) {
+	v, _ := getPath(item, o.path)
+	return v, nil
+}
+
+func (o valueOperand) eval(map[string]types.AttributeValue) (types.AttributeValue, error) {
+	return o.value, nil
+}
+
+func (o sizeOperand) eval(item map[string]types.AttributeValue) (types.AttributeValue, error) {
+	v, ok := getPath(item, o.path)
+	if !ok {
+		return nil, nil
+	}
+	var n int
+	switch v := v.(type) {
+	case *types.AttributeValueMemberS:
+		n = len(v.Value)
+	case *types.AttributeValueMemberB:
+		n = len(v.Value)
+	case *types.AttributeValueMemberSS:
+		n = len(v.Value)
+	case *types.AttributeValueMemberNS:
+		n = len(v.Value)
+	case *types.AttributeValueMemberBS:
+		n = len(v.Value)
+	case *types.AttributeValueMemberL:
+		n = len(v.Value)
+	case *types.AttributeValueMemberM:
+		n = len(v.Value)
+	default:
+		return nil, nil
+	}
+	return &types.AttributeValueMemberN{Value: strconv.Itoa(n)}, nil
+}
+
+func (o ifNotExistsOperand) eval(item map[string]types.AttributeValue) (types.AttributeValue, error) {
+	if v, ok := getPath(item, o.path); ok {
+		return v, nil
+	}
+	return o.fallback.eval(item)
+}
+
+func (o listAppendOperand) eval(item map[string]types.AttributeValue) (types.AttributeValue, error) {
+	a, err := o.a.eval(item)
+	if err != nil {
+		return nil, err
+	}
+	b, err := o.b.eval(item)
+	if err != nil {
+		return nil, err
+	}
+	la, okA := a.(*types.AttributeValueMemberL)
+	lb, okB := b.(*types.AttributeValueMemberL)
+	if !okA || !okB {
+		return nil, validationError("list_append operands must be lists")
+	}
+	out := make([]types.AttributeValue, 0, len(la.Value)+len(lb.Value))
+	out = append(out, la.Value...)
+	out = append(out, lb.Value...)
+	return &types.AttributeValueMemberL{Value: out}, nil
+}
+
+func (o arithmeticOperand) eval(item map[string]types.AttributeValue) (types.AttributeValue, error) {
+	a, err := o.a.eval(item)
+	if err != nil {
+		return nil, err
+	}
+	b, err := o.b.eval(item)
+	if err != nil {
+		return nil, err
+	}
+	na, okA := a.(*types.AttributeValueMemberN)
+	nb, okB := b.(*types.AttributeValueMemberN)
+	if !okA || !okB {
+		return nil, validationError("an operand in the update expression has an incorrect data type")
+	}
+	sum, err := addNumbers(na.Value, nb.Value, o.op == "-")
+	if err != nil {
+		return nil, err
+	}
+	return &types.AttributeValueMemberN{Value: sum}, nil
+}
+
+// parseOperand parses a single operand. Arithmetic is only allowed by parseSetValue.
+func (p *parser) parseOperand() (operand, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokenValue:
+		p.next()
+		v, ok := p.values[t.text]
+		if !ok {
+			return nil, fmt.Errorf("undefined attribute value %s", t.text)
+		}
+		return valueOperand{value: v}, nil
+	case t.kind == tokenIdent && p.tokens[p.pos+1].kind == tokenPunct && p.tokens[p.pos+1].text == "(":
+		p.next()
+		p.next()
+		var (
+			op  operand
+			err error
+		)
+		switch strings.ToLower(t.text) {
+		case "size":
+			var pth path
+			pth, err = p.parsePath()
+			op = sizeOperand{path: pth}
+		case "if_not_exists":
+			var (
+				pth      path
+				fallback operand
+			)
+			if pth, err = p.parsePath(); err != nil {
+				return nil, err
+			}
+			if err = p.expectPunct(","); err != nil {
+				return nil, err
+			}
+			fallback, err = p.parseOperand()
+			op = ifNotExistsOperand{path: pth, fallback: fallback}
+		case "list_append":
+			var a, b operand
+			if a, err = p.parseOperand(); err != nil {
+				return nil, err
+			}
+			if err = p.expectPunct(","); err != nil {
+				return nil, err
+			}
+			b, err = p.parseOperand()
+			op = listAppendOperand{a: a, b: b}
+		default:
+			return nil, fmt.Errorf("invalid function name %s", t.text)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return op, p.expectPunct(")")
+	default:
+		pth, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		return pathOperand{path: pth}, nil
+	}
+}
+
+// condition is a boolean expression evaluated against an item.
+type condition interface {
+	eval(item map[string]types.AttributeValue) (bool, error)
+}
+
+type andCondition struct{ a, b condition }
+
+type orCondition struct{ a, b condition }
+
+type notCondition struct{ c condition }
+
+type compareCondition struct {
+	op   string
+	a, b operand
+}
+
+type betweenCondition struct{ v, lo, hi operand }
+
+type inCondition struct {
+	v    operand
+	list []operand
+}
+
+type functionCondition struct {
+	name string
+	path path
+	arg  operand
+}
+
+func (c andCondition) eval(item map[string]types.AttributeValue) (bool, error) {
+	a, err := c.a.eval(item)
+	if err != nil || !a {
+		return false, err
+	}
+	return c.b.eval(item)
+}
+
+func (c orCondition) eval(item map[string]types.AttributeValue) (bool, error) {
+	a, err := c.a.eval(item)
+	if err != nil || a {
+		return a, err
+	}
+	return c.b.eval(item)
+}
+
+func (c notCondition) eval(item map[string]types.AttributeValue) (bool, error) {
+	v, err := c.c.eval(item)
+	return !v, err
+}
+
+func (c compareCondition) eval(item map[string]types.AttributeValue) (bool, error) {
+	a, err := c.a.eval(item)
+	if err != nil {
+		return false, err
+	}
+	b, err := c.b.eval(item)
+	if err != nil {
+		return false, err
+	}
+	if a == nil || b == nil {
+		return c.op == "<>" && (a != nil || b != nil), nil
+	}
+
+	switch c.op {
+	case "=":
+		return equalValues(a, b), nil
+	case "<>":
+		return !equalValues(a, b), nil
+	}
+
+	cmp, ok := compareValues(a, b)
+	if !ok {
+		return false, nil
+	}
+	switch c.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func (c betweenCondition) eval(item map[string]types.AttributeValue) (bool, error) {
+	v, err := c.v.eval(item)
+	if err != nil {
+		return false, err
+	}
+	lo, err := c.lo.eval(item)
+	if err != nil {
+		return false, err
+	}
+	hi, err := c.hi.eval(item)
+	if err != nil {
+		return false, err
+	}
+	if v == nil || lo == nil || hi == nil {
+		return false, nil
+	}
+	cmpLo, okLo := compareValues(v, lo)
+	cmpHi, okHi := compareValues(v, hi)
+	return okLo && okHi && cmpLo >= 0 && cmpHi <= 0, nil
+}
+
+func (c inCondition) eval(item map[string]types.AttributeValue) (bool, error) {
+	v, err := c.v.eval(item)
+	if err != nil || v == nil {
+		return false, err
+	}
+	for _, o := range c.list {
+		candidate, err := o.eval(item)
+		if err != nil {
+			return false, err
+		}
+		if candidate != nil && equalValues(v, candidate) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c functionCondition) eval(item map[string]types.AttributeValue) (bool, error) {
+	v, exists := getPath(item, c.path)
+
+	switch c.name {
+	case "attribute_exists":
+		return exists, nil
+	case "attribute_not_exists":
+		return !exists, nil
+	}
+
+	if !exists {
+		return false, nil
+	}
+
+	arg, err := c.arg.eval(item)
+	if err != nil || arg == nil {
+		return false, err
+	}
+
+	switch c.name {
+	case "attribute_type":
+		s, ok := arg.(*types.AttributeValueMemberS)
+		return ok && typeName(v) == s.Value, nil
+	case "begins_with":
+		switch v := v.(type) {
+		case *types.AttributeValueMemberS:
+			prefix, ok := arg.(*types.AttributeValueMemberS)
+			return ok && strings.HasPrefix(v.Value, prefix.Value), nil
+		case *types.AttributeValueMemberB:
+			prefix, ok := arg.(*types.AttributeValueMemberB)
+			return ok && strings.HasPrefix(string(v.Value), string(prefix.Value)), nil
+		}
+		return false, nil
+	default: // contains
+		switch v := v.(type) {
+		case *types.AttributeValueMemberS:
+			sub, ok := arg.(*types.AttributeValueMemberS)
+			return ok && strings.Contains(v.Value, sub.Value), nil
+		case *types.AttributeValueMemberB:
+			sub, ok := arg.(*types.AttributeValueMemberB)
+			return ok && strings.Contains(string(v.Value), string(sub.Value)), nil
+		case *types.AttributeValueMemberL:
+			for _, e := range v.Value {
+				if equalValues(e, arg) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case *types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+			for _, e := range setElements(v) {
+				if equalValues(e, arg) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+}
+
+// parseCondition parses a complete condition expression.
+func parseCondition(expr string, names map[string]string, values map[string]types.AttributeValue) (condition, error) {
+	p, err := newParser(expr, names, values)
+	if err != nil {
+		return nil, err
+	}
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	return c, p.expectEOF()
+}
+
+func (p *parser) parseOr() (condition, error) {
+	c, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		p.next()
+		rhs, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		c = orCondition{a: c, b: rhs}
+	}
+	return c, nil
+}
+
+func (p *parser) parseAnd() (condition, error) {
+	c, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("AND") {
+		p.next()
+		rhs, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		c = andCondition{a: c, b: rhs}
+	}
+	return c, nil
+}
+
+func (p *parser) parseNot() (condition, error) {
+	if p.isKeyword("NOT") {
+		p.next()
+		c, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notCondition{c: c}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (condition, error) {
+	if p.isPunct("(") {
+		p.next()
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expectPunct(")")
+	}
+
+	if t := p.peek(); t.kind == tokenIdent {
+		name := strings.ToLower(t.text)
+		switch name {
+		case "attribute_exists", "attribute_not_exists", "attribute_type", "begins_with", "contains":
+			p.next()
+			if err := p.expectPunct("("); err != nil {
+				return nil, err
+			}
+			pth, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			c := functionCondition{name: name, path: pth}
+			if name != "attribute_exists" && name != "attribute_not_exists" {
+				if err := p.expectPunct(","); err != nil {
+					return nil, err
+				}
+				if c.arg, err = p.parseOperand(); err != nil {
+					return nil, err
+				}
+			}
+			return c, p.expectPunct(")")
+		}
+	}
+
+	lhs, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := p.peek(); {
+	case t.kind == tokenPunct && (t.text == "=" || t.text == "<>" || t.text == "<" || t.text == "<=" ||
+		t.text == ">" || t.text == ">="):
+		p.next()
+		rhs, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return compareCondition{op: t.text, a: lhs, b: rhs}, nil
+	case p.isKeyword("BETWEEN"):
+		p.next()
+		lo, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isKeyword("AND") {
+			return nil, fmt.Errorf("expected AND in BETWEEN, got %q", p.peek().text)
+		}
+		p.next()
+		hi, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return betweenCondition{v: lhs, lo: lo, hi: hi}, nil
+	case p.isKeyword("IN"):
+		p.next()
+		if err := p.expectPunct("("); err != nil {
+			return nil, err
+		}
+		c := inCondition{v: lhs}
+		for {
+			o, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			c.list = append(c.list, o)
+			if !p.isPunct(",") {
+				break
+			}
+			p.next()
+		}
+		return c, p.expectPunct(")")
+	default:
+		return nil, fmt.Errorf("expected comparison, got %q", t.text)
+	}
+}
+
+// updateExpression is a parsed update expression.
+type updateExpression struct {
+	sets    []setAction
+	removes []path
+	adds    []valueAction
+	deletes []valueAction
+}
+
+type setAction struct {
+	path  path
+	value operand
+}
+
+type valueAction struct {
+	path  path
+	value types.AttributeValue
+}
+
+func parseUpdate(expr string, names map[string]string, values map[string]types.AttributeValue) (*updateExpression, error) {
+	p, err := newParser(expr, names, values)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &updateExpression{}
+	for p.peek().kind != tokenEOF {
+		clause := p.next()
+		if clause.kind != tokenIdent {
+			return nil, fmt.Errorf("expected SET, REMOVE, ADD or DELETE, got %q", clause.text)
+		}
+
+		for {
+			switch strings.ToUpper(clause.text) {
+			case "SET":
+				pth, err := p.parsePath()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expectPunct("="); err != nil {
+					return nil, err
+				}
+				value, err := p.parseSetValue()
+				if err != nil {
+					return nil, err
+				}
+				out.sets = append(out.sets, setAction{path: pth, value: value})
+			case "REMOVE":
+				pth, err := p.parsePath()
+				if err != nil {
+					return nil, err
+				}
+				out.removes = append(out.removes, pth)
+			case "ADD", "DELETE":
+				pth, err := p.parsePath()
+				if err != nil {
+					return nil, err
+				}
+				t := p.next()
+				value, ok := p.values[t.text]
+				if t.kind != tokenValue || !ok {
+					return nil, fmt.Errorf("expected attribute value, got %q", t.text)
+				}
+				action := valueAction{path: pth, value: value}
+				if strings.EqualFold(clause.text, "ADD") {
+					out.adds = append(out.adds, action)
+				} else {
+					out.deletes = append(out.deletes, action)
+				}
+			default:
+				return nil, fmt.Errorf("expected SET, REMOVE, ADD or DELETE, got %q", clause.text)
+			}
+
+			if !p.isPunct(",") {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if len(out.sets)+len(out.removes)+len(out.adds)+len(out.deletes) == 0 {
+		return nil, fmt.Errorf("empty update expression")
+	}
+
+	return out, nil
+}
+
+func (p *parser) parseSetValue() (operand, error) {
+	a, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.isPunct("+") || p.isPunct("-") {
+		op := p.next().text
+		b, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return arithmeticOperand{op: op, a: a, b: b}, nil
+	}
+	return a, nil
+}
+
+// apply returns a copy of item with the update applied, and the names of the top level attributes it
+// touched. All SET values are evaluated against the original item.
+func (u *updateExpression) apply(item map[string]types.AttributeValue) (map[string]types.AttributeValue, []string, error) {
+	out := cloneItem(item)
+	touched := map[string]struct{}{}
+
+	values := make([]types.AttributeValue, len(u.sets))
+	for i, set := range u.sets {
+		v, err := set.value.eval(item)
+		if err != nil {
+			return nil, nil, err
+		}
+		if v == nil {
+			return nil, nil, validationError("the provided expression refers to an attribute that does not exist in the item")
+		}
+		values[i] = cloneValue(v)
+	}
+
+	for i, set := range u.sets {
+		if err := setPath(out, set.path, values[i]); err != nil {
+			return nil, nil, err
+		}
+		touched[set.path[0].name] = struct{}{}
+	}
+
+	for _, pth := range u.removes {
+		removePath(out, pth)
+		touched[pth[0].name] = struct{}{}
+	}
+
+	for _, add := range u.adds {
+		current, exists := getPath(out, add.path)
+		var next types.AttributeValue
+		switch v := add.value.(type) {
+		case *types.AttributeValueMemberN:
+			n := "0"
+			if exists {
+				cur, ok := current.(*types.AttributeValueMemberN)
+				if !ok {
+					return nil, nil, validationError("an operand in the update expression has an incorrect data type")
+				}
+				n = cur.Value
+			}
+			sum, err := addNumbers(n, v.Value, false)
+			if err != nil {
+				return nil, nil, err
+			}
+			next = &types.AttributeValueMemberN{Value: sum}
+		case *types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+			if !exists {
+				next = cloneValue(v)
+				break
+			}
+			if typeName(current) != typeName(v) {
+				return nil, nil, validationError("an operand in the update expression has an incorrect data type")
+			}
+			next = setUnion(current, v)
+		default:
+			return nil, nil, validationError("ADD only supports numbers and sets")
+		}
+		if err := setPath(out, add.path, next); err != nil {
+			return nil, nil, err
+		}
+		touched[add.path[0].name] = struct{}{}
+	}
+
+	for _, del := range u.deletes {
+		current, exists := getPath(out, del.path)
+		if !exists {
+			continue
+		}
+		if typeName(current) != typeName(del.value) {
+			return nil, nil, validationError("an operand in the update expression has an incorrect data type")
+		}
+		next := setDifference(current, del.value)
+		if next == nil {
+			removePath(out, del.path)
+		} else if err := setPath(out, del.path, next); err != nil {
+			return nil, nil, err
+		}
+		touched[del.path[0].name] = struct{}{}
+	}
+
+	names := make([]string, 0, len(touched))
+	for name := range touched {
+		names = append(names, name)
+	}
+
+	return out, names, nil
+}
+
+// parseProjection parses a comma separated list of attribute paths.
+func parseProjection(expr string, names map[string]string) ([]path, error) {
+	p, err := newParser(expr, names, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []path
+	for {
+		pth, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, pth)
+		if !p.isPunct(",") {
+			break
+		}
+		p.next()
+	}
+	return out, p.expectEOF()
+}
+
+// project returns the attributes of item named by paths. Nested paths project their whole top level
+// attribute.
+func project(item map[string]types.AttributeValue, paths []path) map[string]types.AttributeValue {
+	if len(paths) == 0 || item == nil {
+		return item
+	}
+	out := map[string]types.AttributeValue{}
+	for _, pth := range paths {
+		if v, ok := item[pth[0].name]; ok {
+			out[pth[0].name] = v
+		}
+	}
+	return out
+}
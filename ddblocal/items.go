@@ -0,0 +1,552 @@
+package ddblocal
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/danielwchapman/ddb/internal/avjson"
+	"github.com/danielwchapman/ddb/internal/itemsize"
+)
+
+const (
+	maxTransactItems = 100
+	maxBatchGetKeys  = 100
+	maxBatchWrites   = 25
+)
+
+// evalCondition evaluates an optional condition expression against item, which may be nil.
+func evalCondition(expr string, fields expressionFields, item map[string]types.AttributeValue) (bool, error) {
+	if expr == "" {
+		return true, nil
+	}
+	cond, err := parseCondition(expr, fields.ExpressionAttributeNames, fields.ExpressionAttributeValues)
+	if err != nil {
+		return false, validationError("Invalid ConditionExpression: " + err.Error())
+	}
+	return cond.eval(item)
+}
+
+func checkCondition(expr string, fields expressionFields, item map[string]types.AttributeValue) error {
+	ok, err := evalCondition(expr, fields, item)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return conditionalCheckFailed()
+	}
+	return nil
+}
+
+func (s *Store) getItem(in *getItemInput) (*getItemOutput, error) {
+	t, err := s.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.validateKey(in.Key); err != nil {
+		return nil, err
+	}
+
+	paths, err := parseOptionalProjection(in.ProjectionExpression, in.ExpressionAttributeNames)
+	if err != nil {
+		return nil, err
+	}
+
+	item, ok := t.items[t.itemKey(in.Key)]
+	consumed := capacity(in.ReturnConsumedCapacity, t.name, readUnits(itemsize.Of(item), in.ConsistentRead))
+	if !ok {
+		return &getItemOutput{ConsumedCapacity: consumed}, nil
+	}
+	return &getItemOutput{Item: cloneItem(project(item, paths)), ConsumedCapacity: consumed}, nil
+}
+
+func parseOptionalProjection(expr string, names map[string]string) ([]path, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	paths, err := parseProjection(expr, names)
+	if err != nil {
+		return nil, validationError("Invalid ProjectionExpression: " + err.Error())
+	}
+	return paths, nil
+}
+
+func (s *Store) putItem(in *putItemInput) (*attributesOutput, error) {
+	t, err := s.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.validateItem(in.Item); err != nil {
+		return nil, err
+	}
+
+	k := t.itemKey(in.Item)
+	old := t.items[k]
+
+	if err := checkCondition(in.ConditionExpression, in.expressionFields, old); err != nil {
+		return nil, err
+	}
+
+	t.items[k] = cloneItem(in.Item)
+	consumed := capacity(in.ReturnConsumedCapacity, t.name, writeUnits(old, in.Item))
+
+	switch types.ReturnValue(in.ReturnValues) {
+	case "", types.ReturnValueNone:
+		return &attributesOutput{ConsumedCapacity: consumed}, nil
+	case types.ReturnValueAllOld:
+		return &attributesOutput{Attributes: cloneItem(old), ConsumedCapacity: consumed}, nil
+	default:
+		return nil, validationError("ReturnValues can only be ALL_OLD or NONE")
+	}
+}
+
+func (s *Store) deleteItem(in *deleteItemInput) (*attributesOutput, error) {
+	t, err := s.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.validateKey(in.Key); err != nil {
+		return nil, err
+	}
+
+	k := t.itemKey(in.Key)
+	old := t.items[k]
+
+	if err := checkCondition(in.ConditionExpression, in.expressionFields, old); err != nil {
+		return nil, err
+	}
+
+	delete(t.items, k)
+	consumed := capacity(in.ReturnConsumedCapacity, t.name, writeUnits(old, nil))
+
+	switch types.ReturnValue(in.ReturnValues) {
+	case "", types.ReturnValueNone:
+		return &attributesOutput{ConsumedCapacity: consumed}, nil
+	case types.ReturnValueAllOld:
+		return &attributesOutput{Attributes: old, ConsumedCapacity: consumed}, nil
+	default:
+		return nil, validationError("ReturnValues can only be ALL_OLD or NONE")
+	}
+}
+
+func (s *Store) updateItem(in *updateItemInput) (*attributesOutput, error) {
+	t, err := s.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	old, updated, touched, err := t.prepareUpdate(in.Key, in.UpdateExpression, in.ConditionExpression, in.expressionFields)
+	if err != nil {
+		return nil, err
+	}
+
+	t.items[t.itemKey(in.Key)] = updated
+	consumed := capacity(in.ReturnConsumedCapacity, t.name, writeUnits(old, updated))
+
+	switch types.ReturnValue(in.ReturnValues) {
+	case "", types.ReturnValueNone:
+		return &attributesOutput{ConsumedCapacity: consumed}, nil
+	case types.ReturnValueAllOld:
+		return &attributesOutput{Attributes: cloneItem(old), ConsumedCapacity: consumed}, nil
+	case types.ReturnValueAllNew:
+		return &attributesOutput{Attributes: cloneItem(updated), ConsumedCapacity: consumed}, nil
+	case types.ReturnValueUpdatedOld:
+		return &attributesOutput{Attributes: cloneItem(selectAttributes(old, touched)), ConsumedCapacity: consumed}, nil
+	case types.ReturnValueUpdatedNew:
+		return &attributesOutput{Attributes: cloneItem(selectAttributes(updated, touched)), ConsumedCapacity: consumed}, nil
+	default:
+		return nil, validationError("Invalid ReturnValues: " + in.ReturnValues)
+	}
+}
+
+// prepareUpdate validates and applies an update to a copy of the item identified by key. An item that does
+// not exist is created from its key.
+func (t *table) prepareUpdate(
+	key map[string]types.AttributeValue,
+	updateExpr string,
+	conditionExpr string,
+	fields expressionFields,
+) (old, updated map[string]types.AttributeValue, touched []string, err error) {
+	if err := t.validateKey(key); err != nil {
+		return nil, nil, nil, err
+	}
+
+	old = t.items[t.itemKey(key)]
+
+	if err := checkCondition(conditionExpr, fields, old); err != nil {
+		return nil, nil, nil, err
+	}
+
+	update, err := parseUpdate(updateExpr, fields.ExpressionAttributeNames, fields.ExpressionAttributeValues)
+	if err != nil {
+		return nil, nil, nil, validationError("Invalid UpdateExpression: " + err.Error())
+	}
+
+	base := old
+	if base == nil {
+		base = cloneItem(key)
+	}
+
+	updated, touched, err = update.apply(base)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if t.itemKey(updated) != t.itemKey(key) {
+		return nil, nil, nil, validationError("Cannot update attribute that is part of the key")
+	}
+
+	if err := t.validateItem(updated); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return old, updated, touched, nil
+}
+
+func selectAttributes(item map[string]types.AttributeValue, names []string) map[string]types.AttributeValue {
+	out := map[string]types.AttributeValue{}
+	for _, name := range names {
+		if v, ok := item[name]; ok {
+			out[name] = v
+		}
+	}
+	return out
+}
+
+func (s *Store) query(in *queryInput) (*queryOutput, error) {
+	if in.KeyConditionExpression == "" {
+		return nil, validationError("KeyConditionExpression is required")
+	}
+	keyCond, err := parseCondition(in.KeyConditionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+	if err != nil {
+		return nil, validationError("Invalid KeyConditionExpression: " + err.Error())
+	}
+	return s.read(in, keyCond)
+}
+
+func (s *Store) scan(in *queryInput) (*queryOutput, error) {
+	if in.TotalSegments < 0 || in.Segment < 0 || (in.TotalSegments > 0 && in.Segment >= in.TotalSegments) {
+		return nil, validationError("Invalid Segment or TotalSegments")
+	}
+	return s.read(in, nil)
+}
+
+// read implements Query (with a key condition) and Scan (without one).
+func (s *Store) read(in *queryInput, keyCond condition) (*queryOutput, error) {
+	t, err := s.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := t.index(in.IndexName)
+	if err != nil {
+		return nil, err
+	}
+	if in.ConsistentRead && idx.name != "" && !idx.local {
+		return nil, validationError("Consistent reads are not supported on global secondary indexes")
+	}
+
+	var filter condition
+	if in.FilterExpression != "" {
+		if filter, err = parseCondition(in.FilterExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues); err != nil {
+			return nil, validationError("Invalid FilterExpression: " + err.Error())
+		}
+	}
+
+	paths, err := parseOptionalProjection(in.ProjectionExpression, in.ExpressionAttributeNames)
+	if err != nil {
+		return nil, err
+	}
+
+	forward := in.ScanIndexForward == nil || *in.ScanIndexForward
+
+	var candidates []map[string]types.AttributeValue
+	for _, item := range t.sortedItems(idx) {
+		if keyCond != nil {
+			ok, err := keyCond.eval(item)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		if in.TotalSegments > 0 && t.segmentOf(item, in.TotalSegments) != in.Segment {
+			continue
+		}
+		if len(in.ExclusiveStartKey) > 0 {
+			cmp := t.compareInIndex(item, in.ExclusiveStartKey, idx)
+			if (forward && cmp <= 0) || (!forward && cmp >= 0) {
+				continue
+			}
+		}
+		candidates = append(candidates, item)
+	}
+
+	if !forward {
+		for i, j := 0, len(candidates)-1; i < j; i, j = i+1, j-1 {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		}
+	}
+
+	out := &queryOutput{Items: []avjson.Item{}}
+	scannedSize := 0
+	for i, item := range candidates {
+		if in.Limit > 0 && i == in.Limit {
+			out.LastEvaluatedKey = t.indexKeyOf(candidates[i-1], idx)
+			break
+		}
+		out.ScannedCount++
+		scannedSize += itemsize.Of(item)
+
+		if filter != nil {
+			ok, err := filter.eval(item)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		out.Count++
+		if in.Select != string(types.SelectCount) {
+			out.Items = append(out.Items, cloneItem(project(item, paths)))
+		}
+	}
+
+	// reads are counted by the size of the items scanned, before filtering
+	out.ConsumedCapacity = capacity(in.ReturnConsumedCapacity, t.name, readUnits(scannedSize, in.ConsistentRead))
+	return out, nil
+}
+
+// transactOp is one validated operation of a TransactWriteItems request.
+type transactOp struct {
+	table   *table
+	key     string
+	old     map[string]types.AttributeValue
+	updated map[string]types.AttributeValue // nil deletes the item
+	write   bool
+	failed  bool
+	reason  cancellationReason
+}
+
+func (s *Store) transactWriteItems(in *transactWriteItemsInput) (*transactWriteItemsOutput, error) {
+	if len(in.TransactItems) == 0 || len(in.TransactItems) > maxTransactItems {
+		return nil, validationError(fmt.Sprintf("TransactItems must have between 1 and %d items", maxTransactItems))
+	}
+
+	var (
+		ops    = make([]transactOp, len(in.TransactItems))
+		seen   = map[string]struct{}{}
+		failed bool
+	)
+
+	for i, item := range in.TransactItems {
+		op, err := s.prepareTransactOp(item)
+		if err != nil {
+			return nil, err
+		}
+
+		id := op.table.name + "\x00" + op.key
+		if _, ok := seen[id]; ok {
+			return nil, validationError("Transaction request cannot include multiple operations on one item")
+		}
+		seen[id] = struct{}{}
+
+		failed = failed || op.failed
+		ops[i] = op
+	}
+
+	if failed {
+		reasons := make([]cancellationReason, len(ops))
+		codes := make([]string, len(ops))
+		for i := range ops {
+			reasons[i] = ops[i].reason
+			codes[i] = ops[i].reason.Code
+		}
+		return nil, &apiError{
+			code: "TransactionCanceledException",
+			message: "Transaction cancelled, please refer cancellation reasons for specific reasons [" +
+				strings.Join(codes, ", ") + "]",
+			status:  http.StatusBadRequest,
+			reasons: reasons,
+		}
+	}
+
+	// transactional writes consume twice the capacity of plain writes
+	units := map[string]float64{}
+	for _, op := range ops {
+		units[op.table.name] += 2 * writeUnits(op.old, op.updated)
+		switch {
+		case !op.write:
+		case op.updated == nil:
+			delete(op.table.items, op.key)
+		default:
+			op.table.items[op.key] = op.updated
+		}
+	}
+
+	return &transactWriteItemsOutput{ConsumedCapacity: capacities(in.ReturnConsumedCapacity, units)}, nil
+}
+
+func (s *Store) prepareTransactOp(item transactWriteItem) (transactOp, error) {
+	var (
+		tableName, conditionExpr, returnValues string
+		fields                                 expressionFields
+		key                                    map[string]types.AttributeValue
+	)
+
+	switch {
+	case item.ConditionCheck != nil:
+		c := item.ConditionCheck
+		tableName, key, conditionExpr, fields, returnValues = c.TableName, c.Key, c.ConditionExpression, c.expressionFields, c.ReturnValuesOnConditionCheckFailure
+	case item.Delete != nil:
+		c := item.Delete
+		tableName, key, conditionExpr, fields, returnValues = c.TableName, c.Key, c.ConditionExpression, c.expressionFields, c.ReturnValuesOnConditionCheckFailure
+	case item.Put != nil:
+		p := item.Put
+		tableName, key, conditionExpr, fields, returnValues = p.TableName, p.Item, p.ConditionExpression, p.expressionFields, p.ReturnValuesOnConditionCheckFailure
+	case item.Update != nil:
+		u := item.Update
+		tableName, key, conditionExpr, fields, returnValues = u.TableName, u.Key, u.ConditionExpression, u.expressionFields, u.ReturnValuesOnConditionCheckFailure
+	default:
+		return transactOp{}, validationError("TransactItems must contain one of ConditionCheck, Put, Delete or Update")
+	}
+
+	t, err := s.table(tableName)
+	if err != nil {
+		return transactOp{}, err
+	}
+
+	op := transactOp{table: t, reason: cancellationReason{Code: "None"}}
+
+	if item.Put != nil {
+		if err := t.validateItem(key); err != nil {
+			return transactOp{}, err
+		}
+	} else if err := t.validateKey(key); err != nil {
+		return transactOp{}, err
+	}
+
+	op.key = t.itemKey(key)
+	op.old = t.items[op.key]
+
+	ok, err := evalCondition(conditionExpr, fields, op.old)
+	if err != nil {
+		return transactOp{}, err
+	}
+	if !ok {
+		op.failed = true
+		op.reason = cancellationReason{Code: "ConditionalCheckFailed", Message: "The conditional request failed"}
+		if types.ReturnValuesOnConditionCheckFailure(returnValues) == types.ReturnValuesOnConditionCheckFailureAllOld {
+			op.reason.Item = cloneItem(op.old)
+		}
+		return op, nil
+	}
+
+	switch {
+	case item.Put != nil:
+		op.write, op.updated = true, cloneItem(key)
+	case item.Delete != nil:
+		op.write = true
+	case item.Update != nil:
+		// the condition was already checked above
+		_, updated, _, err := t.prepareUpdate(key, item.Update.UpdateExpression, "", fields)
+		if err != nil {
+			return transactOp{}, err
+		}
+		op.write, op.updated = true, updated
+	}
+
+	return op, nil
+}
+
+func (s *Store) batchGetItem(in *batchGetItemInput) (*batchGetItemOutput, error) {
+	out := &batchGetItemOutput{
+		Responses:       map[string][]avjson.Item{},
+		UnprocessedKeys: map[string]keysAndAttributes{},
+	}
+
+	count := 0
+	units := map[string]float64{}
+	for tableName, req := range in.RequestItems {
+		t, err := s.table(tableName)
+		if err != nil {
+			return nil, err
+		}
+
+		paths, err := parseOptionalProjection(req.ProjectionExpression, req.ExpressionAttributeNames)
+		if err != nil {
+			return nil, err
+		}
+
+		out.Responses[tableName] = []avjson.Item{}
+		for _, key := range req.Keys {
+			if count++; count > maxBatchGetKeys {
+				return nil, validationError(fmt.Sprintf("Too many items requested for the BatchGetItem call, maximum %d", maxBatchGetKeys))
+			}
+			if err := t.validateKey(key); err != nil {
+				return nil, err
+			}
+			item, ok := t.items[t.itemKey(key)]
+			units[tableName] += readUnits(itemsize.Of(item), req.ConsistentRead)
+			if ok {
+				out.Responses[tableName] = append(out.Responses[tableName], cloneItem(project(item, paths)))
+			}
+		}
+	}
+
+	out.ConsumedCapacity = capacities(in.ReturnConsumedCapacity, units)
+	return out, nil
+}
+
+func (s *Store) batchWriteItem(in *batchWriteItemInput) (*batchWriteItemOutput, error) {
+	count := 0
+	for tableName, requests := range in.RequestItems {
+		t, err := s.table(tableName)
+		if err != nil {
+			return nil, err
+		}
+		for _, req := range requests {
+			if count++; count > maxBatchWrites {
+				return nil, validationError(fmt.Sprintf("Too many items requested for the BatchWriteItem call, maximum %d", maxBatchWrites))
+			}
+			switch {
+			case req.PutRequest != nil:
+				if err := t.validateItem(req.PutRequest.Item); err != nil {
+					return nil, err
+				}
+			case req.DeleteRequest != nil:
+				if err := t.validateKey(req.DeleteRequest.Key); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, validationError("WriteRequest must contain a PutRequest or DeleteRequest")
+			}
+		}
+	}
+
+	// all requests are validated before any are applied
+	units := map[string]float64{}
+	for tableName, requests := range in.RequestItems {
+		t := s.tables[tableName]
+		for _, req := range requests {
+			if req.PutRequest != nil {
+				k := t.itemKey(req.PutRequest.Item)
+				units[tableName] += writeUnits(t.items[k], req.PutRequest.Item)
+				t.items[k] = cloneItem(req.PutRequest.Item)
+			} else {
+				k := t.itemKey(req.DeleteRequest.Key)
+				units[tableName] += writeUnits(t.items[k], nil)
+				delete(t.items, k)
+			}
+		}
+	}
+
+	return &batchWriteItemOutput{
+		UnprocessedItems: map[string][]writeRequest{},
+		ConsumedCapacity: capacities(in.ReturnConsumedCapacity, units),
+	}, nil
+}
@@ -0,0 +1,276 @@
+package ddblocal
+
+import (
+	"github.com/danielwchapman/ddb/internal/avjson"
+)
+
+// The request and response shapes of the DynamoDB JSON protocol. Only the fields supported by Store are
+// declared; unknown request fields are ignored.
+
+type expressionFields struct {
+	ExpressionAttributeNames  map[string]string
+	ExpressionAttributeValues avjson.Item
+}
+
+type keySchemaElement struct {
+	AttributeName string
+	KeyType       string
+}
+
+type attributeDefinition struct {
+	AttributeName string
+	AttributeType string
+}
+
+type projection struct {
+	ProjectionType   string   `json:",omitempty"`
+	NonKeyAttributes []string `json:",omitempty"`
+}
+
+type provisionedThroughput struct {
+	ReadCapacityUnits  int64
+	WriteCapacityUnits int64
+}
+
+type secondaryIndex struct {
+	IndexName             string
+	KeySchema             []keySchemaElement
+	Projection            *projection            `json:",omitempty"`
+	ProvisionedThroughput *provisionedThroughput `json:",omitempty"`
+}
+
+type createTableInput struct {
+	TableName              string
+	AttributeDefinitions   []attributeDefinition
+	KeySchema              []keySchemaElement
+	BillingMode            string
+	ProvisionedThroughput  *provisionedThroughput
+	GlobalSecondaryIndexes []secondaryIndex
+	LocalSecondaryIndexes  []secondaryIndex
+}
+
+type tableNameInput struct {
+	TableName string
+}
+
+type globalSecondaryIndexUpdate struct {
+	Create *secondaryIndex
+	Delete *struct{ IndexName string }
+}
+
+type updateTableInput struct {
+	TableName                   string
+	AttributeDefinitions        []attributeDefinition
+	BillingMode                 string
+	ProvisionedThroughput       *provisionedThroughput
+	GlobalSecondaryIndexUpdates []globalSecondaryIndexUpdate
+}
+
+type indexDescription struct {
+	IndexName             string
+	KeySchema             []keySchemaElement
+	Projection            *projection            `json:",omitempty"`
+	IndexStatus           string                 `json:",omitempty"`
+	ProvisionedThroughput *provisionedThroughput `json:",omitempty"`
+	ItemCount             int64
+}
+
+type billingModeSummary struct {
+	BillingMode string
+}
+
+type tableDescription struct {
+	TableName              string
+	TableArn               string
+	TableStatus            string
+	CreationDateTime       float64
+	AttributeDefinitions   []attributeDefinition
+	KeySchema              []keySchemaElement
+	BillingModeSummary     *billingModeSummary    `json:",omitempty"`
+	ProvisionedThroughput  *provisionedThroughput `json:",omitempty"`
+	GlobalSecondaryIndexes []indexDescription     `json:",omitempty"`
+	LocalSecondaryIndexes  []indexDescription     `json:",omitempty"`
+	ItemCount              int64
+}
+
+type tableDescriptionOutput struct {
+	TableDescription tableDescription
+}
+
+type describeTableOutput struct {
+	Table tableDescription
+}
+
+type listTablesOutput struct {
+	TableNames []string
+}
+
+type timeToLiveSpecification struct {
+	AttributeName string
+	Enabled       bool
+}
+
+type updateTimeToLiveInput struct {
+	TableName               string
+	TimeToLiveSpecification timeToLiveSpecification
+}
+
+type updateTimeToLiveOutput struct {
+	TimeToLiveSpecification timeToLiveSpecification
+}
+
+type timeToLiveDescription struct {
+	AttributeName    string `json:",omitempty"`
+	TimeToLiveStatus string
+}
+
+type describeTimeToLiveOutput struct {
+	TimeToLiveDescription timeToLiveDescription
+}
+
+type getItemInput struct {
+	TableName                string
+	Key                      avjson.Item
+	ProjectionExpression     string
+	ExpressionAttributeNames map[string]string
+	ConsistentRead           bool
+	ReturnConsumedCapacity   string
+}
+
+type getItemOutput struct {
+	Item             avjson.Item       `json:",omitempty"`
+	ConsumedCapacity *consumedCapacity `json:",omitempty"`
+}
+
+type putItemInput struct {
+	expressionFields
+	TableName              string
+	Item                   avjson.Item
+	ConditionExpression    string
+	ReturnValues           string
+	ReturnConsumedCapacity string
+}
+
+type deleteItemInput struct {
+	expressionFields
+	TableName              string
+	Key                    avjson.Item
+	ConditionExpression    string
+	ReturnValues           string
+	ReturnConsumedCapacity string
+}
+
+type updateItemInput struct {
+	expressionFields
+	TableName              string
+	Key                    avjson.Item
+	ConditionExpression    string
+	UpdateExpression       string
+	ReturnValues           string
+	ReturnConsumedCapacity string
+}
+
+type attributesOutput struct {
+	Attributes       avjson.Item       `json:",omitempty"`
+	ConsumedCapacity *consumedCapacity `json:",omitempty"`
+}
+
+type queryInput struct {
+	expressionFields
+	TableName              string
+	IndexName              string
+	KeyConditionExpression string
+	FilterExpression       string
+	ProjectionExpression   string
+	ExclusiveStartKey      avjson.Item
+	Limit                  int
+	ScanIndexForward       *bool
+	ConsistentRead         bool
+	Select                 string
+	ReturnConsumedCapacity string
+
+	// Scan only
+	Segment       int
+	TotalSegments int
+}
+
+type queryOutput struct {
+	Items            []avjson.Item
+	Count            int
+	ScannedCount     int
+	LastEvaluatedKey avjson.Item       `json:",omitempty"`
+	ConsumedCapacity *consumedCapacity `json:",omitempty"`
+}
+
+type transactWriteItem struct {
+	ConditionCheck *transactCondition
+	Put            *transactPut
+	Delete         *transactCondition
+	Update         *transactUpdate
+}
+
+type transactCondition struct {
+	expressionFields
+	TableName                           string
+	Key                                 avjson.Item
+	ConditionExpression                 string
+	ReturnValuesOnConditionCheckFailure string
+}
+
+type transactPut struct {
+	expressionFields
+	TableName                           string
+	Item                                avjson.Item
+	ConditionExpression                 string
+	ReturnValuesOnConditionCheckFailure string
+}
+
+type transactUpdate struct {
+	transactCondition
+	UpdateExpression string
+}
+
+type transactWriteItemsInput struct {
+	TransactItems          []transactWriteItem
+	ClientRequestToken     string
+	ReturnConsumedCapacity string
+}
+
+type transactWriteItemsOutput struct {
+	ConsumedCapacity []consumedCapacity `json:",omitempty"`
+}
+
+type keysAndAttributes struct {
+	Keys                     []avjson.Item
+	ProjectionExpression     string
+	ExpressionAttributeNames map[string]string
+	ConsistentRead           bool
+}
+
+type batchGetItemInput struct {
+	RequestItems           map[string]keysAndAttributes
+	ReturnConsumedCapacity string
+}
+
+type batchGetItemOutput struct {
+	Responses        map[string][]avjson.Item
+	UnprocessedKeys  map[string]keysAndAttributes
+	ConsumedCapacity []consumedCapacity `json:",omitempty"`
+}
+
+type writeRequest struct {
+	PutRequest    *struct{ Item avjson.Item } `json:",omitempty"`
+	DeleteRequest *struct{ Key avjson.Item }  `json:",omitempty"`
+}
+
+type batchWriteItemInput struct {
+	RequestItems           map[string][]writeRequest
+	ReturnConsumedCapacity string
+}
+
+type batchWriteItemOutput struct {
+	UnprocessedItems map[string][]writeRequest
+	ConsumedCapacity []consumedCapacity `json:",omitempty"`
+}
+
+type empty struct{}
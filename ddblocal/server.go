@@ -0,0 +1,144 @@
+// Package ddblocal serves a DynamoDB compatible HTTP endpoint backed by an in-process, in-memory Store. It
+// implements enough of the DynamoDB JSON protocol for tests to point a stock dynamodb.Client at it:
+// GetItem, PutItem, UpdateItem, DeleteItem, Query, Scan, TransactWriteItems, BatchGetItem, BatchWriteItem
+// and the table operations CreateTable, DescribeTable, UpdateTable, DeleteTable, ListTables,
+// UpdateTimeToLive and DescribeTimeToLive. Item operations report ConsumedCapacity when asked to.
+package ddblocal
+
+import (
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+const targetPrefix = "DynamoDB_20120810."
+
+type operation func(s *Store, body []byte) (any, error)
+
+// handle adapts a typed Store method to an operation.
+func handle[In, Out any](fn func(*Store, *In) (*Out, error)) operation {
+	return func(s *Store, body []byte) (any, error) {
+		var in In
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &in); err != nil {
+				return nil, &apiError{code: "SerializationException", message: err.Error(), status: http.StatusBadRequest}
+			}
+		}
+		return fn(s, &in)
+	}
+}
+
+var operations = map[string]operation{
+	"BatchGetItem":       handle((*Store).batchGetItem),
+	"BatchWriteItem":     handle((*Store).batchWriteItem),
+	"CreateTable":        handle((*Store).createTable),
+	"DeleteItem":         handle((*Store).deleteItem),
+	"DeleteTable":        handle((*Store).deleteTable),
+	"DescribeTable":      handle((*Store).describeTable),
+	"DescribeTimeToLive": handle((*Store).describeTimeToLive),
+	"GetItem":            handle((*Store).getItem),
+	"ListTables":         handle((*Store).listTables),
+	"PutItem":            handle((*Store).putItem),
+	"Query":              handle((*Store).query),
+	"Scan":               handle((*Store).scan),
+	"TransactWriteItems": handle((*Store).transactWriteItems),
+	"UpdateItem":         handle((*Store).updateItem),
+	"UpdateTable":        handle((*Store).updateTable),
+	"UpdateTimeToLive":   handle((*Store).updateTimeToLive),
+}
+
+// ServeHTTP implements the DynamoDB JSON protocol. Requests are not authenticated.
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.Header.Get("X-Amz-Target")
+	name := strings.TrimPrefix(target, targetPrefix)
+	op, ok := operations[name]
+	if !ok {
+		writeError(w, unknownOperation(target))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, &apiError{code: "SerializationException", message: err.Error(), status: http.StatusBadRequest})
+		return
+	}
+
+	var out any
+	s.mu.Lock()
+	if s.throttle > 0 && dataOperations[name] {
+		s.throttle--
+		err = throughputExceeded()
+	} else {
+		out, err = op(s, body)
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		apiErr = &apiError{code: "InternalServerError", message: err.Error(), status: http.StatusInternalServerError}
+	}
+	w.Header().Set("X-Amzn-ErrorType", apiErr.code)
+	writeJSON(w, apiErr.status, apiErr.body())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		body = []byte(`{"__type":"` + errorTypePrefix + `InternalServerError","message":"failed to encode response"}`)
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.Header().Set("X-Amz-Crc32", strconv.FormatUint(uint64(crc32.ChecksumIEEE(body)), 10))
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// Server is an httptest.Server serving a Store.
+type Server struct {
+	*httptest.Server
+	Store *Store
+}
+
+// NewServer starts a Server with an empty Store. Callers must Close it.
+func NewServer() *Server {
+	store := NewStore()
+	return &Server{
+		Server: httptest.NewServer(store),
+		Store:  store,
+	}
+}
+
+// Config returns an aws.Config with static credentials for clients that are pointed at the Server's URL.
+func (s *Server) Config() aws.Config {
+	return aws.Config{
+		Region:      "local",
+		Credentials: credentials.NewStaticCredentialsProvider("local", "local", ""),
+	}
+}
+
+// DynamoDB returns a dynamodb.Client that sends every request to the Server.
+func (s *Server) DynamoDB(optFns ...func(*dynamodb.Options)) *dynamodb.Client {
+	return dynamodb.NewFromConfig(s.Config(), append([]func(*dynamodb.Options){
+		func(o *dynamodb.Options) {
+			o.BaseEndpoint = aws.String(s.URL)
+		},
+	}, optFns...)...)
+}
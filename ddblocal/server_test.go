@@ -0,0 +1,300 @@
+package ddblocal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/danielwchapman/ddb/internal/avjson"
+)
+
+func newTestTable(t *testing.T) (*dynamodb.Client, string) {
+	t.Helper()
+	_, client, table := newTestServer(t)
+	return client, table
+}
+
+func newTestServer(t *testing.T) (*Server, *dynamodb.Client, string) {
+	t.Helper()
+
+	server := NewServer()
+	t.Cleanup(server.Close)
+
+	client := server.DynamoDB()
+	table := "Test"
+
+	_, err := client.CreateTable(context.Background(), &dynamodb.CreateTableInput{
+		TableName: &table,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("PK"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("SK"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("GSI1PK"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("GSI1SK"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("PK"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("SK"), KeyType: types.KeyTypeRange},
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{{
+			IndexName: aws.String("GSI1"),
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("GSI1PK"), KeyType: types.KeyTypeHash},
+				{AttributeName: aws.String("GSI1SK"), KeyType: types.KeyTypeRange},
+			},
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		}},
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return server, client, table
+}
+
+func s(v string) types.AttributeValue {
+	return &types.AttributeValueMemberS{Value: v}
+}
+
+func n(v string) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: v}
+}
+
+func itemJSON(t *testing.T, item map[string]types.AttributeValue) string {
+	t.Helper()
+	b, err := avjson.MarshalItem(item)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return string(b)
+}
+
+func TestUpdateExpressions(t *testing.T) {
+	t.Parallel()
+
+	client, table := newTestTable(t)
+	ctx := context.Background()
+	key := map[string]types.AttributeValue{"PK": s("A"), "SK": s("1")}
+
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: &table,
+		Item: map[string]types.AttributeValue{
+			"PK":    s("A"),
+			"SK":    s("1"),
+			"Count": n("1.5"),
+			"Tags":  &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+			"Doc":   &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{"x": s("1")}},
+			"Gone":  s("bye"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        &table,
+		Key:              key,
+		UpdateExpression: aws.String("SET #c = #c + :one, Doc.y = if_not_exists(Doc.y, :v) REMOVE Gone ADD Tags :t DELETE Tags :a"),
+		ExpressionAttributeNames: map[string]string{
+			"#c": "Count",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one": n("1"),
+			":v":   s("2"),
+			":t":   &types.AttributeValueMemberSS{Value: []string{"c"}},
+			":a":   &types.AttributeValueMemberSS{Value: []string{"a"}},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]types.AttributeValue{
+		"PK":    s("A"),
+		"SK":    s("1"),
+		"Count": n("2.5"),
+		"Tags":  &types.AttributeValueMemberSS{Value: []string{"b", "c"}},
+		"Doc":   &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{"x": s("1"), "y": s("2")}},
+	}
+
+	if diff := cmp.Diff(itemJSON(t, want), itemJSON(t, out.Attributes)); diff != "" {
+		t.Errorf("unexpected diff: %s", diff)
+	}
+}
+
+func TestTransactWriteItemsCanceled(t *testing.T) {
+	t.Parallel()
+
+	client, table := newTestTable(t)
+	ctx := context.Background()
+
+	_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{TableName: &table, Item: map[string]types.AttributeValue{"PK": s("A"), "SK": s("1")}}},
+			{Put: &types.Put{
+				TableName:           &table,
+				Item:                map[string]types.AttributeValue{"PK": s("A"), "SK": s("2")},
+				ConditionExpression: aws.String("attribute_exists(PK)"),
+			}},
+		},
+	})
+
+	var canceledErr *types.TransactionCanceledException
+	if !errors.As(err, &canceledErr) {
+		t.Fatalf("expected TransactionCanceledException, got: %v", err)
+	}
+
+	var codes []string
+	for _, reason := range canceledErr.CancellationReasons {
+		codes = append(codes, aws.ToString(reason.Code))
+	}
+	if diff := cmp.Diff([]string{"None", "ConditionalCheckFailed"}, codes); diff != "" {
+		t.Errorf("unexpected diff: %s", diff)
+	}
+
+	// nothing is written when a transaction is canceled
+	got, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &table,
+		Key:       map[string]types.AttributeValue{"PK": s("A"), "SK": s("1")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Item) != 0 {
+		t.Errorf("expected no item, got: %v", got.Item)
+	}
+}
+
+func TestSparseIndexAndScan(t *testing.T) {
+	t.Parallel()
+
+	client, table := newTestTable(t)
+	ctx := context.Background()
+
+	var writes []types.WriteRequest
+	for _, sk := range []string{"1", "2", "3"} {
+		item := map[string]types.AttributeValue{"PK": s("A"), "SK": s(sk)}
+		if sk != "2" {
+			item["GSI1PK"] = s("G")
+			item["GSI1SK"] = s(sk)
+		}
+		writes = append(writes, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+
+	if _, err := client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]types.WriteRequest{table: writes},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	query, err := client.Query(ctx, &dynamodb.QueryInput{
+		TableName:                 &table,
+		IndexName:                 aws.String("GSI1"),
+		KeyConditionExpression:    aws.String("GSI1PK = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": s("G")},
+		ScanIndexForward:          aws.Bool(false),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if query.Count != 2 {
+		t.Errorf("expected 2 items in the sparse index, got: %d", query.Count)
+	}
+
+	scan, err := client.Scan(ctx, &dynamodb.ScanInput{TableName: &table, Limit: aws.Int32(2)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if scan.Count != 2 || len(scan.LastEvaluatedKey) == 0 {
+		t.Errorf("expected a page of 2 items, got: %d, %v", scan.Count, scan.LastEvaluatedKey)
+	}
+
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: &table,
+		Item:      map[string]types.AttributeValue{"PK": s("A"), "SK": s("4"), "GSI1PK": s("")},
+	})
+	if err == nil {
+		t.Errorf("expected empty index key to be rejected")
+	}
+}
+
+func TestConsumedCapacity(t *testing.T) {
+	t.Parallel()
+
+	client, table := newTestTable(t)
+	ctx := context.Background()
+
+	item := map[string]types.AttributeValue{"PK": s("A"), "SK": s("1"), "Data": s(strings.Repeat("x", 2000))}
+	put, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: &table, Item: item, ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := aws.ToFloat64(put.ConsumedCapacity.CapacityUnits); got != 2 {
+		t.Errorf("expected 2 write units, got: %v", got)
+	}
+
+	key := map[string]types.AttributeValue{"PK": s("A"), "SK": s("1")}
+	get, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &table, Key: key, ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := aws.ToFloat64(get.ConsumedCapacity.CapacityUnits); got != 0.5 {
+		t.Errorf("expected 0.5 read units, got: %v", got)
+	}
+
+	tx, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems:          []types.TransactWriteItem{{Delete: &types.Delete{TableName: &table, Key: key}}},
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tx.ConsumedCapacity) != 1 || aws.ToFloat64(tx.ConsumedCapacity[0].CapacityUnits) != 4 {
+		t.Errorf("expected 4 write units, got: %+v", tx.ConsumedCapacity)
+	}
+
+	// not returned unless requested
+	query, err := client.Query(ctx, &dynamodb.QueryInput{
+		TableName:                 &table,
+		KeyConditionExpression:    aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": s("A")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if query.ConsumedCapacity != nil {
+		t.Errorf("expected no consumed capacity, got: %+v", query.ConsumedCapacity)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	t.Parallel()
+
+	server, client, table := newTestServer(t)
+	ctx := context.Background()
+
+	server.Store.Throttle(1)
+	key := map[string]types.AttributeValue{"PK": s("A"), "SK": s("1")}
+	_, err := client.GetItem(ctx, &dynamodb.GetItemInput{TableName: &table, Key: key}, func(o *dynamodb.Options) {
+		o.RetryMaxAttempts = 1
+	})
+	var throttled *types.ProvisionedThroughputExceededException
+	if !errors.As(err, &throttled) {
+		t.Errorf("expected ProvisionedThroughputExceededException, got: %v", err)
+	}
+
+	if _, err := client.GetItem(ctx, &dynamodb.GetItemInput{TableName: &table, Key: key}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
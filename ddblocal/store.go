@@ -0,0 +1,239 @@
+package ddblocal
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Store is an in-process, in-memory set of DynamoDB tables. It is safe for concurrent use. Every operation
+// is strongly consistent and index projections are always treated as ALL.
+type Store struct {
+	mu     sync.Mutex
+	tables map[string]*table
+
+	// throttle is how many more item operations fail, see Throttle.
+	throttle int
+}
+
+func NewStore() *Store {
+	return &Store{tables: map[string]*table{}}
+}
+
+// index is the key schema of a table or one of its secondary indexes.
+type index struct {
+	name       string
+	hashKey    string
+	rangeKey   string
+	local      bool
+	projection *projection
+	throughput *provisionedThroughput
+}
+
+type table struct {
+	name       string
+	created    time.Time
+	key        index
+	attrTypes  map[string]string
+	gsis       []index
+	lsis       []index
+	billing    string
+	throughput *provisionedThroughput
+	items      map[string]map[string]types.AttributeValue
+
+	// ttlAttribute is the Time to Live attribute, empty if TTL is disabled. Expired items are never deleted,
+	// which is allowed by the lazy deletion of DynamoDB.
+	ttlAttribute string
+}
+
+func (s *Store) table(name string) (*table, error) {
+	t, ok := s.tables[name]
+	if !ok {
+		return nil, resourceNotFound("Requested resource not found: Table: " + name + " not found")
+	}
+	return t, nil
+}
+
+func (t *table) index(name string) (index, error) {
+	if name == "" {
+		return t.key, nil
+	}
+	for _, i := range append(append([]index{}, t.gsis...), t.lsis...) {
+		if i.name == name {
+			return i, nil
+		}
+	}
+	return index{}, validationError("The table does not have the specified index: " + name)
+}
+
+// itemKey identifies an item by its primary key.
+func (t *table) itemKey(item map[string]types.AttributeValue) string {
+	return fmt.Sprintf("%s\x00%s", keyString(item[t.key.hashKey]), keyString(item[t.key.rangeKey]))
+}
+
+func keyString(v types.AttributeValue) string {
+	switch v := v.(type) {
+	case *types.AttributeValueMemberS:
+		return "S" + v.Value
+	case *types.AttributeValueMemberN:
+		if r, ok := parseNumber(v.Value); ok {
+			return "N" + r.RatString()
+		}
+		return "N" + v.Value
+	case *types.AttributeValueMemberB:
+		return "B" + string(v.Value)
+	default:
+		return ""
+	}
+}
+
+// validateKey checks that key holds exactly the primary key attributes with the declared types.
+func (t *table) validateKey(key map[string]types.AttributeValue) error {
+	expected := 1
+	if t.key.rangeKey != "" {
+		expected = 2
+	}
+	if len(key) != expected {
+		return validationError("The provided key element does not match the schema")
+	}
+	return t.validateKeyAttributes(key, t.key, true)
+}
+
+// validateItem checks the primary key and any secondary index key attributes of an item.
+func (t *table) validateItem(item map[string]types.AttributeValue) error {
+	if err := t.validateKeyAttributes(item, t.key, true); err != nil {
+		return err
+	}
+	for _, i := range append(append([]index{}, t.gsis...), t.lsis...) {
+		if err := t.validateKeyAttributes(item, i, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *table) validateKeyAttributes(item map[string]types.AttributeValue, i index, required bool) error {
+	for _, name := range []string{i.hashKey, i.rangeKey} {
+		if name == "" {
+			continue
+		}
+		v, ok := item[name]
+		if !ok {
+			if required {
+				return validationError("One or more parameter values were invalid: Missing the key " + name + " in the item")
+			}
+			continue
+		}
+		if typeName(v) != t.attrTypes[name] {
+			return validationError(fmt.Sprintf(
+				"One or more parameter values were invalid: Type mismatch for key %s expected: %s actual: %s",
+				name, t.attrTypes[name], typeName(v),
+			))
+		}
+		if isEmptyKey(v) {
+			if required {
+				return validationError("One or more parameter values are not valid. The AttributeValue for a key attribute cannot contain an empty string value. Key: " + name)
+			}
+			return validationError(fmt.Sprintf(
+				"One or more parameter values are not valid. A value specified for a secondary index key is not supported. The AttributeValue for a key attribute cannot contain an empty string value. IndexName: %s, IndexKey: %s",
+				i.name, name,
+			))
+		}
+	}
+	return nil
+}
+
+// keyOf extracts the primary key attributes of an item.
+func (t *table) keyOf(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	key := map[string]types.AttributeValue{t.key.hashKey: item[t.key.hashKey]}
+	if t.key.rangeKey != "" {
+		key[t.key.rangeKey] = item[t.key.rangeKey]
+	}
+	return key
+}
+
+// indexKeyOf extracts the primary key and index key attributes of an item, as used in LastEvaluatedKey.
+func (t *table) indexKeyOf(item map[string]types.AttributeValue, i index) map[string]types.AttributeValue {
+	key := t.keyOf(item)
+	for _, name := range []string{i.hashKey, i.rangeKey} {
+		if v, ok := item[name]; ok && name != "" {
+			key[name] = v
+		}
+	}
+	return key
+}
+
+// inIndex reports whether an item has all key attributes of an index. Indexes are sparse.
+func inIndex(item map[string]types.AttributeValue, i index) bool {
+	if _, ok := item[i.hashKey]; !ok {
+		return false
+	}
+	if i.rangeKey == "" {
+		return true
+	}
+	_, ok := item[i.rangeKey]
+	return ok
+}
+
+// sortedItems returns the items in an index ordered by hash key, then range key, then primary key.
+func (t *table) sortedItems(i index) []map[string]types.AttributeValue {
+	out := make([]map[string]types.AttributeValue, 0, len(t.items))
+	for _, item := range t.items {
+		if inIndex(item, i) {
+			out = append(out, item)
+		}
+	}
+	sort.Slice(out, func(a, b int) bool {
+		return t.compareInIndex(out[a], out[b], i) < 0
+	})
+	return out
+}
+
+func (t *table) compareInIndex(a, b map[string]types.AttributeValue, i index) int {
+	for _, name := range []string{i.hashKey, i.rangeKey, t.key.hashKey, t.key.rangeKey} {
+		if name == "" {
+			continue
+		}
+		if cmp := compareKeyValues(a[name], b[name]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+func compareKeyValues(a, b types.AttributeValue) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+	cmp, _ := compareValues(a, b)
+	return cmp
+}
+
+// segmentOf assigns an item to a parallel scan segment by its hash key.
+func (t *table) segmentOf(item map[string]types.AttributeValue, totalSegments int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(keyString(item[t.key.hashKey])))
+	return int(h.Sum32() % uint32(totalSegments))
+}
+
+func isEmptyKey(v types.AttributeValue) bool {
+	switch v := v.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value == ""
+	case *types.AttributeValueMemberB:
+		return len(v.Value) == 0
+	default:
+		return false
+	}
+}
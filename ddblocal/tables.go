@@ -0,0 +1,266 @@
+package ddblocal
+
+import (
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func (s *Store) createTable(in *createTableInput) (*tableDescriptionOutput, error) {
+	if in.TableName == "" {
+		return nil, validationError("TableName is required")
+	}
+	if _, ok := s.tables[in.TableName]; ok {
+		return nil, resourceInUse("Table already exists: " + in.TableName)
+	}
+
+	t := &table{
+		name:       in.TableName,
+		created:    time.Now(),
+		attrTypes:  map[string]string{},
+		billing:    in.BillingMode,
+		throughput: in.ProvisionedThroughput,
+		items:      map[string]map[string]types.AttributeValue{},
+	}
+
+	if t.billing == "" {
+		t.billing = string(types.BillingModeProvisioned)
+	}
+
+	for _, def := range in.AttributeDefinitions {
+		t.attrTypes[def.AttributeName] = def.AttributeType
+	}
+
+	key, err := t.makeIndex("", in.KeySchema)
+	if err != nil {
+		return nil, err
+	}
+	t.key = key
+
+	for _, gsi := range in.GlobalSecondaryIndexes {
+		i, err := t.makeIndex(gsi.IndexName, gsi.KeySchema)
+		if err != nil {
+			return nil, err
+		}
+		i.projection = gsi.Projection
+		i.throughput = gsi.ProvisionedThroughput
+		t.gsis = append(t.gsis, i)
+	}
+
+	for _, lsi := range in.LocalSecondaryIndexes {
+		i, err := t.makeIndex(lsi.IndexName, lsi.KeySchema)
+		if err != nil {
+			return nil, err
+		}
+		if i.hashKey != t.key.hashKey {
+			return nil, validationError("Local secondary indexes must have the same hash key as the table")
+		}
+		i.local = true
+		i.projection = lsi.Projection
+		t.lsis = append(t.lsis, i)
+	}
+
+	s.tables[t.name] = t
+
+	return &tableDescriptionOutput{TableDescription: t.describe()}, nil
+}
+
+func (t *table) makeIndex(name string, schema []keySchemaElement) (index, error) {
+	i := index{name: name}
+	for _, e := range schema {
+		if _, ok := t.attrTypes[e.AttributeName]; !ok {
+			return index{}, validationError("Key attribute " + e.AttributeName + " is not defined in AttributeDefinitions")
+		}
+		switch types.KeyType(e.KeyType) {
+		case types.KeyTypeHash:
+			i.hashKey = e.AttributeName
+		case types.KeyTypeRange:
+			i.rangeKey = e.AttributeName
+		}
+	}
+	if i.hashKey == "" {
+		return index{}, validationError("KeySchema must contain a HASH key")
+	}
+	return i, nil
+}
+
+func (s *Store) describeTable(in *tableNameInput) (*describeTableOutput, error) {
+	t, err := s.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return &describeTableOutput{Table: t.describe()}, nil
+}
+
+func (s *Store) deleteTable(in *tableNameInput) (*tableDescriptionOutput, error) {
+	t, err := s.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+	delete(s.tables, in.TableName)
+
+	desc := t.describe()
+	desc.TableStatus = string(types.TableStatusDeleting)
+	return &tableDescriptionOutput{TableDescription: desc}, nil
+}
+
+func (s *Store) listTables(*empty) (*listTablesOutput, error) {
+	out := &listTablesOutput{TableNames: []string{}}
+	for name := range s.tables {
+		out.TableNames = append(out.TableNames, name)
+	}
+	sort.Strings(out.TableNames)
+	return out, nil
+}
+
+// updateTable supports changing billing and throughput, and creating or deleting GSIs. New GSIs are ACTIVE
+// immediately.
+func (s *Store) updateTable(in *updateTableInput) (*tableDescriptionOutput, error) {
+	t, err := s.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, def := range in.AttributeDefinitions {
+		t.attrTypes[def.AttributeName] = def.AttributeType
+	}
+
+	if in.BillingMode != "" {
+		t.billing = in.BillingMode
+	}
+	if in.ProvisionedThroughput != nil {
+		t.throughput = in.ProvisionedThroughput
+	}
+
+	for _, update := range in.GlobalSecondaryIndexUpdates {
+		switch {
+		case update.Create != nil:
+			if _, err := t.index(update.Create.IndexName); err == nil {
+				return nil, validationError("Index already exists: " + update.Create.IndexName)
+			}
+			i, err := t.makeIndex(update.Create.IndexName, update.Create.KeySchema)
+			if err != nil {
+				return nil, err
+			}
+			i.projection = update.Create.Projection
+			i.throughput = update.Create.ProvisionedThroughput
+			t.gsis = append(t.gsis, i)
+		case update.Delete != nil:
+			found := false
+			for j := range t.gsis {
+				if t.gsis[j].name == update.Delete.IndexName {
+					t.gsis = append(t.gsis[:j], t.gsis[j+1:]...)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, resourceNotFound("Requested resource not found: Index: " + update.Delete.IndexName)
+			}
+		}
+	}
+
+	return &tableDescriptionOutput{TableDescription: t.describe()}, nil
+}
+
+func (t *table) describe() tableDescription {
+	desc := tableDescription{
+		TableName:             t.name,
+		TableArn:              "arn:aws:dynamodb:local:000000000000:table/" + t.name,
+		TableStatus:           string(types.TableStatusActive),
+		CreationDateTime:      float64(t.created.UnixNano()) / float64(time.Second),
+		KeySchema:             t.key.keySchema(),
+		BillingModeSummary:    &billingModeSummary{BillingMode: t.billing},
+		ProvisionedThroughput: t.throughput,
+		ItemCount:             int64(len(t.items)),
+	}
+
+	names := map[string]struct{}{}
+	for _, i := range append(append([]index{t.key}, t.gsis...), t.lsis...) {
+		for _, name := range []string{i.hashKey, i.rangeKey} {
+			if _, ok := names[name]; ok || name == "" {
+				continue
+			}
+			names[name] = struct{}{}
+			desc.AttributeDefinitions = append(desc.AttributeDefinitions, attributeDefinition{
+				AttributeName: name,
+				AttributeType: t.attrTypes[name],
+			})
+		}
+	}
+
+	for _, i := range t.gsis {
+		desc.GlobalSecondaryIndexes = append(desc.GlobalSecondaryIndexes, t.describeIndex(i))
+	}
+	for _, i := range t.lsis {
+		desc.LocalSecondaryIndexes = append(desc.LocalSecondaryIndexes, t.describeIndex(i))
+	}
+
+	return desc
+}
+
+func (t *table) describeIndex(i index) indexDescription {
+	desc := indexDescription{
+		IndexName:             i.name,
+		KeySchema:             i.keySchema(),
+		Projection:            i.projection,
+		ProvisionedThroughput: i.throughput,
+	}
+	if !i.local {
+		desc.IndexStatus = string(types.IndexStatusActive)
+	}
+	for _, item := range t.items {
+		if inIndex(item, i) {
+			desc.ItemCount++
+		}
+	}
+	return desc
+}
+
+func (i index) keySchema() []keySchemaElement {
+	schema := []keySchemaElement{{AttributeName: i.hashKey, KeyType: string(types.KeyTypeHash)}}
+	if i.rangeKey != "" {
+		schema = append(schema, keySchemaElement{AttributeName: i.rangeKey, KeyType: string(types.KeyTypeRange)})
+	}
+	return schema
+}
+
+// updateTimeToLive enables or disables TTL immediately, without the ENABLING and DISABLING states.
+func (s *Store) updateTimeToLive(in *updateTimeToLiveInput) (*updateTimeToLiveOutput, error) {
+	t, err := s.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := in.TimeToLiveSpecification
+	if spec.AttributeName == "" {
+		return nil, validationError("TimeToLiveSpecification.AttributeName is required")
+	}
+
+	switch {
+	case spec.Enabled && t.ttlAttribute != "":
+		return nil, validationError("TimeToLive is already enabled")
+	case !spec.Enabled && t.ttlAttribute == "":
+		return nil, validationError("TimeToLive is already disabled")
+	case spec.Enabled:
+		t.ttlAttribute = spec.AttributeName
+	default:
+		t.ttlAttribute = ""
+	}
+
+	return &updateTimeToLiveOutput{TimeToLiveSpecification: spec}, nil
+}
+
+func (s *Store) describeTimeToLive(in *tableNameInput) (*describeTimeToLiveOutput, error) {
+	t, err := s.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	desc := timeToLiveDescription{TimeToLiveStatus: string(types.TimeToLiveStatusDisabled)}
+	if t.ttlAttribute != "" {
+		desc = timeToLiveDescription{AttributeName: t.ttlAttribute, TimeToLiveStatus: string(types.TimeToLiveStatusEnabled)}
+	}
+	return &describeTimeToLiveOutput{TimeToLiveDescription: desc}, nil
+}
@@ -0,0 +1,353 @@
+package ddblocal
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func typeName(v types.AttributeValue) string {
+	switch v.(type) {
+	case *types.AttributeValueMemberS:
+		return "S"
+	case *types.AttributeValueMemberN:
+		return "N"
+	case *types.AttributeValueMemberB:
+		return "B"
+	case *types.AttributeValueMemberBOOL:
+		return "BOOL"
+	case *types.AttributeValueMemberNULL:
+		return "NULL"
+	case *types.AttributeValueMemberSS:
+		return "SS"
+	case *types.AttributeValueMemberNS:
+		return "NS"
+	case *types.AttributeValueMemberBS:
+		return "BS"
+	case *types.AttributeValueMemberL:
+		return "L"
+	case *types.AttributeValueMemberM:
+		return "M"
+	default:
+		return ""
+	}
+}
+
+func parseNumber(n string) (*big.Rat, bool) {
+	return new(big.Rat).SetString(n)
+}
+
+// formatNumber formats r as a plain decimal without trailing zeros.
+func formatNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	s := r.FloatString(38)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func addNumbers(a, b string, subtract bool) (string, error) {
+	ra, okA := parseNumber(a)
+	rb, okB := parseNumber(b)
+	if !okA || !okB {
+		return "", validationError("invalid number")
+	}
+	if subtract {
+		return formatNumber(new(big.Rat).Sub(ra, rb)), nil
+	}
+	return formatNumber(new(big.Rat).Add(ra, rb)), nil
+}
+
+// compareValues orders two scalar values of the same type. ok is false if they are not comparable.
+func compareValues(a, b types.AttributeValue) (int, bool) {
+	switch a := a.(type) {
+	case *types.AttributeValueMemberS:
+		b, ok := b.(*types.AttributeValueMemberS)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a.Value, b.Value), true
+	case *types.AttributeValueMemberN:
+		b, ok := b.(*types.AttributeValueMemberN)
+		if !ok {
+			return 0, false
+		}
+		ra, okA := parseNumber(a.Value)
+		rb, okB := parseNumber(b.Value)
+		if !okA || !okB {
+			return 0, false
+		}
+		return ra.Cmp(rb), true
+	case *types.AttributeValueMemberB:
+		b, ok := b.(*types.AttributeValueMemberB)
+		if !ok {
+			return 0, false
+		}
+		return bytes.Compare(a.Value, b.Value), true
+	default:
+		return 0, false
+	}
+}
+
+func equalValues(a, b types.AttributeValue) bool {
+	if typeName(a) != typeName(b) {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *types.AttributeValueMemberS, *types.AttributeValueMemberN, *types.AttributeValueMemberB:
+		cmp, ok := compareValues(a, b)
+		return ok && cmp == 0
+	case *types.AttributeValueMemberBOOL:
+		return a.Value == b.(*types.AttributeValueMemberBOOL).Value
+	case *types.AttributeValueMemberNULL:
+		return a.Value == b.(*types.AttributeValueMemberNULL).Value
+	case *types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+		ea, eb := setElements(a), setElements(b)
+		if len(ea) != len(eb) {
+			return false
+		}
+		for _, x := range ea {
+			if !containsValue(eb, x) {
+				return false
+			}
+		}
+		return true
+	case *types.AttributeValueMemberL:
+		lb := b.(*types.AttributeValueMemberL)
+		if len(a.Value) != len(lb.Value) {
+			return false
+		}
+		for i := range a.Value {
+			if !equalValues(a.Value[i], lb.Value[i]) {
+				return false
+			}
+		}
+		return true
+	case *types.AttributeValueMemberM:
+		mb := b.(*types.AttributeValueMemberM)
+		if len(a.Value) != len(mb.Value) {
+			return false
+		}
+		for k, v := range a.Value {
+			other, ok := mb.Value[k]
+			if !ok || !equalValues(v, other) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+func containsValue(values []types.AttributeValue, v types.AttributeValue) bool {
+	for _, candidate := range values {
+		if equalValues(candidate, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// setElements returns the members of a set as scalar values.
+func setElements(v types.AttributeValue) []types.AttributeValue {
+	var out []types.AttributeValue
+	switch v := v.(type) {
+	case *types.AttributeValueMemberSS:
+		for _, s := range v.Value {
+			out = append(out, &types.AttributeValueMemberS{Value: s})
+		}
+	case *types.AttributeValueMemberNS:
+		for _, n := range v.Value {
+			out = append(out, &types.AttributeValueMemberN{Value: n})
+		}
+	case *types.AttributeValueMemberBS:
+		for _, b := range v.Value {
+			out = append(out, &types.AttributeValueMemberB{Value: b})
+		}
+	}
+	return out
+}
+
+// makeSet builds a set of the same type as like from scalar elements, or nil if elements is empty.
+func makeSet(like types.AttributeValue, elements []types.AttributeValue) types.AttributeValue {
+	if len(elements) == 0 {
+		return nil
+	}
+	switch like.(type) {
+	case *types.AttributeValueMemberSS:
+		out := &types.AttributeValueMemberSS{}
+		for _, e := range elements {
+			out.Value = append(out.Value, e.(*types.AttributeValueMemberS).Value)
+		}
+		return out
+	case *types.AttributeValueMemberNS:
+		out := &types.AttributeValueMemberNS{}
+		for _, e := range elements {
+			out.Value = append(out.Value, e.(*types.AttributeValueMemberN).Value)
+		}
+		return out
+	default:
+		out := &types.AttributeValueMemberBS{}
+		for _, e := range elements {
+			out.Value = append(out.Value, e.(*types.AttributeValueMemberB).Value)
+		}
+		return out
+	}
+}
+
+func setUnion(a, b types.AttributeValue) types.AttributeValue {
+	elements := setElements(a)
+	for _, e := range setElements(b) {
+		if !containsValue(elements, e) {
+			elements = append(elements, e)
+		}
+	}
+	return makeSet(a, elements)
+}
+
+func setDifference(a, b types.AttributeValue) types.AttributeValue {
+	remove := setElements(b)
+	var elements []types.AttributeValue
+	for _, e := range setElements(a) {
+		if !containsValue(remove, e) {
+			elements = append(elements, e)
+		}
+	}
+	return makeSet(a, elements)
+}
+
+func cloneItem(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	if item == nil {
+		return nil
+	}
+	out := make(map[string]types.AttributeValue, len(item))
+	for k, v := range item {
+		out[k] = cloneValue(v)
+	}
+	return out
+}
+
+func cloneValue(v types.AttributeValue) types.AttributeValue {
+	switch v := v.(type) {
+	case *types.AttributeValueMemberS:
+		return &types.AttributeValueMemberS{Value: v.Value}
+	case *types.AttributeValueMemberN:
+		return &types.AttributeValueMemberN{Value: v.Value}
+	case *types.AttributeValueMemberB:
+		return &types.AttributeValueMemberB{Value: append([]byte(nil), v.Value...)}
+	case *types.AttributeValueMemberBOOL:
+		return &types.AttributeValueMemberBOOL{Value: v.Value}
+	case *types.AttributeValueMemberNULL:
+		return &types.AttributeValueMemberNULL{Value: v.Value}
+	case *types.AttributeValueMemberSS:
+		return &types.AttributeValueMemberSS{Value: append([]string(nil), v.Value...)}
+	case *types.AttributeValueMemberNS:
+		return &types.AttributeValueMemberNS{Value: append([]string(nil), v.Value...)}
+	case *types.AttributeValueMemberBS:
+		out := make([][]byte, len(v.Value))
+		for i := range v.Value {
+			out[i] = append([]byte(nil), v.Value[i]...)
+		}
+		return &types.AttributeValueMemberBS{Value: out}
+	case *types.AttributeValueMemberL:
+		out := make([]types.AttributeValue, len(v.Value))
+		for i := range v.Value {
+			out[i] = cloneValue(v.Value[i])
+		}
+		return &types.AttributeValueMemberL{Value: out}
+	case *types.AttributeValueMemberM:
+		return &types.AttributeValueMemberM{Value: cloneItem(v.Value)}
+	default:
+		return v
+	}
+}
+
+func getPath(item map[string]types.AttributeValue, p path) (types.AttributeValue, bool) {
+	v, ok := item[p[0].name]
+	if !ok {
+		return nil, false
+	}
+	for _, e := range p[1:] {
+		if e.isIndex {
+			l, ok := v.(*types.AttributeValueMemberL)
+			if !ok || e.index >= len(l.Value) {
+				return nil, false
+			}
+			v = l.Value[e.index]
+		} else {
+			m, ok := v.(*types.AttributeValueMemberM)
+			if !ok {
+				return nil, false
+			}
+			if v, ok = m.Value[e.name]; !ok {
+				return nil, false
+			}
+		}
+	}
+	return v, true
+}
+
+// setPath sets the value at p, mutating item. Every element of p except the last must already exist. Setting
+// a list index past the end of the list appends to it.
+func setPath(item map[string]types.AttributeValue, p path, v types.AttributeValue) error {
+	if len(p) == 1 {
+		item[p[0].name] = v
+		return nil
+	}
+
+	parent, ok := getPath(item, p[:len(p)-1])
+	if !ok {
+		return validationError("the document path provided in the update expression is invalid for update")
+	}
+
+	last := p[len(p)-1]
+	if last.isIndex {
+		l, ok := parent.(*types.AttributeValueMemberL)
+		if !ok {
+			return validationError("the document path provided in the update expression is invalid for update")
+		}
+		if last.index >= len(l.Value) {
+			l.Value = append(l.Value, v)
+		} else {
+			l.Value[last.index] = v
+		}
+		return nil
+	}
+
+	m, ok := parent.(*types.AttributeValueMemberM)
+	if !ok {
+		return validationError("the document path provided in the update expression is invalid for update")
+	}
+	m.Value[last.name] = v
+	return nil
+}
+
+// removePath removes the value at p, mutating item. Missing paths are ignored.
+func removePath(item map[string]types.AttributeValue, p path) {
+	if len(p) == 1 {
+		delete(item, p[0].name)
+		return
+	}
+
+	parent, ok := getPath(item, p[:len(p)-1])
+	if !ok {
+		return
+	}
+
+	last := p[len(p)-1]
+	switch parent := parent.(type) {
+	case *types.AttributeValueMemberL:
+		if last.isIndex && last.index < len(parent.Value) {
+			parent.Value = append(parent.Value[:last.index], parent.Value[last.index+1:]...)
+		}
+	case *types.AttributeValueMemberM:
+		if !last.isIndex {
+			delete(parent.Value, last.name)
+		}
+	}
+}
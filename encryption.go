@@ -0,0 +1,629 @@
+package ddb
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/danielwchapman/ddb/internal/avjson"
+)
+
+// signatureColumn holds the signature of a row written by a Client that signs rows.
+const signatureColumn = "RowSignature"
+
+// envelopeVersion is the first byte of encrypted attributes and signatures.
+const envelopeVersion = 1
+
+// ErrInvalidSignature is returned when a signed row was altered outside the Client, or moved to another key.
+var ErrInvalidSignature = errors.New("invalid row signature")
+
+// KeyProvider supplies the keys used to encrypt and sign rows. Keys are identified by an ID that is stored with
+// every encrypted attribute and signature, so rows written with an older key can still be read after rotation.
+type KeyProvider interface {
+	// CurrentKey returns the ID and key to encrypt and sign new writes with.
+	CurrentKey(ctx context.Context) (id string, key []byte, err error)
+	// Key returns the key with the given ID.
+	Key(ctx context.Context, id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider with keys held in memory, for tests and local development.
+type StaticKeys struct {
+	// Current is the ID of the key new writes use.
+	Current string
+	// Keys maps key IDs to AES keys of 16, 24 or 32 bytes.
+	Keys map[string][]byte
+}
+
+func (k *StaticKeys) CurrentKey(ctx context.Context) (string, []byte, error) {
+	key, err := k.Key(ctx, k.Current)
+	return k.Current, key, err
+}
+
+func (k *StaticKeys) Key(_ context.Context, id string) ([]byte, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	return key, nil
+}
+
+// Encryption encrypts the fields of rows tagged `ddb:",encrypt"` on the client, before they are sent to DynamoDB.
+// Each encrypted attribute is bound to its table, PK, SK and attribute name, so it cannot be copied to another
+// row or field. Encrypted attributes are stored as binary and cannot be used in conditions, filters or keys.
+type Encryption struct {
+	Keys KeyProvider
+
+	// Sign adds a signature over the key and all attributes of rows written with Put and TransactPuts, which
+	// Get and Query verify. Update cannot keep the signature valid with UpdateItem, so it reads and verifies the
+	// row, and puts it back signed with the updates applied. Updates of nested attributes are not supported.
+	Sign bool
+}
+
+// EncryptedAttributes returns the attribute names of the fields of the type of v that are tagged
+// `ddb:",encrypt"`, including those of embedded structs. v can be a struct or a pointer to one.
+func EncryptedAttributes(v any) []string {
+	return encryptedAttributes(reflect.TypeOf(v))
+}
+
+// encryptedAttributes returns the attribute names of the fields tagged with encrypt.
+func encryptedAttributes(t reflect.Type) []string {
+	return taggedAttributes(t, "encrypt")
+}
+
+type taggedAttributesKey struct {
+	t      reflect.Type
+	option string
+}
+
+var taggedAttributesCache sync.Map // taggedAttributesKey -> []string
+
+// taggedAttributes returns the attribute names of the fields with an option in their ddb tag, such as
+// `ddb:",encrypt"`, including those of embedded structs, which attributevalue flattens.
+func taggedAttributes(t reflect.Type, option string) []string {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	key := taggedAttributesKey{t: t, option: option}
+	if cached, ok := taggedAttributesCache.Load(key); ok {
+		return cached.([]string)
+	}
+
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("dynamodbav"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			names = append(names, taggedAttributes(field.Type, option)...)
+			continue
+		}
+		if !field.IsExported() || !hasTagOption(field.Tag.Get("ddb"), option) {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+
+	taggedAttributesCache.Store(key, names)
+	return names
+}
+
+func hasTagOption(tag, option string) bool {
+	_, opts, _ := strings.Cut(tag, ",")
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
+// rowElemType returns the row type of a Query output, a pointer to a slice of rows.
+func rowElemType(out any) reflect.Type {
+	t := reflect.TypeOf(out)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Slice {
+		return nil
+	}
+	return t.Elem()
+}
+
+// sealItem encrypts the attributes of an item that rowType tags with encrypt, and signs the item if the Client
+// signs rows.
+func (c *Client) sealItem(ctx context.Context, item map[string]types.AttributeValue, rowType reflect.Type) error {
+	names := encryptedAttributes(rowType)
+	if c.Encryption == nil {
+		if len(names) > 0 {
+			return &InvalidArgumentError{err: fmt.Errorf("%s has encrypted fields but the client has no Encryption", rowType)}
+		}
+		return nil
+	}
+
+	id, key, err := c.Encryption.Keys.CurrentKey(ctx)
+	if err != nil {
+		return fmt.Errorf("CurrentKey: %w", err)
+	}
+	if id == "" || len(id) > 255 {
+		return fmt.Errorf("CurrentKey: key ID must be 1 to 255 bytes, got %q", id)
+	}
+
+	pk, sk := c.rowKey(item)
+	for _, name := range names {
+		av, ok := item[name]
+		if !ok {
+			continue
+		}
+		encrypted, err := encryptAttribute(id, key, av, c.attributeBinding(pk, sk, name))
+		if err != nil {
+			return fmt.Errorf("encrypt %s: %w", name, err)
+		}
+		item[name] = encrypted
+	}
+
+	if c.Encryption.Sign {
+		signature, err := c.signature(key, pk, sk, item)
+		if err != nil {
+			return fmt.Errorf("sign: %w", err)
+		}
+		item[signatureColumn] = &types.AttributeValueMemberB{Value: envelope(id, signature)}
+	}
+
+	return nil
+}
+
+// openItem verifies the signature of an item read from the table if the Client signs rows, and decrypts the
+// attributes rowType tags with encrypt.
+func (c *Client) openItem(ctx context.Context, item map[string]types.AttributeValue, rowType reflect.Type) error {
+	pk, sk := c.rowKey(item)
+	return c.openItemKey(ctx, item, pk, sk, rowType)
+}
+
+// openItemKey is openItem for items that may not include their key, such as the attributes Update returns.
+func (c *Client) openItemKey(ctx context.Context, item map[string]types.AttributeValue, pk, sk string, rowType reflect.Type) error {
+	names := encryptedAttributes(rowType)
+	if c.Encryption == nil {
+		if len(names) > 0 {
+			return &InvalidArgumentError{err: fmt.Errorf("%s has encrypted fields but the client has no Encryption", rowType)}
+		}
+		return nil
+	}
+
+	if c.Encryption.Sign {
+		signature, ok := item[signatureColumn].(*types.AttributeValueMemberB)
+		if !ok {
+			return fmt.Errorf("PK %s SK %s: %w", pk, sk, ErrInvalidSignature)
+		}
+		id, mac, err := openEnvelope(signature.Value)
+		if err != nil {
+			return fmt.Errorf("PK %s SK %s: %w", pk, sk, ErrInvalidSignature)
+		}
+		key, err := c.Encryption.Keys.Key(ctx, id)
+		if err != nil {
+			return fmt.Errorf("Key: %w", err)
+		}
+		expected, err := c.signature(key, pk, sk, item)
+		if err != nil {
+			return &InternalError{err: fmt.Errorf("PK %s SK %s: verify: %w", pk, sk, err)}
+		}
+		if !hmac.Equal(mac, expected) {
+			return fmt.Errorf("PK %s SK %s: %w", pk, sk, ErrInvalidSignature)
+		}
+	}
+	delete(item, signatureColumn)
+
+	for _, name := range names {
+		av, ok := item[name]
+		if !ok {
+			continue
+		}
+		encrypted, ok := av.(*types.AttributeValueMemberB)
+		if !ok {
+			return &InternalError{err: fmt.Errorf("PK %s SK %s: attribute %s is not encrypted", pk, sk, name)}
+		}
+		decrypted, err := c.decryptAttribute(ctx, encrypted.Value, c.attributeBinding(pk, sk, name))
+		if err != nil {
+			return &InternalError{err: fmt.Errorf("PK %s SK %s: decrypt %s: %w", pk, sk, name, err)}
+		}
+		item[name] = decrypted
+	}
+
+	return nil
+}
+
+// encryptUpdates adds the updates from WithEncryptedFieldUpdates, encrypted for the row with pk and sk.
+func (c *Client) encryptUpdates(ctx context.Context, pk, sk string, o *options) error {
+	if c.Encryption == nil {
+		return &InvalidArgumentError{err: errors.New("encrypted updates but the client has no Encryption")}
+	}
+
+	id, key, err := c.Encryption.Keys.CurrentKey(ctx)
+	if err != nil {
+		return fmt.Errorf("CurrentKey: %w", err)
+	}
+	if id == "" || len(id) > 255 {
+		return fmt.Errorf("CurrentKey: key ID must be 1 to 255 bytes, got %q", id)
+	}
+
+	// sort so that the same updates always produce the same expression
+	names := make([]string, 0, len(o.encryptedUpdates))
+	for name := range o.encryptedUpdates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		encrypted, err := encryptAttribute(id, key, o.encryptedUpdates[name], c.attributeBinding(pk, sk, name))
+		if err != nil {
+			return fmt.Errorf("encrypt %s: %w", name, err)
+		}
+		o.setAttribute(name, encrypted)
+	}
+
+	return nil
+}
+
+// signedUpdateAttempts is how many times Update on a Client that signs rows reads a row again because it changed
+// between the read and the write.
+const signedUpdateAttempts = 5
+
+// updateSigned applies the updates in o to a row with a Put conditioned on the row being unchanged since it was
+// read, so that the row can be signed again. A missing row is created, like UpdateItem does.
+func (c *Client) updateSigned(ctx context.Context, pk, sk string, o *options) error {
+	if o.updatesCount == 0 {
+		return &InvalidArgumentError{err: errors.New("no updates provided")}
+	}
+	for _, name := range o.updatedAttributes() {
+		if strings.ContainsAny(name, ".[") {
+			return &InvalidArgumentError{err: fmt.Errorf("nested attribute %s cannot be updated in a signed row", name)}
+		}
+	}
+
+	var conflict error
+	for attempt := 0; attempt < signedUpdateAttempts; attempt++ {
+		stored, err := c.getConsistent(ctx, pk, sk)
+		if err != nil {
+			return err
+		}
+
+		updated := itemKey(pk, sk)
+		unchanged := expression.Name(defaultPK).AttributeNotExists()
+		if stored != nil {
+			updated = copyItem(stored)
+			if err := c.openItem(ctx, updated, nil); err != nil {
+				return err
+			}
+
+			// the condition is scoped to the tenant with the rest of the expression
+			image := copyItem(stored)
+			if err := o.unscopeItem(image); err != nil {
+				return err
+			}
+			unchanged = UnchangedCondition(image)
+		}
+
+		for name, av := range o.setAttributes {
+			updated[name] = av
+		}
+		for _, name := range o.removeAttributes {
+			delete(updated, name)
+		}
+		if err := c.sealItem(ctx, updated, nil); err != nil {
+			return err
+		}
+
+		cond := unchanged
+		if o.conditionsCount > 0 {
+			cond = o.conditions.And(unchanged)
+		}
+		expr, err := expression.NewBuilder().WithCondition(cond).Build()
+		if err != nil {
+			return fmt.Errorf("expression builder: %w", err)
+		}
+		if _, err := o.scopeExpression(expr, expr.Condition()); err != nil {
+			return err
+		}
+
+		_, err = c.Ddb.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:                 &c.Table,
+			Item:                      updated,
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		}, c.rateLimit(ctx)...)
+		if err == nil {
+			return c.signedUpdateValues(ctx, o, stored, updated)
+		}
+
+		var condFailedErr *types.ConditionalCheckFailedException
+		if !errors.As(err, &condFailedErr) {
+			return fmt.Errorf("PutItem: %w", err)
+		}
+		conflict = fmt.Errorf("PutItem: %w", err)
+
+		// if the row has not changed, the caller's condition failed
+		current, err := c.getConsistent(ctx, pk, sk)
+		if err != nil {
+			return err
+		}
+		if sameItem(current, stored) {
+			return conflict
+		}
+	}
+
+	return fmt.Errorf("row changed on each of %d attempts: %w", signedUpdateAttempts, conflict)
+}
+
+// signedUpdateValues unmarshals the attributes that ReturnValues asks for from the row before and after an
+// update by updateSigned.
+func (c *Client) signedUpdateValues(ctx context.Context, o *options, before, after map[string]types.AttributeValue) error {
+	var item map[string]types.AttributeValue
+	switch o.returnValues {
+	case types.ReturnValueAllOld, types.ReturnValueUpdatedOld:
+		item = copyItem(before)
+	case types.ReturnValueAllNew, types.ReturnValueUpdatedNew:
+		item = copyItem(after)
+	default:
+		return nil
+	}
+
+	if len(item) > 0 {
+		// decode the whole row, as the signature covers every attribute
+		if err := c.decodeItem(ctx, item, reflect.TypeOf(o.returnValuesOut)); err != nil {
+			return err
+		}
+		if o.returnValues == types.ReturnValueUpdatedOld || o.returnValues == types.ReturnValueUpdatedNew {
+			updated := make(map[string]types.AttributeValue, len(o.setAttributes)+len(o.removeAttributes))
+			for _, name := range o.updatedAttributes() {
+				if av, ok := item[name]; ok {
+					updated[name] = av
+				}
+			}
+			item = updated
+		}
+		if err := o.unscopeItem(item); err != nil {
+			return err
+		}
+	}
+
+	if err := attributevalue.UnmarshalMap(item, o.returnValuesOut); err != nil {
+		return fmt.Errorf("UnmarshalMap: %w", err)
+	}
+	return nil
+}
+
+// sameItem reports whether two items read from the table have the same attributes.
+func sameItem(a, b map[string]types.AttributeValue) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	encodedA, errA := avjson.MarshalItem(a)
+	encodedB, errB := avjson.MarshalItem(b)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+func copyItem(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	if item == nil {
+		return nil
+	}
+	out := make(map[string]types.AttributeValue, len(item))
+	for k, v := range item {
+		out[k] = v
+	}
+	return out
+}
+
+// rowKey returns the PK and SK a row was written with. Archived soft deletes are moved to a prefixed SK, so the
+// prefix is removed to keep their encrypted attributes and signature valid.
+func (c *Client) rowKey(item map[string]types.AttributeValue) (string, string) {
+	var pk, sk string
+	if v, ok := item[defaultPK].(*types.AttributeValueMemberS); ok {
+		pk = v.Value
+	}
+	if v, ok := item[defaultSK].(*types.AttributeValueMemberS); ok {
+		sk = v.Value
+	}
+	if c.SoftDelete != nil && c.SoftDelete.ArchivePrefix != "" && isDeleted(item) {
+		sk = strings.TrimPrefix(sk, c.SoftDelete.ArchivePrefix)
+	}
+	return pk, sk
+}
+
+func (c *Client) attributeBinding(pk, sk, name string) []byte {
+	hash := sha256.New()
+	writeParts(hash, []byte(c.Table), []byte(pk), []byte(sk), []byte(name))
+	return hash.Sum(nil)
+}
+
+// signature is a MAC over the row key and every attribute except the key attributes, which are covered by the
+// row key, and DeletedAt, which soft deletes set without rewriting the row. The index keys an archived row sets
+// aside are signed as if they were still on the row, as Restore puts them back.
+func (c *Client) signature(key []byte, pk, sk string, item map[string]types.AttributeValue) ([]byte, error) {
+	signed := make(map[string]types.AttributeValue, len(item))
+	for name, av := range item {
+		switch name {
+		case defaultPK, defaultSK, deletedAtColumn, signatureColumn:
+			continue
+		case archivedIndexKeysColumn:
+			if indexKeys, ok := av.(*types.AttributeValueMemberM); ok {
+				for k, v := range indexKeys.Value {
+					signed[k] = canonicalValue(v)
+				}
+				continue
+			}
+		}
+		signed[name] = canonicalValue(av)
+	}
+
+	// avjson writes map keys in sorted order, so the same attributes always give the same bytes
+	attributes, err := avjson.MarshalItem(signed)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, signingKey(key))
+	writeParts(mac, []byte(c.Table), []byte(pk), []byte(sk), attributes)
+	return mac.Sum(nil), nil
+}
+
+// signingKey derives the MAC key from a key so that the same bytes are not used for both AES and HMAC.
+func signingKey(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("ddb row signature"))
+	return mac.Sum(nil)
+}
+
+// canonicalValue returns a value as DynamoDB returns it regardless of how it was written: set members in sorted
+// order and numbers without insignificant zeros.
+func canonicalValue(av types.AttributeValue) types.AttributeValue {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberN:
+		return &types.AttributeValueMemberN{Value: canonicalNumber(v.Value)}
+	case *types.AttributeValueMemberSS:
+		ss := append([]string(nil), v.Value...)
+		sort.Strings(ss)
+		return &types.AttributeValueMemberSS{Value: ss}
+	case *types.AttributeValueMemberNS:
+		ns := make([]string, len(v.Value))
+		for i := range v.Value {
+			ns[i] = canonicalNumber(v.Value[i])
+		}
+		sort.Strings(ns)
+		return &types.AttributeValueMemberNS{Value: ns}
+	case *types.AttributeValueMemberBS:
+		bs := make([]string, len(v.Value))
+		for i := range v.Value {
+			bs[i] = string(v.Value[i])
+		}
+		sort.Strings(bs)
+		out := make([][]byte, len(bs))
+		for i := range bs {
+			out[i] = []byte(bs[i])
+		}
+		return &types.AttributeValueMemberBS{Value: out}
+	case *types.AttributeValueMemberL:
+		l := make([]types.AttributeValue, len(v.Value))
+		for i := range v.Value {
+			l[i] = canonicalValue(v.Value[i])
+		}
+		return &types.AttributeValueMemberL{Value: l}
+	case *types.AttributeValueMemberM:
+		m := make(map[string]types.AttributeValue, len(v.Value))
+		for k := range v.Value {
+			m[k] = canonicalValue(v.Value[k])
+		}
+		return &types.AttributeValueMemberM{Value: m}
+	default:
+		return av
+	}
+}
+
+func canonicalNumber(n string) string {
+	r, ok := new(big.Rat).SetString(n)
+	if !ok {
+		return n
+	}
+	return r.RatString()
+}
+
+func encryptAttribute(id string, key []byte, av types.AttributeValue, binding []byte) (types.AttributeValue, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// the plaintext is the typed DynamoDB JSON so that decryption restores the original type
+	plaintext, err := json.Marshal(avjson.Value{AttributeValue: av})
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("rand.Read: %w", err)
+	}
+
+	return &types.AttributeValueMemberB{Value: envelope(id, aead.Seal(nonce, nonce, plaintext, binding))}, nil
+}
+
+func (c *Client) decryptAttribute(ctx context.Context, data, binding []byte) (types.AttributeValue, error) {
+	id, sealed, err := openEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.Encryption.Keys.Key(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("Key: %w", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("malformed ciphertext")
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], binding)
+	if err != nil {
+		return nil, errors.New("ciphertext was altered or belongs to another attribute")
+	}
+	return avjson.UnmarshalValue(plaintext)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("aes.NewCipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// envelope prefixes data with the version and the ID of the key it was made with.
+func envelope(id string, data []byte) []byte {
+	out := make([]byte, 0, 2+len(id)+len(data))
+	out = append(out, envelopeVersion, byte(len(id)))
+	out = append(out, id...)
+	return append(out, data...)
+}
+
+func openEnvelope(data []byte) (string, []byte, error) {
+	if len(data) < 2 || data[0] != envelopeVersion || len(data) < 2+int(data[1]) {
+		return "", nil, errors.New("malformed envelope")
+	}
+	idLen := int(data[1])
+	return string(data[2 : 2+idLen]), data[2+idLen:], nil
+}
+
+// writeParts writes length-prefixed parts to a hash, so that the parts cannot run into each other.
+func writeParts(w io.Writer, parts ...[]byte) {
+	for _, part := range parts {
+		_ = binary.Write(w, binary.BigEndian, uint32(len(part)))
+		_, _ = w.Write(part)
+	}
+}
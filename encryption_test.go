@@ -0,0 +1,235 @@
+package ddb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type encryptedRow struct {
+	RowHeader
+	Name  string
+	Email string `ddb:",encrypt"`
+	Score int    `dynamodbav:"score" ddb:",encrypt"`
+}
+
+// testKeys are the encryption keys of test clients.
+var testKeys = &StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+
+func withEncryption(sign bool) func(*Client) {
+	return func(c *Client) {
+		c.Encryption = &Encryption{Keys: testKeys, Sign: sign}
+	}
+}
+
+func rawItem(t *testing.T, client *Client, pk, sk string) map[string]types.AttributeValue {
+	t.Helper()
+	resp, err := client.Ddb.GetItem(context.Background(), &dynamodb.GetItemInput{TableName: &client.Table, Key: itemKey(pk, sk)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return resp.Item
+}
+
+func TestEncryption(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newTestClient(t, TableSpec{}, withEncryption(false))
+	ctx := context.Background()
+
+	row := encryptedRow{RowHeader: RowHeader{PK: "USER#1", SK: "PROFILE", RowType: "PROFILE"}, Name: "Ada", Email: "ada@example.com", Score: 42}
+	if err := client.Put(ctx, row); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other := encryptedRow{RowHeader: RowHeader{PK: "USER#2", SK: "PROFILE", RowType: "PROFILE"}, Email: "bob@example.com"}
+	if err := client.TransactPuts(ctx, "token", PutRow{Row: other}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("stored encrypted", func(t *testing.T) {
+		item := rawItem(t, client, "USER#1", "PROFILE")
+		email, ok := item["Email"].(*types.AttributeValueMemberB)
+		if !ok || bytes.Contains(email.Value, []byte("ada@example.com")) {
+			t.Errorf("expected Email to be encrypted, got: %#v", item["Email"])
+		}
+		if _, ok := item["score"].(*types.AttributeValueMemberB); !ok {
+			t.Errorf("expected score to be encrypted, got: %#v", item["score"])
+		}
+		if name, ok := item["Name"].(*types.AttributeValueMemberS); !ok || name.Value != "Ada" {
+			t.Errorf("expected Name in plaintext, got: %#v", item["Name"])
+		}
+	})
+
+	t.Run("Get and Query decrypt", func(t *testing.T) {
+		var got encryptedRow
+		if err := client.Get(ctx, "USER#1", "PROFILE", &got); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != row {
+			t.Errorf("unexpected row: %+v", got)
+		}
+
+		var rows []encryptedRow
+		if err := client.Query(ctx, KeyPkOnly("USER#2"), &rows); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(rows) != 1 || rows[0].Email != "bob@example.com" {
+			t.Errorf("unexpected rows: %+v", rows)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		err := client.Update(ctx, "USER#1", "PROFILE", WithEncryptedFieldUpdates(map[string]any{"Email": "ada@example.org"}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var got encryptedRow
+		if err := client.Get(ctx, "USER#1", "PROFILE", &got); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.Email != "ada@example.org" {
+			t.Errorf("unexpected Email: %q", got.Email)
+		}
+	})
+
+	t.Run("swapped ciphertext", func(t *testing.T) {
+		// copying an encrypted value to another row must not decrypt there
+		stolen := rawItem(t, client, "USER#2", "PROFILE")["Email"]
+		err := client.Update(ctx, "USER#1", "PROFILE", WithFieldUpdates(map[string]any{"Email": stolen.(*types.AttributeValueMemberB).Value}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var got encryptedRow
+		var internalErr *InternalError
+		if err := client.Get(ctx, "USER#1", "PROFILE", &got); !errors.As(err, &internalErr) {
+			t.Errorf("expected InternalError, got: %v", err)
+		}
+	})
+
+	t.Run("no Encryption", func(t *testing.T) {
+		plain := &Client{Ddb: client.Ddb, Table: client.Table}
+
+		var invalidArgumentErr *InvalidArgumentError
+		if err := plain.Put(ctx, row); !errors.As(err, &invalidArgumentErr) {
+			t.Errorf("expected InvalidArgumentError, got: %v", err)
+		}
+	})
+}
+
+func TestEncryptionSign(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newTestClient(t, TableSpec{}, withEncryption(true))
+	ctx := context.Background()
+
+	for _, pk := range []string{"USER#1", "USER#2"} {
+		row := encryptedRow{RowHeader: RowHeader{PK: pk, SK: "PROFILE", RowType: "PROFILE"}, Name: pk, Email: pk + "@example.com"}
+		if err := client.Put(ctx, row); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	var got encryptedRow
+	if err := client.Get(ctx, "USER#1", "PROFILE", &got); err != nil || got.Email != "USER#1@example.com" {
+		t.Fatalf("unexpected row: %+v, %v", got, err)
+	}
+
+	// Update signs the row again
+	var old encryptedRow
+	err := client.Update(ctx, "USER#1", "PROFILE",
+		WithFieldUpdates(map[string]any{"Name": "Ada"}),
+		WithEncryptedFieldUpdates(map[string]any{"Email": "ada@example.com"}),
+		WithCondition(expression.Name("Name").Equal(expression.Value("USER#1"))),
+		WithReturnValues(types.ReturnValueAllOld, &old),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if old.Email != "USER#1@example.com" {
+		t.Errorf("unexpected old row: %+v", old)
+	}
+	if err := client.Get(ctx, "USER#1", "PROFILE", &got); err != nil || got.Name != "Ada" || got.Email != "ada@example.com" {
+		t.Errorf("unexpected row: %+v, %v", got, err)
+	}
+
+	// a failed condition is returned as it is by UpdateItem
+	var condFailedErr *types.ConditionalCheckFailedException
+	err = client.Update(ctx, "USER#1", "PROFILE",
+		WithFieldUpdates(map[string]any{"Name": "x"}),
+		WithCondition(expression.Name("Name").Equal(expression.Value("USER#1"))),
+	)
+	if !errors.As(err, &condFailedErr) {
+		t.Errorf("expected ConditionalCheckFailedException, got: %v", err)
+	}
+
+	// changing a plaintext attribute outside the Client breaks the signature
+	plain := &Client{Ddb: client.Ddb, Table: client.Table}
+	if err := plain.Update(ctx, "USER#1", "PROFILE", WithFieldUpdates(map[string]any{"Name": "Mallory"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.Get(ctx, "USER#1", "PROFILE", &got); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got: %v", err)
+	}
+
+	// and Update does not sign a row that was altered
+	if err := client.Update(ctx, "USER#1", "PROFILE", WithFieldUpdates(map[string]any{"Name": "Ada"})); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got: %v", err)
+	}
+
+	// so does swapping a whole row to another key
+	item := rawItem(t, client, "USER#2", "PROFILE")
+	item[defaultSK] = &types.AttributeValueMemberS{Value: "SETTINGS"}
+	if _, err := client.Ddb.PutItem(ctx, &dynamodb.PutItemInput{TableName: &client.Table, Item: item}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var rows []encryptedRow
+	if err := client.Query(ctx, KeySkBeginsWith("USER#2", "SETTINGS"), &rows); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got: %v", err)
+	}
+}
+
+type encryptedOrder struct {
+	RowHeader
+	Card string `ddb:",encrypt"`
+}
+
+func TestEncryptionRowTypes(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newTestClient(t, TableSpec{}, withEncryption(true))
+	ctx := context.Background()
+
+	profile := encryptedRow{RowHeader: RowHeader{PK: "USER#1", SK: "PROFILE", RowType: "PROFILE"}, Email: "ada@example.com", Score: 7}
+	order := encryptedOrder{RowHeader: RowHeader{PK: "USER#1", SK: "ORDER#1", RowType: "ORDER"}, Card: "4242"}
+	if err := client.TransactPuts(ctx, "token", PutRow{Row: profile}, PutRow{Row: order}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rowTypes := NewRowTypes().Register("PROFILE", encryptedRow{}).Register("ORDER", encryptedOrder{})
+
+	var mixed []any
+	if err := client.Query(ctx, KeyPkOnly("USER#1"), &mixed, WithRowTypes(rowTypes)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mixed) != 2 || mixed[0] != order || mixed[1] != profile {
+		t.Errorf("unexpected rows: %+v", mixed)
+	}
+
+	var grouped struct {
+		Profiles []encryptedRow
+		Orders   []*encryptedOrder
+	}
+	if err := client.Query(ctx, KeyPkOnly("USER#1"), &grouped, WithRowTypes(rowTypes)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(grouped.Profiles) != 1 || grouped.Profiles[0] != profile || len(grouped.Orders) != 1 || *grouped.Orders[0] != order {
+		t.Errorf("unexpected rows: %+v", grouped)
+	}
+}
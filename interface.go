@@ -22,6 +22,12 @@ type Getter interface {
 	Get(ctx context.Context, pk, sk string, out any) error
 }
 
+// GetterWithOptions is a Getter that also takes options, such as WithConsistentRead or WithIncludeDeleted.
+type GetterWithOptions interface {
+	Getter
+	GetWithOptions(ctx context.Context, pk, sk string, out any, opts ...Option) error
+}
+
 type Putter interface {
 	Put(ctx context.Context, row any, opts ...Option) error
 }
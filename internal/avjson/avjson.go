@@ -0,0 +1,198 @@
+// Package avjson encodes DynamoDB attribute values in the DynamoDB JSON form used on the wire, e.g.
+// {"S":"abc"} or {"M":{"n":{"N":"1"}}}. Unlike a round trip through attributevalue and encoding/json it is
+// lossless: numbers, binary values and sets keep their DynamoDB types.
+package avjson
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Value wraps an attribute value so it can be used with encoding/json.
+type Value struct {
+	types.AttributeValue
+}
+
+// Item is an attribute value map that can be used with encoding/json.
+type Item map[string]types.AttributeValue
+
+func (v Value) MarshalJSON() ([]byte, error) {
+	return json.Marshal(toJSON(v.AttributeValue))
+}
+
+func (v *Value) UnmarshalJSON(data []byte) error {
+	av, err := UnmarshalValue(data)
+	if err != nil {
+		return err
+	}
+	v.AttributeValue = av
+	return nil
+}
+
+func (item Item) MarshalJSON() ([]byte, error) {
+	if item == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(toJSONMap(item))
+}
+
+func (item *Item) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		*item = nil
+		return nil
+	}
+
+	out := make(Item, len(raw))
+	for k, v := range raw {
+		av, err := UnmarshalValue(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		out[k] = av
+	}
+	*item = out
+	return nil
+}
+
+// MarshalItem encodes an item as DynamoDB JSON.
+func MarshalItem(item map[string]types.AttributeValue) ([]byte, error) {
+	return Item(item).MarshalJSON()
+}
+
+// UnmarshalItem decodes an item from DynamoDB JSON.
+func UnmarshalItem(data []byte) (map[string]types.AttributeValue, error) {
+	var item Item
+	if err := item.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// UnmarshalValue decodes a single DynamoDB JSON attribute value.
+func UnmarshalValue(data []byte) (types.AttributeValue, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw) != 1 {
+		return nil, errors.New("attribute value must have exactly one type")
+	}
+
+	for typ, v := range raw {
+		switch typ {
+		case "S":
+			var s string
+			err := json.Unmarshal(v, &s)
+			return &types.AttributeValueMemberS{Value: s}, err
+		case "N":
+			var n string
+			err := json.Unmarshal(v, &n)
+			return &types.AttributeValueMemberN{Value: n}, err
+		case "B":
+			var b []byte
+			err := json.Unmarshal(v, &b)
+			return &types.AttributeValueMemberB{Value: b}, err
+		case "BOOL":
+			var b bool
+			err := json.Unmarshal(v, &b)
+			return &types.AttributeValueMemberBOOL{Value: b}, err
+		case "NULL":
+			var b bool
+			err := json.Unmarshal(v, &b)
+			return &types.AttributeValueMemberNULL{Value: b}, err
+		case "SS":
+			var ss []string
+			err := json.Unmarshal(v, &ss)
+			return &types.AttributeValueMemberSS{Value: ss}, err
+		case "NS":
+			var ns []string
+			err := json.Unmarshal(v, &ns)
+			return &types.AttributeValueMemberNS{Value: ns}, err
+		case "BS":
+			var bs [][]byte
+			err := json.Unmarshal(v, &bs)
+			return &types.AttributeValueMemberBS{Value: bs}, err
+		case "L":
+			var l []Value
+			if err := json.Unmarshal(v, &l); err != nil {
+				return nil, err
+			}
+			out := make([]types.AttributeValue, len(l))
+			for i := range l {
+				out[i] = l[i].AttributeValue
+			}
+			return &types.AttributeValueMemberL{Value: out}, nil
+		case "M":
+			var m Item
+			if err := json.Unmarshal(v, &m); err != nil {
+				return nil, err
+			}
+			if m == nil {
+				m = Item{}
+			}
+			return &types.AttributeValueMemberM{Value: m}, nil
+		default:
+			return nil, fmt.Errorf("unsupported attribute value type %q", typ)
+		}
+	}
+
+	return nil, errors.New("unreachable")
+}
+
+func toJSON(av types.AttributeValue) any {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return map[string]string{"S": v.Value}
+	case *types.AttributeValueMemberN:
+		return map[string]string{"N": v.Value}
+	case *types.AttributeValueMemberB:
+		return map[string]string{"B": base64.StdEncoding.EncodeToString(v.Value)}
+	case *types.AttributeValueMemberBOOL:
+		return map[string]bool{"BOOL": v.Value}
+	case *types.AttributeValueMemberNULL:
+		return map[string]bool{"NULL": v.Value}
+	case *types.AttributeValueMemberSS:
+		return map[string][]string{"SS": nonNil(v.Value)}
+	case *types.AttributeValueMemberNS:
+		return map[string][]string{"NS": nonNil(v.Value)}
+	case *types.AttributeValueMemberBS:
+		out := make([]string, len(v.Value))
+		for i := range v.Value {
+			out[i] = base64.StdEncoding.EncodeToString(v.Value[i])
+		}
+		return map[string][]string{"BS": out}
+	case *types.AttributeValueMemberL:
+		out := make([]any, len(v.Value))
+		for i := range v.Value {
+			out[i] = toJSON(v.Value[i])
+		}
+		return map[string][]any{"L": out}
+	case *types.AttributeValueMemberM:
+		return map[string]any{"M": toJSONMap(v.Value)}
+	default:
+		return nil
+	}
+}
+
+func toJSONMap(item map[string]types.AttributeValue) map[string]any {
+	out := make(map[string]any, len(item))
+	for k, v := range item {
+		out[k] = toJSON(v)
+	}
+	return out
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
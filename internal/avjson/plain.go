@@ -0,0 +1,150 @@
+package avjson
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// MarshalPlainItem encodes an item as plain JSON, e.g. {"PK":"USER#1","Age":42}. Numbers keep their exact
+// digits. Binary values are written as base64 strings and sets as arrays, so they do not keep their types.
+func MarshalPlainItem(item map[string]types.AttributeValue) ([]byte, error) {
+	return json.Marshal(toPlainMap(item))
+}
+
+// UnmarshalPlainItem decodes an item from plain JSON. Numbers become N values with the digits as written,
+// arrays become lists and objects become maps.
+func UnmarshalPlainItem(data []byte) (map[string]types.AttributeValue, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var raw map[string]any
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("item must be a JSON object")
+	}
+	return fromPlainMap(raw)
+}
+
+// CheckPlainItem returns an error naming the first attribute, in an item or nested in its lists and maps, that
+// MarshalPlainItem would not keep the type of: binary values and sets.
+func CheckPlainItem(item map[string]types.AttributeValue) error {
+	for k, v := range item {
+		if err := checkPlain(v); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+func checkPlain(av types.AttributeValue) error {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberB, *types.AttributeValueMemberBS,
+		*types.AttributeValueMemberSS, *types.AttributeValueMemberNS:
+		return fmt.Errorf("%T cannot be written as plain JSON without losing its type", av)
+	case *types.AttributeValueMemberL:
+		for i := range v.Value {
+			if err := checkPlain(v.Value[i]); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+	case *types.AttributeValueMemberM:
+		return CheckPlainItem(v.Value)
+	}
+	return nil
+}
+
+func toPlain(av types.AttributeValue) any {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value
+	case *types.AttributeValueMemberN:
+		return json.Number(v.Value)
+	case *types.AttributeValueMemberB:
+		return base64.StdEncoding.EncodeToString(v.Value)
+	case *types.AttributeValueMemberBOOL:
+		return v.Value
+	case *types.AttributeValueMemberNULL:
+		return nil
+	case *types.AttributeValueMemberSS:
+		return nonNil(v.Value)
+	case *types.AttributeValueMemberNS:
+		out := make([]json.Number, len(v.Value))
+		for i := range v.Value {
+			out[i] = json.Number(v.Value[i])
+		}
+		return out
+	case *types.AttributeValueMemberBS:
+		out := make([]string, len(v.Value))
+		for i := range v.Value {
+			out[i] = base64.StdEncoding.EncodeToString(v.Value[i])
+		}
+		return out
+	case *types.AttributeValueMemberL:
+		out := make([]any, len(v.Value))
+		for i := range v.Value {
+			out[i] = toPlain(v.Value[i])
+		}
+		return out
+	case *types.AttributeValueMemberM:
+		return toPlainMap(v.Value)
+	default:
+		return nil
+	}
+}
+
+func toPlainMap(item map[string]types.AttributeValue) map[string]any {
+	out := make(map[string]any, len(item))
+	for k, v := range item {
+		out[k] = toPlain(v)
+	}
+	return out
+}
+
+func fromPlain(v any) (types.AttributeValue, error) {
+	switch v := v.(type) {
+	case string:
+		return &types.AttributeValueMemberS{Value: v}, nil
+	case json.Number:
+		return &types.AttributeValueMemberN{Value: v.String()}, nil
+	case bool:
+		return &types.AttributeValueMemberBOOL{Value: v}, nil
+	case nil:
+		return &types.AttributeValueMemberNULL{Value: true}, nil
+	case []any:
+		out := make([]types.AttributeValue, len(v))
+		for i := range v {
+			av, err := fromPlain(v[i])
+			if err != nil {
+				return nil, err
+			}
+			out[i] = av
+		}
+		return &types.AttributeValueMemberL{Value: out}, nil
+	case map[string]any:
+		m, err := fromPlainMap(v)
+		if err != nil {
+			return nil, err
+		}
+		return &types.AttributeValueMemberM{Value: m}, nil
+	default:
+		return nil, fmt.Errorf("unsupported JSON value %T", v)
+	}
+}
+
+func fromPlainMap(raw map[string]any) (map[string]types.AttributeValue, error) {
+	out := make(map[string]types.AttributeValue, len(raw))
+	for k, v := range raw {
+		av, err := fromPlain(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		out[k] = av
+	}
+	return out, nil
+}
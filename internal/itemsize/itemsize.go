@@ -0,0 +1,75 @@
+// Package itemsize computes the sizes DynamoDB counts for items, which limit items to 400 KB and determine
+// the capacity units reads and writes consume.
+package itemsize
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Of returns the size of an item: the lengths of the attribute names plus the sizes of the values.
+func Of(item map[string]types.AttributeValue) int {
+	size := 0
+	for name, av := range item {
+		size += len(name) + Value(av)
+	}
+	return size
+}
+
+// Value returns the size of an attribute value. Numbers are estimated from their significant digits.
+func Value(av types.AttributeValue) int {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value)
+	case *types.AttributeValueMemberN:
+		return numberSize(v.Value)
+	case *types.AttributeValueMemberB:
+		return len(v.Value)
+	case *types.AttributeValueMemberBOOL, *types.AttributeValueMemberNULL:
+		return 1
+	case *types.AttributeValueMemberSS:
+		size := 0
+		for _, s := range v.Value {
+			size += len(s)
+		}
+		return size
+	case *types.AttributeValueMemberNS:
+		size := 0
+		for _, n := range v.Value {
+			size += numberSize(n)
+		}
+		return size
+	case *types.AttributeValueMemberBS:
+		size := 0
+		for _, b := range v.Value {
+			size += len(b)
+		}
+		return size
+	case *types.AttributeValueMemberL:
+		// lists and maps take 3 bytes plus 1 byte per element
+		size := 3
+		for _, e := range v.Value {
+			size += 1 + Value(e)
+		}
+		return size
+	case *types.AttributeValueMemberM:
+		size := 3
+		for name, e := range v.Value {
+			size += 1 + len(name) + Value(e)
+		}
+		return size
+	default:
+		return 0
+	}
+}
+
+// numberSize is about 1 byte per 2 significant digits, plus 1 byte.
+func numberSize(n string) int {
+	mantissa, _, _ := strings.Cut(strings.ToLower(strings.TrimLeft(n, "+-")), "e")
+	digits := strings.Trim(strings.Replace(mantissa, ".", "", 1), "0")
+	if digits == "" {
+		return 1
+	}
+	return (len(digits)+1)/2 + 1
+}
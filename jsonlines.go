@@ -0,0 +1,270 @@
+package ddb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/danielwchapman/ddb/internal/avjson"
+)
+
+const (
+	// maxBatchWrites is the most items BatchWriteItem accepts.
+	maxBatchWrites = 25
+
+	// batchWriteAttempts is how many times items DynamoDB leaves unprocessed are written.
+	batchWriteAttempts = 8
+)
+
+// JSONFormat is how Export writes and Import reads items, one per line.
+type JSONFormat int
+
+const (
+	// DynamoDBJSON keeps the type of every attribute, e.g. {"PK":{"S":"USER#1"},"Age":{"N":"42"}}, so numbers,
+	// sets and binary values round trip exactly.
+	DynamoDBJSON JSONFormat = iota
+
+	// PlainJSON is easier to read and edit, e.g. {"PK":"USER#1","Age":42}. Numbers keep their exact digits,
+	// but binary values and sets have no plain JSON type, so Export fails on rows that have them, such as
+	// encrypted, compressed or signed rows.
+	PlainJSON
+)
+
+type exportOptions struct {
+	format JSONFormat
+	pk     *string
+}
+
+type ExportOption func(*exportOptions) error
+
+// WithExportFormat sets the format Export writes. The default is DynamoDBJSON.
+func WithExportFormat(format JSONFormat) ExportOption {
+	return func(o *exportOptions) error {
+		o.format = format
+		return nil
+	}
+}
+
+// WithExportPartition makes Export query the rows with partition key pk instead of scanning the table.
+func WithExportPartition(pk string) ExportOption {
+	return func(o *exportOptions) error {
+		if pk == "" {
+			return &InvalidArgumentError{err: errors.New("partition key cannot be empty")}
+		}
+		o.pk = &pk
+		return nil
+	}
+}
+
+// Export writes the rows of the table, or of one partition, to w as JSON Lines. Rows are written as they are
+// stored, so encrypted, compressed, expired and soft deleted rows are exported as they are. It returns the
+// number of rows written, which on error are the rows before the one that failed.
+func (c *Client) Export(ctx context.Context, w io.Writer, opts ...ExportOption) (count int, err error) {
+	var exportOpts exportOptions
+	for _, opt := range opts {
+		if err := opt(&exportOpts); err != nil {
+			return 0, fmt.Errorf("Export: %w", err)
+		}
+	}
+
+	marshal := avjson.MarshalItem
+	if exportOpts.format == PlainJSON {
+		marshal = avjson.MarshalPlainItem
+	}
+	check := func(map[string]types.AttributeValue) error { return nil }
+	if exportOpts.format == PlainJSON {
+		check = avjson.CheckPlainItem
+	}
+
+	var query *dynamodb.QueryInput
+	if exportOpts.pk != nil {
+		expr, err := expression.NewBuilder().
+			WithKeyCondition(expression.Key(defaultPK).Equal(expression.Value(*exportOpts.pk))).
+			Build()
+		if err != nil {
+			return 0, fmt.Errorf("Export: expression builder: %w", err)
+		}
+		query = &dynamodb.QueryInput{
+			TableName:                 &c.Table,
+			KeyConditionExpression:    expr.KeyCondition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		}
+	}
+
+	// the rows written before an error are flushed too, so that they match the count
+	out := bufio.NewWriter(w)
+	defer func() {
+		if flushErr := out.Flush(); flushErr != nil && err == nil {
+			err = fmt.Errorf("Export: %w", flushErr)
+		}
+	}()
+
+	var startKey map[string]types.AttributeValue
+	for {
+		var (
+			items   []map[string]types.AttributeValue
+			lastKey map[string]types.AttributeValue
+		)
+		if query != nil {
+			query.ExclusiveStartKey = startKey
+			page, err := c.Ddb.Query(ctx, query, c.rateLimit(ctx)...)
+			if err != nil {
+				return count, fmt.Errorf("Export: Query: %w", err)
+			}
+			items, lastKey = page.Items, page.LastEvaluatedKey
+		} else {
+			page, err := c.Ddb.Scan(ctx, &dynamodb.ScanInput{
+				TableName:         &c.Table,
+				ExclusiveStartKey: startKey,
+			}, c.rateLimit(ctx)...)
+			if err != nil {
+				return count, fmt.Errorf("Export: Scan: %w", err)
+			}
+			items, lastKey = page.Items, page.LastEvaluatedKey
+		}
+
+		for _, item := range items {
+			if err := check(item); err != nil {
+				key, _ := avjson.MarshalPlainItem(map[string]types.AttributeValue{defaultPK: item[defaultPK], defaultSK: item[defaultSK]})
+				return count, &InvalidArgumentError{err: fmt.Errorf("Export: row %s: %w", key, err)}
+			}
+			line, err := marshal(item)
+			if err != nil {
+				return count, &InternalError{err: fmt.Errorf("Export: %w", err)}
+			}
+			if _, err := out.Write(append(line, '\n')); err != nil {
+				return count, fmt.Errorf("Export: %w", err)
+			}
+			count++
+		}
+
+		if len(lastKey) == 0 {
+			break
+		}
+		startKey = lastKey
+	}
+
+	return count, nil
+}
+
+type importOptions struct {
+	format JSONFormat
+}
+
+type ImportOption func(*importOptions) error
+
+// WithImportFormat sets the format Import reads. The default is DynamoDBJSON.
+func WithImportFormat(format JSONFormat) ImportOption {
+	return func(o *importOptions) error {
+		o.format = format
+		return nil
+	}
+}
+
+// Import writes the rows read from r as JSON Lines, such as the output of Export, to the table with batch
+// writes. Existing rows with the same keys are replaced. Blank lines are skipped. It returns the number of
+// rows written, which on error are the rows before the batch that failed.
+func (c *Client) Import(ctx context.Context, r io.Reader, opts ...ImportOption) (int, error) {
+	var importOpts importOptions
+	for _, opt := range opts {
+		if err := opt(&importOpts); err != nil {
+			return 0, fmt.Errorf("Import: %w", err)
+		}
+	}
+
+	unmarshal := avjson.UnmarshalItem
+	if importOpts.format == PlainJSON {
+		unmarshal = avjson.UnmarshalPlainItem
+	}
+
+	var (
+		in    = bufio.NewReader(r)
+		batch []types.WriteRequest
+		keys  = map[string]bool{}
+		count int
+	)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := c.batchWrite(ctx, batch); err != nil {
+			return err
+		}
+		count += len(batch)
+		batch, keys = batch[:0], map[string]bool{}
+		return nil
+	}
+
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := in.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return count, fmt.Errorf("Import: %w", err)
+		}
+		eof := err != nil
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			item, err := unmarshal(line)
+			if err != nil {
+				return count, &InvalidArgumentError{err: fmt.Errorf("Import: line %d: %w", lineNumber, err)}
+			}
+
+			// a batch cannot write the same key twice
+			key, err := avjson.MarshalItem(map[string]types.AttributeValue{defaultPK: item[defaultPK], defaultSK: item[defaultSK]})
+			if err != nil {
+				return count, &InvalidArgumentError{err: fmt.Errorf("Import: line %d: %w", lineNumber, err)}
+			}
+			if keys[string(key)] || len(batch) == maxBatchWrites {
+				if err := flush(); err != nil {
+					return count, fmt.Errorf("Import: %w", err)
+				}
+			}
+			keys[string(key)] = true
+			batch = append(batch, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+		}
+
+		if eof {
+			break
+		}
+	}
+
+	if err := flush(); err != nil {
+		return count, fmt.Errorf("Import: %w", err)
+	}
+	return count, nil
+}
+
+// batchWrite writes up to 25 requests, writing unprocessed requests again with backoff.
+func (c *Client) batchWrite(ctx context.Context, requests []types.WriteRequest) error {
+	backoff := 10 * time.Millisecond
+	for attempt := 0; len(requests) > 0; attempt++ {
+		if attempt == batchWriteAttempts {
+			return &InternalError{err: fmt.Errorf("BatchWriteItem: %d items unprocessed after %d attempts", len(requests), attempt)}
+		}
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			backoff *= 2
+		}
+
+		resp, err := c.Ddb.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{c.Table: requests},
+		}, c.rateLimit(ctx)...)
+		if err != nil {
+			return fmt.Errorf("BatchWriteItem: %w", err)
+		}
+		requests = resp.UnprocessedItems[c.Table]
+	}
+	return nil
+}
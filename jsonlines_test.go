@@ -0,0 +1,171 @@
+package ddb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExportImport(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	source, _ := newTestClient(t, TableSpec{}, nil)
+
+	typed := map[string]types.AttributeValue{
+		"PK":     &types.AttributeValueMemberS{Value: "TYPES"},
+		"SK":     &types.AttributeValueMemberS{Value: "A"},
+		"Big":    &types.AttributeValueMemberN{Value: "123456789012345678901234567890.000001"},
+		"Binary": &types.AttributeValueMemberB{Value: []byte{0, 1, 2, 255}},
+		"Bool":   &types.AttributeValueMemberBOOL{Value: true},
+		"Null":   &types.AttributeValueMemberNULL{Value: true},
+		"SS":     &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+		"NS":     &types.AttributeValueMemberNS{Value: []string{"1", "2.5"}},
+		"BS":     &types.AttributeValueMemberBS{Value: [][]byte{{1}, {2}}},
+		"List":   &types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberN{Value: "1"}}},
+		"Map":    &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{"n": &types.AttributeValueMemberS{Value: "v"}}},
+	}
+	if _, err := source.Ddb.PutItem(ctx, &dynamodb.PutItemInput{TableName: &source.Table, Item: typed}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 60; i++ {
+		row := RowHeader{PK: fmt.Sprintf("ROW#%d", i%3), SK: fmt.Sprintf("%02d", i), RowType: "ROW"}
+		if err := source.Put(ctx, row); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	t.Run("DynamoDB JSON round trip", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := source.Export(ctx, &buf)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n != 61 || strings.Count(buf.String(), "\n") != 61 {
+			t.Errorf("expected 61 rows, got: %d", n)
+		}
+
+		target, _ := newTestClient(t, TableSpec{}, nil)
+		if n, err := target.Import(ctx, &buf); err != nil || n != 61 {
+			t.Fatalf("expected 61 rows, got: %d, %v", n, err)
+		}
+
+		got := rawItem(t, target, "TYPES", "A")
+		if diff := cmp.Diff(typed, got, cmp.AllowUnexported(
+			types.AttributeValueMemberS{}, types.AttributeValueMemberN{}, types.AttributeValueMemberB{},
+			types.AttributeValueMemberBOOL{}, types.AttributeValueMemberNULL{}, types.AttributeValueMemberSS{},
+			types.AttributeValueMemberNS{}, types.AttributeValueMemberBS{}, types.AttributeValueMemberL{},
+			types.AttributeValueMemberM{},
+		)); diff != "" {
+			t.Errorf("unexpected diff: %s", diff)
+		}
+	})
+
+	t.Run("partition as plain JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := source.Export(ctx, &buf, WithExportPartition("ROW#1"), WithExportFormat(PlainJSON))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n != 20 {
+			t.Errorf("expected 20 rows, got: %d", n)
+		}
+		first, _, _ := strings.Cut(buf.String(), "\n")
+		if first != `{"PK":"ROW#1","RowType":"ROW","SK":"01"}` {
+			t.Errorf("unexpected line: %s", first)
+		}
+
+		target, _ := newTestClient(t, TableSpec{}, nil)
+		if n, err := target.Import(ctx, &buf, WithImportFormat(PlainJSON)); err != nil || n != 20 {
+			t.Fatalf("expected 20 rows, got: %d, %v", n, err)
+		}
+		var got RowHeader
+		if err := target.Get(ctx, "ROW#1", "58", &got); err != nil || got.RowType != "ROW" {
+			t.Errorf("unexpected row: %+v, %v", got, err)
+		}
+	})
+
+	t.Run("plain JSON cannot keep binary values and sets", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := source.Export(ctx, &buf, WithExportPartition("TYPES"), WithExportFormat(PlainJSON))
+		var invalidArgumentErr *InvalidArgumentError
+		if !errors.As(err, &invalidArgumentErr) {
+			t.Errorf("expected InvalidArgumentError, got: %v", err)
+		}
+
+		encrypted, _ := newTestClient(t, TableSpec{}, withEncryption(true))
+		row := encryptedRow{RowHeader: RowHeader{PK: "USER#1", SK: "PROFILE", RowType: "PROFILE"}, Email: "ada@example.com"}
+		if err := encrypted.Put(ctx, row); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := encrypted.Export(ctx, &buf, WithExportFormat(PlainJSON)); !errors.As(err, &invalidArgumentErr) {
+			t.Errorf("expected InvalidArgumentError, got: %v", err)
+		}
+	})
+
+	t.Run("failed plain JSON export keeps earlier rows", func(t *testing.T) {
+		client, _ := newTestClient(t, TableSpec{}, nil)
+		for _, sk := range []string{"1", "2"} {
+			if err := client.Put(ctx, RowHeader{PK: "MIXED", SK: sk, RowType: "ROW"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		binary := map[string]types.AttributeValue{
+			"PK":     &types.AttributeValueMemberS{Value: "MIXED"},
+			"SK":     &types.AttributeValueMemberS{Value: "3"},
+			"Binary": &types.AttributeValueMemberB{Value: []byte{1}},
+		}
+		if _, err := client.Ddb.PutItem(ctx, &dynamodb.PutItemInput{TableName: &client.Table, Item: binary}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var buf bytes.Buffer
+		n, err := client.Export(ctx, &buf, WithExportPartition("MIXED"), WithExportFormat(PlainJSON))
+		var invalidArgumentErr *InvalidArgumentError
+		if !errors.As(err, &invalidArgumentErr) {
+			t.Errorf("expected InvalidArgumentError, got: %v", err)
+		}
+		if n != 2 || strings.Count(buf.String(), "\n") != 2 {
+			t.Errorf("expected the 2 rows before the failed row, got: %d, %q", n, buf.String())
+		}
+	})
+
+	t.Run("plain JSON keeps numbers exact", func(t *testing.T) {
+		target, _ := newTestClient(t, TableSpec{}, nil)
+		input := "{\"PK\":\"N\",\"SK\":\"1\",\"Big\":123456789012345678901234567890}\n\n"
+		if _, err := target.Import(ctx, strings.NewReader(input), WithImportFormat(PlainJSON)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if big, ok := rawItem(t, target, "N", "1")["Big"].(*types.AttributeValueMemberN); !ok || big.Value != "123456789012345678901234567890" {
+			t.Errorf("unexpected number: %#v", big)
+		}
+	})
+
+	t.Run("duplicate keys", func(t *testing.T) {
+		target, _ := newTestClient(t, TableSpec{}, nil)
+		input := `{"PK":{"S":"D"},"SK":{"S":"1"},"V":{"N":"1"}}` + "\n" + `{"PK":{"S":"D"},"SK":{"S":"1"},"V":{"N":"2"}}`
+		if n, err := target.Import(ctx, strings.NewReader(input)); err != nil || n != 2 {
+			t.Fatalf("expected 2 rows, got: %d, %v", n, err)
+		}
+		if v, ok := rawItem(t, target, "D", "1")["V"].(*types.AttributeValueMemberN); !ok || v.Value != "2" {
+			t.Errorf("expected the last row to win, got: %#v", v)
+		}
+	})
+
+	t.Run("invalid line", func(t *testing.T) {
+		target, _ := newTestClient(t, TableSpec{}, nil)
+		input := `{"PK":{"S":"D"},"SK":{"S":"1"}}` + "\n" + `not json`
+		_, err := target.Import(ctx, strings.NewReader(input))
+		var invalidArgumentErr *InvalidArgumentError
+		if !errors.As(err, &invalidArgumentErr) || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("expected InvalidArgumentError for line 2, got: %v", err)
+		}
+	})
+}
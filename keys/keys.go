@@ -0,0 +1,236 @@
+// Package keys builds and parses the delimited composite keys used in Single Table Design, for example
+// "ORDER#2024-03-05T10:00:00Z#01HQ3Z...".
+package keys
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielwchapman/ddb"
+)
+
+const (
+	// DefaultDelimiter separates key segments unless a Codec specifies otherwise.
+	DefaultDelimiter = '#'
+
+	escapeChar = '\\'
+
+	// SortableTimeFormat is a fixed width, UTC, nanosecond precision layout. Keys built with it sort
+	// lexicographically in chronological order.
+	SortableTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+	// maxChar sorts after any byte that can appear in a key. It is appended to the end of an inclusive
+	// range so that every key beginning with the range end is included.
+	maxChar = "\U0010FFFF"
+)
+
+// Precision is the granularity of a TimePrefix segment.
+type Precision int
+
+const (
+	Year Precision = iota
+	Month
+	Day
+	Hour
+	Minute
+	Second
+)
+
+var precisionLayouts = map[Precision]string{
+	Year:   "2006",
+	Month:  "2006-01",
+	Day:    "2006-01-02",
+	Hour:   "2006-01-02T15",
+	Minute: "2006-01-02T15:04",
+	Second: "2006-01-02T15:04:05",
+}
+
+// Segment is one typed part of a composite key.
+type Segment struct {
+	value string
+
+	// partial segments are a prefix of a full segment value (e.g. "2024-03" of a timestamp). A key prefix
+	// ending in a partial segment is not terminated with a delimiter.
+	partial bool
+}
+
+// String is a free-form segment. Delimiters within s are escaped.
+func String(s string) Segment {
+	return Segment{value: s}
+}
+
+// Int is a zero-padded integer segment, so that keys sort numerically. Only non-negative values that fit
+// within width digits sort correctly.
+func Int(n int64, width int) Segment {
+	return Segment{value: fmt.Sprintf("%0*d", width, n)}
+}
+
+// Time is an RFC3339 segment with second precision in UTC.
+func Time(t time.Time) Segment {
+	return Segment{value: t.UTC().Format(time.RFC3339)}
+}
+
+// SortableTime is a fixed width segment with nanosecond precision in UTC. See SortableTimeFormat.
+func SortableTime(t time.Time) Segment {
+	return Segment{value: t.UTC().Format(SortableTimeFormat)}
+}
+
+// TimePrefix is a partial segment that matches every Time or SortableTime segment within the same period,
+// e.g. TimePrefix(t, Month) matches all timestamps in the month of t.
+func TimePrefix(t time.Time, p Precision) Segment {
+	layout, ok := precisionLayouts[p]
+	if !ok {
+		layout = precisionLayouts[Second]
+	}
+	return Segment{value: t.UTC().Format(layout), partial: true}
+}
+
+// ULID is a segment for a ULID in its canonical 26 character form. See NewULID.
+func ULID(id string) Segment {
+	return Segment{value: strings.ToUpper(id)}
+}
+
+// Codec builds and parses keys with a specific delimiter.
+type Codec struct {
+	Delimiter rune
+}
+
+// Default is the Codec used by the package level functions.
+var Default = Codec{Delimiter: DefaultDelimiter}
+
+// Build joins segments into a key.
+func Build(segments ...Segment) string {
+	return Default.Build(segments...)
+}
+
+// Parse splits a key into its unescaped segments.
+func Parse(key string) (Parts, error) {
+	return Default.Parse(key)
+}
+
+// Prefix joins segments into a key prefix. See Codec.Prefix.
+func Prefix(segments ...Segment) string {
+	return Default.Prefix(segments...)
+}
+
+// SkBeginsWith is a ddb.KeyCondition matching every sort key under the prefix built from segments.
+func SkBeginsWith(pk string, segments ...Segment) ddb.KeyCondition {
+	return Default.SkBeginsWith(pk, segments...)
+}
+
+// SkBetween is a ddb.KeyCondition matching sort keys under prefix, from start to end inclusive.
+func SkBetween(pk string, prefix []Segment, start, end Segment) ddb.KeyCondition {
+	return Default.SkBetween(pk, prefix, start, end)
+}
+
+func (c Codec) delimiter() rune {
+	if c.Delimiter == 0 {
+		return DefaultDelimiter
+	}
+	return c.Delimiter
+}
+
+func (c Codec) Build(segments ...Segment) string {
+	var builder strings.Builder
+	for i, segment := range segments {
+		if i > 0 {
+			builder.WriteRune(c.delimiter())
+		}
+		c.writeEscaped(&builder, segment.value)
+	}
+	return builder.String()
+}
+
+// Prefix joins segments and terminates the result with a delimiter, so that "ORDER" does not also match
+// "ORDERS". If the last segment is partial, the delimiter is omitted.
+func (c Codec) Prefix(segments ...Segment) string {
+	key := c.Build(segments...)
+	if len(segments) == 0 || segments[len(segments)-1].partial {
+		return key
+	}
+	return key + string(c.delimiter())
+}
+
+func (c Codec) Parse(key string) (Parts, error) {
+	var (
+		parts   Parts
+		current strings.Builder
+		escaped bool
+	)
+
+	for _, r := range key {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == escapeChar:
+			escaped = true
+		case r == c.delimiter():
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	if escaped {
+		return nil, errors.New("Parse: key ends with a dangling escape character")
+	}
+
+	return append(parts, current.String()), nil
+}
+
+func (c Codec) SkBeginsWith(pk string, segments ...Segment) ddb.KeyCondition {
+	return ddb.KeySkBeginsWith(pk, c.Prefix(segments...))
+}
+
+// SkBetween matches sort keys under prefix, from start to end inclusive. A partial end segment includes
+// every key that begins with it, so SkBetween(pk, p, TimePrefix(jan, Month), TimePrefix(mar, Month))
+// covers January through the end of March.
+func (c Codec) SkBetween(pk string, prefix []Segment, start, end Segment) ddb.KeyCondition {
+	startKey := c.Build(append(prefix[:len(prefix):len(prefix)], start)...)
+	endKey := c.Build(append(prefix[:len(prefix):len(prefix)], end)...)
+	if end.partial {
+		endKey += maxChar
+	}
+	return ddb.KeySkBetween(pk, startKey, endKey)
+}
+
+func (c Codec) writeEscaped(builder *strings.Builder, value string) {
+	for _, r := range value {
+		if r == c.delimiter() || r == escapeChar {
+			builder.WriteRune(escapeChar)
+		}
+		builder.WriteRune(r)
+	}
+}
+
+// Parts are the unescaped segments of a parsed key.
+type Parts []string
+
+func (p Parts) String(i int) string {
+	if i < 0 || i >= len(p) {
+		return ""
+	}
+	return p[i]
+}
+
+func (p Parts) Int(i int) (int64, error) {
+	n, err := strconv.ParseInt(p.String(i), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Parts.Int: %w", err)
+	}
+	return n, nil
+}
+
+// Time parses a segment built with Time or SortableTime.
+func (p Parts) Time(i int) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, p.String(i))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Parts.Time: %w", err)
+	}
+	return t, nil
+}
@@ -0,0 +1,106 @@
+package keys
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuildParse(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2024, time.March, 5, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		segments []Segment
+		want     string
+		parts    Parts
+	}{
+		{
+			name:     "typed segments",
+			segments: []Segment{String("ORDER"), Int(42, 6), Time(ts)},
+			want:     "ORDER#000042#2024-03-05T10:30:00Z",
+			parts:    Parts{"ORDER", "000042", "2024-03-05T10:30:00Z"},
+		},
+		{
+			name:     "sortable time",
+			segments: []Segment{String("LOG"), SortableTime(ts)},
+			want:     "LOG#2024-03-05T10:30:00.000000000Z",
+			parts:    Parts{"LOG", "2024-03-05T10:30:00.000000000Z"},
+		},
+		{
+			name:     "escaped delimiter",
+			segments: []Segment{String("USER"), String(`a#b\c`)},
+			want:     `USER#a\#b\\c`,
+			parts:    Parts{"USER", `a#b\c`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Build(tt.segments...)
+			if got != tt.want {
+				t.Errorf("Build: got %q, want %q", got, tt.want)
+			}
+
+			parts, err := Parse(got)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.parts, parts); diff != "" {
+				t.Errorf("unexpected diff: %s", diff)
+			}
+		})
+	}
+
+	t.Run("dangling escape", func(t *testing.T) {
+		if _, err := Parse(`USER\`); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+}
+
+func TestPrefix(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2024, time.March, 5, 10, 30, 0, 0, time.UTC)
+
+	if got, want := Prefix(String("ORDER")), "ORDER#"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got, want := Prefix(String("ORDER"), TimePrefix(ts, Month)), "ORDER#2024-03"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNewULID(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, time.March, 5, 10, 30, 0, 0, time.UTC)
+
+	var ids []string
+	for i := 0; i < 10; i++ {
+		id, err := NewULID(start.Add(time.Duration(i) * time.Millisecond))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if !sort.StringsAreSorted(ids) {
+		t.Errorf("expected ULIDs to sort in creation order: %v", ids)
+	}
+
+	got, err := ULIDTime(ids[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.Equal(start) {
+		t.Errorf("got %v, want %v", got, start)
+	}
+}
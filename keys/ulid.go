@@ -0,0 +1,69 @@
+package keys
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// crockford is the Crockford base32 alphabet used by ULIDs. It sorts in the same order as the values it
+// encodes.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+const ulidLen = 26
+
+// NewULID returns a ULID: a 48 bit millisecond timestamp followed by 80 random bits, encoded as 26
+// characters of Crockford base32. ULIDs created in different milliseconds sort in creation order.
+func NewULID(t time.Time) (string, error) {
+	var id [16]byte
+
+	ms := uint64(t.UnixMilli())
+	for i := 5; i >= 0; i-- {
+		id[i] = byte(ms)
+		ms >>= 8
+	}
+
+	if _, err := rand.Read(id[6:]); err != nil {
+		return "", fmt.Errorf("NewULID: rand.Read: %w", err)
+	}
+
+	// 128 bits encoded 5 bits at a time, most significant first, with 2 bits of leading padding.
+	var out [ulidLen]byte
+	for i := ulidLen - 1; i >= 0; i-- {
+		bit := (ulidLen - 1 - i) * 5
+		var v byte
+		for b := 0; b < 5; b++ {
+			pos := bit + b
+			if pos >= 128 {
+				break
+			}
+			if id[15-pos/8]&(1<<(pos%8)) != 0 {
+				v |= 1 << b
+			}
+		}
+		out[i] = crockford[v]
+	}
+
+	return string(out[:]), nil
+}
+
+// ULIDTime returns the timestamp encoded in a ULID.
+func ULIDTime(id string) (time.Time, error) {
+	if len(id) != ulidLen {
+		return time.Time{}, errors.New("ULIDTime: invalid length")
+	}
+
+	// the first 10 characters hold the 48 bit timestamp (50 bits with padding).
+	var ms uint64
+	for _, c := range strings.ToUpper(id[:10]) {
+		v := strings.IndexRune(crockford, c)
+		if v < 0 {
+			return time.Time{}, fmt.Errorf("ULIDTime: invalid character %q", c)
+		}
+		ms = ms<<5 | uint64(v)
+	}
+
+	return time.UnixMilli(int64(ms)), nil
+}
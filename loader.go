@@ -0,0 +1,203 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// DefaultLoaderWait is how long a Loader collects Gets before reading them when Loader.Wait is zero.
+	DefaultLoaderWait = 2 * time.Millisecond
+
+	// maxBatchGetKeys is the most keys BatchGetItem accepts.
+	maxBatchGetKeys = 100
+
+	// batchGetAttempts is how many times keys DynamoDB leaves unprocessed are requested.
+	batchGetAttempts = 8
+)
+
+// Loader is a Getter that collects the Gets made at about the same time, e.g. by the resolvers of one GraphQL
+// request, and reads them with a single BatchGetItem. A batch is read once Wait has passed since its first Get,
+// or as soon as it holds MaxBatch keys. Gets for the same key in a batch are read once.
+//
+// Gets are otherwise the same as Client.GetWithOptions. WithConsistentRead is honoured by batching consistent
+// Gets separately.
+type Loader struct {
+	Client *Client
+
+	// Wait is how long a batch collects Gets. Zero uses DefaultLoaderWait.
+	Wait time.Duration
+
+	// MaxBatch is the most keys in a batch. Zero, or more than 100, uses 100.
+	MaxBatch int
+
+	once    sync.Once
+	mu      sync.Mutex
+	pending map[bool]*loaderBatch
+}
+
+var _ GetterWithOptions = (*Loader)(nil)
+
+type loaderKey struct {
+	pk, sk string
+}
+
+// loaderBatch is a set of keys read together. items and err are set before done is closed.
+type loaderBatch struct {
+	consistent bool
+	keys       []loaderKey
+	seen       map[loaderKey]bool
+	done       chan struct{}
+	items      map[loaderKey]map[string]types.AttributeValue
+	err        error
+}
+
+func (l *Loader) init() {
+	l.once.Do(func() {
+		if l.Wait == 0 {
+			l.Wait = DefaultLoaderWait
+		}
+		if l.MaxBatch <= 0 || l.MaxBatch > maxBatchGetKeys {
+			l.MaxBatch = maxBatchGetKeys
+		}
+		l.pending = map[bool]*loaderBatch{}
+	})
+}
+
+func (l *Loader) Get(ctx context.Context, pk, sk string, out any) error {
+	return l.GetWithOptions(ctx, pk, sk, out)
+}
+
+// GetWithOptions is Get with options.
+func (l *Loader) GetWithOptions(ctx context.Context, pk, sk string, out any, opts ...Option) error {
+	l.init()
+
+	var getOptions options
+	for _, opt := range opts {
+		if err := opt(&getOptions); err != nil {
+			return fmt.Errorf("Get: %w", err)
+		}
+	}
+
+	key := loaderKey{pk: pk, sk: sk}
+	batch := l.add(ctx, key, getOptions.consistent)
+
+	select {
+	case <-batch.done:
+	case <-ctx.Done():
+		return fmt.Errorf("Get: %w", ctx.Err())
+	}
+	if batch.err != nil {
+		return fmt.Errorf("Get: %w", batch.err)
+	}
+
+	// the item is shared by every Get of the key in the batch
+	shared := batch.items[key]
+	item := make(map[string]types.AttributeValue, len(shared))
+	for name, av := range shared {
+		item[name] = av
+	}
+	return l.Client.readItem(ctx, item, out, &getOptions)
+}
+
+// add puts key in the pending batch and returns the batch.
+func (l *Loader) add(ctx context.Context, key loaderKey, consistent bool) *loaderBatch {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	batch := l.pending[consistent]
+	if batch == nil {
+		batch = &loaderBatch{consistent: consistent, seen: map[loaderKey]bool{}, done: make(chan struct{})}
+		l.pending[consistent] = batch
+		time.AfterFunc(l.Wait, func() {
+			l.dispatch(context.WithoutCancel(ctx), batch)
+		})
+	}
+
+	if !batch.seen[key] {
+		batch.seen[key] = true
+		batch.keys = append(batch.keys, key)
+	}
+	if len(batch.keys) == l.MaxBatch {
+		delete(l.pending, consistent)
+		go l.read(context.WithoutCancel(ctx), batch)
+	}
+	return batch
+}
+
+// dispatch reads a batch when its wait is over, unless it was already read because it filled up.
+func (l *Loader) dispatch(ctx context.Context, batch *loaderBatch) {
+	l.mu.Lock()
+	if l.pending[batch.consistent] != batch {
+		l.mu.Unlock()
+		return
+	}
+	delete(l.pending, batch.consistent)
+	l.mu.Unlock()
+
+	l.read(ctx, batch)
+}
+
+func (l *Loader) read(ctx context.Context, batch *loaderBatch) {
+	batch.items, batch.err = l.Client.batchGet(ctx, batch.keys, batch.consistent)
+	close(batch.done)
+}
+
+// batchGet reads up to 100 keys, requesting unprocessed keys again with backoff. Missing keys are left out
+// of the result.
+func (c *Client) batchGet(ctx context.Context, keys []loaderKey, consistent bool) (map[loaderKey]map[string]types.AttributeValue, error) {
+	request := make([]map[string]types.AttributeValue, len(keys))
+	for i, key := range keys {
+		request[i] = map[string]types.AttributeValue{
+			defaultPK: &types.AttributeValueMemberS{Value: key.pk},
+			defaultSK: &types.AttributeValueMemberS{Value: key.sk},
+		}
+	}
+
+	items := make(map[loaderKey]map[string]types.AttributeValue, len(keys))
+	backoff := 10 * time.Millisecond
+	for attempt := 0; len(request) > 0; attempt++ {
+		if attempt == batchGetAttempts {
+			return nil, &InternalError{err: fmt.Errorf("BatchGetItem: %d keys unprocessed after %d attempts", len(request), attempt)}
+		}
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			backoff *= 2
+		}
+
+		var consistentRead *bool
+		if consistent {
+			consistentRead = &consistent
+		}
+		resp, err := c.Ddb.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{
+				c.Table: {Keys: request, ConsistentRead: consistentRead},
+			},
+		}, c.rateLimit(ctx)...)
+		if err != nil {
+			return nil, fmt.Errorf("BatchGetItem: %w", err)
+		}
+
+		for _, item := range resp.Responses[c.Table] {
+			pk, pkOk := item[defaultPK].(*types.AttributeValueMemberS)
+			sk, skOk := item[defaultSK].(*types.AttributeValueMemberS)
+			if !pkOk || !skOk {
+				return nil, &InternalError{err: errors.New("BatchGetItem: item without a string PK and SK")}
+			}
+			items[loaderKey{pk: pk.Value, sk: sk.Value}] = item
+		}
+		request = resp.UnprocessedKeys[c.Table].Keys
+	}
+
+	return items, nil
+}
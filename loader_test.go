@@ -0,0 +1,131 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// operationCounter counts the requests made for each DynamoDB operation.
+type operationCounter struct {
+	next   dynamodb.HTTPClient
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *operationCounter) Do(req *http.Request) (*http.Response, error) {
+	_, operation, _ := strings.Cut(req.Header.Get("X-Amz-Target"), ".")
+	c.mu.Lock()
+	c.counts[operation]++
+	c.mu.Unlock()
+	return c.next.Do(req)
+}
+
+func (c *operationCounter) count(operation string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[operation]
+}
+
+type loaderRow struct {
+	RowHeader
+	Value int
+}
+
+func TestLoader(t *testing.T) {
+	t.Parallel()
+
+	client, server := newTestClient(t, TableSpec{}, nil)
+	ctx := context.Background()
+	counter := &operationCounter{counts: map[string]int{}}
+	client.Ddb = server.DynamoDB(func(o *dynamodb.Options) {
+		counter.next = o.HTTPClient
+		if counter.next == nil {
+			counter.next = http.DefaultClient
+		}
+		o.HTTPClient = counter
+	})
+	for i := 0; i < 5; i++ {
+		row := loaderRow{RowHeader: RowHeader{PK: fmt.Sprintf("ITEM#%d", i), SK: "A", RowType: "ITEM"}, Value: i}
+		if err := client.Put(ctx, row); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	get := func(loader *Loader, ids []int) []error {
+		errs := make([]error, len(ids))
+		var wg sync.WaitGroup
+		for i, id := range ids {
+			wg.Add(1)
+			go func(i, id int) {
+				defer wg.Done()
+				var got loaderRow
+				err := loader.Get(ctx, fmt.Sprintf("ITEM#%d", id), "A", &got)
+				if err == nil && got.Value != id {
+					err = fmt.Errorf("expected %d, got: %+v", id, got)
+				}
+				errs[i] = err
+			}(i, id)
+		}
+		wg.Wait()
+		return errs
+	}
+
+	t.Run("concurrent Gets are batched", func(t *testing.T) {
+		loader := &Loader{Client: client, Wait: 20 * time.Millisecond}
+		before := counter.count("BatchGetItem")
+
+		errs := get(loader, []int{0, 1, 2, 2, 3, 9})
+		for i, err := range errs[:5] {
+			if err != nil {
+				t.Errorf("unexpected error for Get %d: %v", i, err)
+			}
+		}
+		if !errors.Is(errs[5], ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got: %v", errs[5])
+		}
+
+		if n := counter.count("BatchGetItem") - before; n != 1 {
+			t.Errorf("expected 1 BatchGetItem, got: %d", n)
+		}
+	})
+
+	t.Run("full batches are read at once", func(t *testing.T) {
+		loader := &Loader{Client: client, Wait: time.Hour, MaxBatch: 2}
+		before := counter.count("BatchGetItem")
+
+		for i, err := range get(loader, []int{0, 1, 2, 3}) {
+			if err != nil {
+				t.Errorf("unexpected error for Get %d: %v", i, err)
+			}
+		}
+		if n := counter.count("BatchGetItem") - before; n != 2 {
+			t.Errorf("expected 2 BatchGetItems, got: %d", n)
+		}
+	})
+
+	t.Run("consistent reads", func(t *testing.T) {
+		loader := &Loader{Client: client}
+		var got loaderRow
+		if err := loader.GetWithOptions(ctx, "ITEM#4", "A", &got, WithConsistentRead()); err != nil || got.Value != 4 {
+			t.Errorf("unexpected row: %+v, %v", got, err)
+		}
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		loader := &Loader{Client: client, Wait: time.Hour}
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		var got loaderRow
+		if err := loader.Get(ctx, "ITEM#4", "A", &got); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,372 @@
+// Package lock implements leases on a DynamoDB table, for processes that must not run concurrently.
+//
+// A lease is a row holding its owner, a record version that changes on every renewal and a fencing token
+// that increases on every acquisition. Expiry is decided without comparing clocks across machines: a
+// contender that sees the same record version for a whole lease duration, measured on its own clock, knows
+// the holder stopped renewing and may take the lease over with a write conditional on that version.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/danielwchapman/ddb"
+	"github.com/danielwchapman/ddb/keys"
+)
+
+// RowType is the RowType of lease rows.
+const RowType = "LOCK"
+
+const (
+	DefaultLeaseDuration = 20 * time.Second
+	DefaultRetryInterval = time.Second
+)
+
+var (
+	// ErrLocked is returned by TryAcquire when the lock is held by an unexpired lease.
+	ErrLocked = errors.New("lock is held")
+
+	// ErrLockLost is returned when a lease was taken over because it was not renewed in time.
+	ErrLockLost = errors.New("lock was lost")
+)
+
+type leaseRow struct {
+	ddb.RowHeader
+	Owner         string
+	Version       string
+	Fence         int64
+	LeaseDuration time.Duration
+	Released      bool
+
+	// LeaseExpiresAt is informational only, by the clock of the owner. It is never used to decide expiry. It is
+	// not named ExpiresAt, the Time to Live attribute, as deleting a lease row would reset its fencing token.
+	LeaseExpiresAt time.Time
+}
+
+// Manager acquires leases in the Client's table.
+type Manager struct {
+	Client *ddb.Client
+
+	// Owner identifies this process in lease rows. If empty, a random ID is used.
+	Owner string
+
+	// LeaseDuration is how long a lease lasts without a renewal. Zero uses DefaultLeaseDuration.
+	LeaseDuration time.Duration
+
+	// HeartbeatInterval is how often a held lease is renewed. Zero uses a third of LeaseDuration.
+	HeartbeatInterval time.Duration
+
+	// RetryInterval is how often Acquire retries while the lock is held. Zero uses DefaultRetryInterval.
+	RetryInterval time.Duration
+
+	once     sync.Once
+	mu       sync.Mutex
+	observed map[string]observation
+}
+
+// observation is the record version of a lease held by someone else and when this process first saw it.
+type observation struct {
+	version string
+	at      time.Time
+}
+
+func (m *Manager) init() {
+	m.once.Do(func() {
+		if m.Owner == "" {
+			m.Owner = newVersion()
+		}
+		if m.LeaseDuration == 0 {
+			m.LeaseDuration = DefaultLeaseDuration
+		}
+		if m.HeartbeatInterval == 0 {
+			m.HeartbeatInterval = m.LeaseDuration / 3
+		}
+		if m.RetryInterval == 0 {
+			m.RetryInterval = DefaultRetryInterval
+		}
+		m.observed = map[string]observation{}
+	})
+}
+
+func leaseKey(name string) (pk, sk string) {
+	return keys.Build(keys.String(RowType), keys.String(name)), RowType
+}
+
+// Acquire blocks until it holds the lock name or ctx is done. A lease abandoned by a crashed holder is taken
+// over once it has gone unrenewed for its lease duration.
+func (m *Manager) Acquire(ctx context.Context, name string) (*Lock, error) {
+	m.init()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		l, err := m.TryAcquire(ctx, name)
+		if !errors.Is(err, ErrLocked) {
+			return l, err
+		}
+
+		timer.Reset(m.RetryInterval)
+	}
+}
+
+// TryAcquire makes one attempt to acquire the lock name. It returns ErrLocked if the lock is held. Expiry is
+// detected across calls, so calling TryAcquire periodically also takes over abandoned leases.
+func (m *Manager) TryAcquire(ctx context.Context, name string) (*Lock, error) {
+	m.init()
+
+	pk, sk := leaseKey(name)
+
+	var current leaseRow
+	err := m.Client.Get(ctx, pk, sk, &current)
+	found := err == nil
+	if err != nil && !errors.Is(err, ddb.ErrNotFound) {
+		return nil, fmt.Errorf("TryAcquire: %w", err)
+	}
+
+	if found && !current.Released && !m.expired(name, current) {
+		return nil, ErrLocked
+	}
+
+	row := leaseRow{
+		RowHeader:      ddb.RowHeader{PK: pk, SK: sk, RowType: RowType},
+		Owner:          m.Owner,
+		Version:        newVersion(),
+		Fence:          current.Fence + 1,
+		LeaseDuration:  m.LeaseDuration,
+		LeaseExpiresAt: time.Now().Add(m.LeaseDuration).UTC(),
+	}
+
+	condition := ddb.WithItemNotExist()
+	if found {
+		condition = ddb.WithCondition(expression.Name("Version").Equal(expression.Value(current.Version)))
+	}
+
+	if err := m.Client.Put(ctx, row, condition); err != nil {
+		if isConditionFailed(err) {
+			// someone else acquired or renewed it first
+			return nil, ErrLocked
+		}
+		return nil, fmt.Errorf("TryAcquire: %w", err)
+	}
+
+	m.mu.Lock()
+	delete(m.observed, name)
+	m.mu.Unlock()
+
+	return m.start(name, row), nil
+}
+
+// expired records the version of a lease held by someone else and reports whether it has stayed unchanged
+// for the lease duration on this process's clock.
+func (m *Manager) expired(name string, row leaseRow) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	seen, ok := m.observed[name]
+	if !ok || seen.version != row.Version {
+		m.observed[name] = observation{version: row.Version, at: now}
+		return false
+	}
+
+	return now.Sub(seen.at) >= row.LeaseDuration
+}
+
+// Lock is a held lease. It is renewed in the background until it is released or lost.
+type Lock struct {
+	m     *Manager
+	name  string
+	fence int64
+
+	mu       sync.Mutex
+	version  string
+	renewed  time.Time
+	lost     chan struct{}
+	lostErr  error
+	released bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (m *Manager) start(name string, row leaseRow) *Lock {
+	l := &Lock{
+		m:       m,
+		name:    name,
+		fence:   row.Fence,
+		version: row.Version,
+		renewed: time.Now(),
+		lost:    make(chan struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go l.heartbeat()
+	return l
+}
+
+// Fence returns the fencing token of the lease. Tokens increase with every acquisition of a lock, so a
+// resource can reject writes carrying a token lower than one it has already seen.
+func (l *Lock) Fence() int64 {
+	return l.fence
+}
+
+// Lost is closed when the lease can no longer be held, because it was taken over or could not be renewed
+// within the lease duration. Work protected by the lock should stop.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *Lock) heartbeat() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.m.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), l.m.HeartbeatInterval)
+		err := l.renew(ctx)
+		cancel()
+
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrLockLost):
+			l.markLost(err)
+			return
+		default:
+			// transient errors are retried until the lease would have expired for other processes
+			l.mu.Lock()
+			expired := time.Since(l.renewed) >= l.m.LeaseDuration
+			l.mu.Unlock()
+			if expired {
+				l.markLost(fmt.Errorf("%w: %v", ErrLockLost, err))
+				return
+			}
+		}
+	}
+}
+
+// renew replaces the record version, conditional on this lease still holding the current one.
+func (l *Lock) renew(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	started := time.Now()
+	next := newVersion()
+
+	pk, sk := leaseKey(l.name)
+	err := l.m.Client.Update(ctx, pk, sk,
+		ddb.WithFieldUpdates(map[string]any{
+			"Version":        next,
+			"LeaseExpiresAt": started.Add(l.m.LeaseDuration).UTC(),
+		}),
+		ddb.WithCondition(l.heldCondition()),
+	)
+	if err != nil {
+		if isConditionFailed(err) {
+			return ErrLockLost
+		}
+		return fmt.Errorf("renew: %w", err)
+	}
+
+	l.version = next
+	l.renewed = started
+	return nil
+}
+
+// heldCondition must be called with l.mu held.
+func (l *Lock) heldCondition() expression.ConditionBuilder {
+	return expression.Name("Version").Equal(expression.Value(l.version)).
+		And(expression.Name("Owner").Equal(expression.Value(l.m.Owner)))
+}
+
+func (l *Lock) markLost(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.lostErr == nil {
+		l.lostErr = err
+		close(l.lost)
+	}
+}
+
+// Release stops renewing the lease and marks it released, so the next Acquire does not wait for it to
+// expire. The fencing token is kept in the row. Release returns ErrLockLost if the lease had been lost, and
+// nil if it was already released.
+func (l *Lock) Release(ctx context.Context) error {
+	select {
+	case <-l.stop:
+	default:
+		close(l.stop)
+	}
+	<-l.done
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.released {
+		return nil
+	}
+	if l.lostErr != nil {
+		return fmt.Errorf("Release: %w", l.lostErr)
+	}
+
+	pk, sk := leaseKey(l.name)
+	err := l.m.Client.Update(ctx, pk, sk,
+		ddb.WithFieldUpdates(map[string]any{
+			"Version":  newVersion(),
+			"Released": true,
+		}),
+		ddb.WithCondition(l.heldCondition()),
+	)
+	if err != nil {
+		if isConditionFailed(err) {
+			l.lostErr = ErrLockLost
+			close(l.lost)
+			return fmt.Errorf("Release: %w", ErrLockLost)
+		}
+		return fmt.Errorf("Release: %w", err)
+	}
+
+	l.released = true
+	l.lostErr = errors.New("lock was released")
+	close(l.lost)
+	return nil
+}
+
+// Close releases the lock. It implements io.Closer.
+func (l *Lock) Close() error {
+	return l.Release(context.Background())
+}
+
+func isConditionFailed(err error) bool {
+	var condFailedErr *types.ConditionalCheckFailedException
+	return errors.As(err, &condFailedErr)
+}
+
+func newVersion() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("lock: rand.Read: %v", err))
+	}
+	return hex.EncodeToString(b[:])
+}
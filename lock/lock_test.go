@@ -0,0 +1,171 @@
+package lock
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/danielwchapman/ddb"
+	"github.com/danielwchapman/ddb/ddblocal"
+)
+
+func newTestClient(t *testing.T) *ddb.Client {
+	t.Helper()
+
+	server := ddblocal.NewServer()
+	t.Cleanup(server.Close)
+
+	client := &ddb.Client{Ddb: server.DynamoDB(), Table: "Locks"}
+	if err := client.CreateTable(context.Background(), ddb.TableSpec{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return client
+}
+
+func TestAcquireRelease(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	a := &Manager{Client: client, Owner: "a", LeaseDuration: time.Second}
+	b := &Manager{Client: client, Owner: "b", LeaseDuration: time.Second}
+
+	lockA, err := a.TryAcquire(ctx, "cron")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := b.TryAcquire(ctx, "cron"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got: %v", err)
+	}
+
+	if err := lockA.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a released lock is acquired without waiting for it to expire, with a higher fencing token
+	lockB, err := b.TryAcquire(ctx, "cron")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = lockB.Close() })
+
+	if lockA.Fence() != 1 || lockB.Fence() != 2 {
+		t.Errorf("unexpected fencing tokens: %d, %d", lockA.Fence(), lockB.Fence())
+	}
+}
+
+func TestAcquireTakesOverAbandonedLease(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	a := &Manager{Client: client, Owner: "a", LeaseDuration: 100 * time.Millisecond}
+	b := &Manager{Client: client, Owner: "b", LeaseDuration: 100 * time.Millisecond, RetryInterval: 10 * time.Millisecond}
+
+	lockA, err := a.TryAcquire(ctx, "cron")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a heartbeat keeps the lease while its holder is alive
+	ctxShort, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	t.Cleanup(cancel)
+	if _, err := b.Acquire(ctxShort, "cron"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the lease to be renewed, got: %v", err)
+	}
+
+	// simulate a crash of the holder by stopping its heartbeat without releasing
+	close(lockA.stop)
+	<-lockA.done
+
+	lockB, err := b.Acquire(ctx, "cron")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = lockB.Close() })
+
+	if lockB.Fence() <= lockA.Fence() {
+		t.Errorf("expected a higher fencing token, got: %d after %d", lockB.Fence(), lockA.Fence())
+	}
+
+	if err := lockA.Release(ctx); !errors.Is(err, ErrLockLost) {
+		t.Errorf("expected ErrLockLost, got: %v", err)
+	}
+}
+
+func TestSigningClient(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t)
+	keys := &ddb.StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+	client.Encryption = &ddb.Encryption{Keys: keys, Sign: true}
+	ctx := context.Background()
+
+	a := &Manager{Client: client, Owner: "a", LeaseDuration: 100 * time.Millisecond}
+	b := &Manager{Client: client, Owner: "b", LeaseDuration: 100 * time.Millisecond}
+
+	lockA, err := a.TryAcquire(ctx, "cron")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// renewals keep the signed lease row valid for longer than one lease
+	select {
+	case <-lockA.Lost():
+		t.Fatalf("unexpected lost lease: %v", lockA.Release(ctx))
+	case <-time.After(300 * time.Millisecond):
+	}
+	if _, err := b.TryAcquire(ctx, "cron"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got: %v", err)
+	}
+
+	if err := lockA.Release(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lockB, err := b.TryAcquire(ctx, "cron")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = lockB.Close() })
+}
+
+func TestLeaseRowIsNotExpiredByTTL(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	m := &Manager{Client: client, Owner: "a", LeaseDuration: time.Second}
+	l, err := m.TryAcquire(ctx, "cron")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	// Time to Live must not delete lease rows, which hold the fencing token
+	pk, sk := leaseKey("cron")
+	resp, err := client.Ddb.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &client.Table,
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: pk},
+			"SK": &types.AttributeValueMemberS{Value: sk},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := resp.Item["ExpiresAt"]; ok {
+		t.Errorf("expected no ExpiresAt attribute, got: %v", resp.Item["ExpiresAt"])
+	}
+	if _, ok := resp.Item["LeaseExpiresAt"]; !ok {
+		t.Errorf("expected a LeaseExpiresAt attribute")
+	}
+}
@@ -0,0 +1,553 @@
+// Package migrate runs versioned migrations that rewrite the items of a table, e.g. to rename an attribute or
+// change a key format. Each migration scans the table in parallel segments and records its progress in
+// metadata rows in the same table, so an interrupted run resumes where it stopped.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/danielwchapman/ddb"
+	"github.com/danielwchapman/ddb/keys"
+)
+
+const (
+	// RowType is the RowType of the metadata row of a migration.
+	RowType = "MIGRATION"
+
+	// SegmentRowType is the RowType of the checkpoint rows of the scan segments of a migration.
+	SegmentRowType = "MIGRATION_SEGMENT"
+
+	// Partition is the partition key of the metadata rows.
+	Partition = "MIGRATION"
+
+	DefaultSegments   = 4
+	DefaultPageSize   = 100
+	DefaultMaxSamples = 10
+
+	// attempts is how many times an item that changes during its migration is read again and retried.
+	attempts = 3
+)
+
+// Transform returns the new version of an item, or nil to leave it as it is. If the new item has a different
+// key it replaces the original. Transforms must return nil for items that are already migrated: a resumed
+// migration may see items again, and items moved to a new key may be scanned a second time.
+type Transform func(ctx context.Context, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error)
+
+// Migration is a change to the items of a table, applied once in Version order.
+type Migration struct {
+	Version   int
+	Name      string
+	Transform Transform
+}
+
+// Report counts what a migration did, or would do in a dry run.
+type Report struct {
+	Version int
+	Name    string
+
+	Scanned int
+	// Changed counts items rewritten in place, and Moved items written under a new key.
+	Changed int
+	Moved   int
+	// Conflicts counts items that kept changing while being migrated and were left as they were.
+	Conflicts int
+
+	// Samples holds up to Runner.MaxSamples changes in a dry run.
+	Samples []Sample
+}
+
+// Sample is an item before and after its Transform.
+type Sample struct {
+	Before map[string]types.AttributeValue
+	After  map[string]types.AttributeValue
+}
+
+// State is the metadata row of a migration.
+type State struct {
+	ddb.RowHeader
+	Version    int
+	Name       string
+	Segments   int
+	Done       bool
+	StartedAt  time.Time
+	FinishedAt time.Time `dynamodbav:",omitempty"`
+}
+
+// segmentState is the checkpoint row of one scan segment.
+type segmentState struct {
+	ddb.RowHeader
+	Segment   int
+	StartKey  string `dynamodbav:",omitempty"`
+	Done      bool
+	Scanned   int
+	Changed   int
+	Moved     int
+	Conflicts int
+}
+
+// Runner applies registered migrations to the table of Client. Transforms see items as they are stored, with
+// encrypted and compressed fields as their stored bytes, which are written back as they are unless a Transform
+// changes them. Clients that sign rows are rejected, because rewritten items would fail their signature checks.
+// Every request is paced by the RateLimiter of the Client, as well as by RateLimit.
+type Runner struct {
+	Client *ddb.Client
+
+	// Segments is the number of parallel scan segments of new migrations. Defaults to DefaultSegments. A
+	// resumed migration keeps the number it started with.
+	Segments int
+
+	// PageSize is the number of items each Scan reads. Defaults to DefaultPageSize.
+	PageSize int
+
+	// RateLimit caps the items per second a migration reads across all segments. Zero means no limit.
+	RateLimit float64
+
+	// DryRun reports what migrations would change without writing anything, including progress.
+	DryRun bool
+
+	// MaxSamples is the number of changes a dry run reports. Defaults to DefaultMaxSamples.
+	MaxSamples int
+
+	mu         sync.Mutex
+	migrations map[int]Migration
+}
+
+// Register adds a migration. Versions must be positive and unique.
+func (r *Runner) Register(m Migration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if m.Version <= 0 {
+		return fmt.Errorf("Register: version must be positive, got %d", m.Version)
+	}
+	if m.Transform == nil {
+		return fmt.Errorf("Register: version %d has no Transform", m.Version)
+	}
+	if _, ok := r.migrations[m.Version]; ok {
+		return fmt.Errorf("Register: version %d is already registered", m.Version)
+	}
+	if r.migrations == nil {
+		r.migrations = map[int]Migration{}
+	}
+	r.migrations[m.Version] = m
+	return nil
+}
+
+// Run applies the migrations that are not done, in version order, and reports on each one it ran. It stops at
+// the first migration that fails, and running again resumes it.
+func (r *Runner) Run(ctx context.Context) ([]Report, error) {
+	if r.Client.Encryption != nil && r.Client.Encryption.Sign {
+		return nil, fmt.Errorf("Run: clients that sign rows cannot run migrations")
+	}
+
+	r.mu.Lock()
+	migrations := make([]Migration, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		migrations = append(migrations, m)
+	}
+	r.mu.Unlock()
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	var reports []Report
+	for _, m := range migrations {
+		report, ran, err := r.run(ctx, m)
+		if ran {
+			reports = append(reports, report)
+		}
+		if err != nil {
+			return reports, fmt.Errorf("Run: version %d: %w", m.Version, err)
+		}
+	}
+	return reports, nil
+}
+
+// Status returns the metadata rows of the migrations that have started, in version order.
+func (r *Runner) Status(ctx context.Context) ([]State, error) {
+	var states []State
+	err := r.Client.Query(ctx, ddb.KeyPkOnly(Partition), &states, ddb.WithConsistentRead(),
+		ddb.WithFilters(expression.Name("RowType").Equal(expression.Value(RowType))))
+	if err != nil && !errors.Is(err, ddb.ErrNotFound) {
+		return nil, fmt.Errorf("Status: %w", err)
+	}
+	return states, nil
+}
+
+func stateSK(version int) string {
+	return keys.Build(keys.String("VERSION"), keys.Int(int64(version), 10))
+}
+
+func segmentSK(version, segment int) string {
+	return keys.Build(keys.String("VERSION"), keys.Int(int64(version), 10), keys.String("SEGMENT"), keys.Int(int64(segment), 4))
+}
+
+// run applies one migration, reporting whether it was not already done.
+func (r *Runner) run(ctx context.Context, m Migration) (Report, bool, error) {
+	report := Report{Version: m.Version, Name: m.Name}
+
+	var state State
+	err := r.Client.GetWithOptions(ctx, Partition, stateSK(m.Version), &state, ddb.WithConsistentRead())
+	switch {
+	case err == nil && state.Done:
+		return report, false, nil
+	case errors.Is(err, ddb.ErrNotFound):
+		state = State{
+			RowHeader: ddb.RowHeader{PK: Partition, SK: stateSK(m.Version), RowType: RowType},
+			Version:   m.Version,
+			Name:      m.Name,
+			Segments:  r.segments(),
+			StartedAt: time.Now().UTC(),
+		}
+		if !r.DryRun {
+			if err := r.Client.Put(ctx, state, ddb.WithItemNotExist()); err != nil {
+				return report, true, fmt.Errorf("Put: %w", err)
+			}
+		}
+	case err != nil:
+		return report, true, fmt.Errorf("Get: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		limiter  = newLimiter(r.RateLimit)
+	)
+	for segment := 0; segment < state.Segments; segment++ {
+		wg.Add(1)
+		go func(segment int) {
+			defer wg.Done()
+			if err := r.runSegment(ctx, m, state.Segments, segment, limiter, &mu, &report); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("segment %d: %w", segment, err)
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}(segment)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return report, true, firstErr
+	}
+
+	if !r.DryRun {
+		state.Done = true
+		state.FinishedAt = time.Now().UTC()
+		if err := r.Client.Put(ctx, state); err != nil {
+			return report, true, fmt.Errorf("Put: %w", err)
+		}
+	}
+
+	return report, true, nil
+}
+
+func (r *Runner) runSegment(ctx context.Context, m Migration, segments, segment int, limiter *limiter, mu *sync.Mutex, report *Report) error {
+	checkpoint := segmentState{
+		RowHeader: ddb.RowHeader{PK: Partition, SK: segmentSK(m.Version, segment), RowType: SegmentRowType},
+		Segment:   segment,
+	}
+	if !r.DryRun {
+		err := r.Client.GetWithOptions(ctx, Partition, checkpoint.SK, &checkpoint, ddb.WithConsistentRead())
+		if err != nil && !errors.Is(err, ddb.ErrNotFound) {
+			return fmt.Errorf("Get: %w", err)
+		}
+	}
+
+	// a resumed segment reports what it did before it was interrupted too
+	mu.Lock()
+	report.Scanned += checkpoint.Scanned
+	report.Changed += checkpoint.Changed
+	report.Moved += checkpoint.Moved
+	report.Conflicts += checkpoint.Conflicts
+	mu.Unlock()
+
+	if checkpoint.Done {
+		return nil
+	}
+
+	startKey, err := ddb.DeserializeExclusiveStartKey(checkpoint.StartKey)
+	if err != nil {
+		return fmt.Errorf("DeserializeExclusiveStartKey: %w", err)
+	}
+
+	total, seg, limit := int32(segments), int32(segment), int32(r.pageSize())
+	for {
+		page, err := r.Client.Ddb.Scan(ctx, &dynamodb.ScanInput{
+			TableName:         &r.Client.Table,
+			Segment:           &seg,
+			TotalSegments:     &total,
+			Limit:             &limit,
+			ExclusiveStartKey: startKey,
+		}, r.Client.RateLimitOptions(ctx)...)
+		if err != nil {
+			return fmt.Errorf("Scan: %w", err)
+		}
+
+		var progress segmentState
+		for _, item := range page.Items {
+			if isMetadata(item) {
+				continue
+			}
+			if err := limiter.wait(ctx); err != nil {
+				return err
+			}
+
+			progress.Scanned++
+			if err := r.migrateItem(ctx, m, item, &progress, mu, report); err != nil {
+				return err
+			}
+		}
+
+		startKey = page.LastEvaluatedKey
+		token, err := ddb.SerializeExclusiveStartKey(startKey)
+		if err != nil {
+			return fmt.Errorf("SerializeExclusiveStartKey: %w", err)
+		}
+
+		checkpoint.StartKey = token
+		checkpoint.Done = len(startKey) == 0
+		checkpoint.Scanned += progress.Scanned
+		checkpoint.Changed += progress.Changed
+		checkpoint.Moved += progress.Moved
+		checkpoint.Conflicts += progress.Conflicts
+
+		mu.Lock()
+		report.Scanned += progress.Scanned
+		report.Changed += progress.Changed
+		report.Moved += progress.Moved
+		report.Conflicts += progress.Conflicts
+		mu.Unlock()
+
+		if !r.DryRun {
+			if err := r.Client.Put(ctx, checkpoint); err != nil {
+				return fmt.Errorf("Put: %w", err)
+			}
+		}
+
+		if checkpoint.Done {
+			return nil
+		}
+	}
+}
+
+// migrateItem transforms one item and writes it if it has not changed since it was read. An item that changed
+// is read again and transformed again.
+func (r *Runner) migrateItem(ctx context.Context, m Migration, item map[string]types.AttributeValue, progress *segmentState, mu *sync.Mutex, report *Report) error {
+	for attempt := 0; attempt < attempts; attempt++ {
+		out, err := m.Transform(ctx, clone(item))
+		if err != nil {
+			return fmt.Errorf("Transform: %s: %w", describe(item), err)
+		}
+		if out == nil {
+			return nil
+		}
+
+		moved := !sameKey(item, out)
+
+		if r.DryRun {
+			mu.Lock()
+			if len(report.Samples) < r.maxSamples() {
+				report.Samples = append(report.Samples, Sample{Before: item, After: out})
+			}
+			mu.Unlock()
+		} else {
+			err := r.write(ctx, item, out, moved)
+			if isConflict(err) {
+				if item, err = r.reread(ctx, item); err != nil {
+					return err
+				}
+				if item == nil {
+					// deleted while being migrated
+					return nil
+				}
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", describe(item), err)
+			}
+		}
+
+		if moved {
+			progress.Moved++
+		} else {
+			progress.Changed++
+		}
+		return nil
+	}
+
+	progress.Conflicts++
+	return nil
+}
+
+// write replaces item with out, on the condition that item has not changed. A moved item is written under its
+// new key, which must be free, and the original is deleted in the same transaction.
+func (r *Runner) write(ctx context.Context, item, out map[string]types.AttributeValue, moved bool) error {
+	unchanged, err := expression.NewBuilder().WithCondition(ddb.UnchangedCondition(item)).Build()
+	if err != nil {
+		return fmt.Errorf("expression builder: %w", err)
+	}
+
+	if !moved {
+		_, err := r.Client.Ddb.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:                 &r.Client.Table,
+			Item:                      out,
+			ConditionExpression:       unchanged.Condition(),
+			ExpressionAttributeNames:  unchanged.Names(),
+			ExpressionAttributeValues: unchanged.Values(),
+		}, r.Client.RateLimitOptions(ctx)...)
+		if err != nil {
+			return fmt.Errorf("PutItem: %w", err)
+		}
+		return nil
+	}
+
+	notExists := "attribute_not_exists(PK)"
+	_, err = r.Client.Ddb.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{TableName: &r.Client.Table, Item: out, ConditionExpression: &notExists}},
+			{Delete: &types.Delete{
+				TableName:                 &r.Client.Table,
+				Key:                       key(item),
+				ConditionExpression:       unchanged.Condition(),
+				ExpressionAttributeNames:  unchanged.Names(),
+				ExpressionAttributeValues: unchanged.Values(),
+			}},
+		},
+	}, r.Client.RateLimitOptions(ctx)...)
+	if err != nil {
+		return fmt.Errorf("TransactWriteItems: %w", err)
+	}
+	return nil
+}
+
+func (r *Runner) reread(ctx context.Context, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	consistent := true
+	resp, err := r.Client.Ddb.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      &r.Client.Table,
+		Key:            key(item),
+		ConsistentRead: &consistent,
+	}, r.Client.RateLimitOptions(ctx)...)
+	if err != nil {
+		return nil, fmt.Errorf("GetItem: %w", err)
+	}
+	if len(resp.Item) == 0 {
+		return nil, nil
+	}
+	return resp.Item, nil
+}
+
+func (r *Runner) segments() int {
+	if r.Segments > 0 {
+		return r.Segments
+	}
+	return DefaultSegments
+}
+
+func (r *Runner) pageSize() int {
+	if r.PageSize > 0 {
+		return r.PageSize
+	}
+	return DefaultPageSize
+}
+
+func (r *Runner) maxSamples() int {
+	if r.MaxSamples > 0 {
+		return r.MaxSamples
+	}
+	return DefaultMaxSamples
+}
+
+func isConflict(err error) bool {
+	var condFailedErr *types.ConditionalCheckFailedException
+	var canceledErr *types.TransactionCanceledException
+	return errors.As(err, &condFailedErr) || errors.As(err, &canceledErr)
+}
+
+func isMetadata(item map[string]types.AttributeValue) bool {
+	rowType, ok := item["RowType"].(*types.AttributeValueMemberS)
+	return ok && (rowType.Value == RowType || rowType.Value == SegmentRowType)
+}
+
+func key(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{"PK": item["PK"], "SK": item["SK"]}
+}
+
+func sameKey(a, b map[string]types.AttributeValue) bool {
+	for _, name := range []string{"PK", "SK"} {
+		x, okX := a[name].(*types.AttributeValueMemberS)
+		y, okY := b[name].(*types.AttributeValueMemberS)
+		if !okX || !okY || x.Value != y.Value {
+			return false
+		}
+	}
+	return true
+}
+
+func describe(item map[string]types.AttributeValue) string {
+	pk, _ := item["PK"].(*types.AttributeValueMemberS)
+	sk, _ := item["SK"].(*types.AttributeValueMemberS)
+	if pk == nil || sk == nil {
+		return "item"
+	}
+	return fmt.Sprintf("PK %s SK %s", pk.Value, sk.Value)
+}
+
+// clone copies the top level of an item so that a Transform can change it without changing the condition.
+func clone(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	out := make(map[string]types.AttributeValue, len(item))
+	for k, v := range item {
+		out[k] = v
+	}
+	return out
+}
+
+// limiter spaces out items so that no more than rate are read per second.
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newLimiter(rate float64) *limiter {
+	if rate <= 0 {
+		return &limiter{}
+	}
+	return &limiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	if l.interval == 0 {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
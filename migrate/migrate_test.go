@@ -0,0 +1,206 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/danielwchapman/ddb"
+	"github.com/danielwchapman/ddb/ddblocal"
+)
+
+type user struct {
+	ddb.RowHeader
+	Name     string `dynamodbav:",omitempty"`
+	FullName string `dynamodbav:",omitempty"`
+}
+
+func newTestClient(t *testing.T, n int) *ddb.Client {
+	t.Helper()
+
+	server := ddblocal.NewServer()
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	client := &ddb.Client{Ddb: server.DynamoDB(), Table: "Migrations"}
+	if err := client.CreateTable(ctx, ddb.TableSpec{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i := 0; i < n; i++ {
+		row := user{RowHeader: ddb.RowHeader{PK: fmt.Sprintf("USER#%d", i), SK: "PROFILE", RowType: "USER"}, FullName: fmt.Sprintf("user %d", i)}
+		if err := client.Put(ctx, row); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return client
+}
+
+// renameFullName renames FullName to Name.
+func renameFullName(_ context.Context, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	fullName, ok := item["FullName"]
+	if !ok {
+		return nil, nil
+	}
+	delete(item, "FullName")
+	item["Name"] = fullName
+	return item, nil
+}
+
+// moveToAccount changes PKs from USER#<id> to ACCOUNT#<id>.
+func moveToAccount(_ context.Context, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	pk := item["PK"].(*types.AttributeValueMemberS).Value
+	id, ok := strings.CutPrefix(pk, "USER#")
+	if !ok {
+		return nil, nil
+	}
+	item["PK"] = &types.AttributeValueMemberS{Value: "ACCOUNT#" + id}
+	return item, nil
+}
+
+func TestRunner(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, 5)
+	ctx := context.Background()
+
+	runner := &Runner{Client: client, Segments: 2, PageSize: 2, RateLimit: 1000}
+	if err := runner.Register(Migration{Version: 2, Name: "move to account", Transform: moveToAccount}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := runner.Register(Migration{Version: 1, Name: "rename FullName", Transform: renameFullName}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := runner.Register(Migration{Version: 1, Name: "again", Transform: renameFullName}); err == nil {
+		t.Errorf("expected an error for a duplicate version")
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		dryRun := &Runner{Client: client, DryRun: true, MaxSamples: 2, migrations: runner.migrations}
+		reports, err := dryRun.Run(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(reports) != 2 || reports[0].Changed != 5 || reports[1].Moved != 5 || len(reports[0].Samples) != 2 {
+			t.Errorf("unexpected reports: %+v", reports)
+		}
+
+		var got user
+		if err := client.Get(ctx, "USER#0", "PROFILE", &got); err != nil || got.FullName != "user 0" {
+			t.Errorf("expected no changes, got: %+v, %v", got, err)
+		}
+		if states, err := dryRun.Status(ctx); err != nil || len(states) != 0 {
+			t.Errorf("expected no metadata rows, got: %+v, %v", states, err)
+		}
+	})
+
+	reports, err := runner.Run(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reports) != 2 || reports[0].Changed != 5 || reports[1].Moved != 5 || reports[1].Conflicts != 0 {
+		t.Errorf("unexpected reports: %+v", reports)
+	}
+
+	var got user
+	if err := client.Get(ctx, "ACCOUNT#3", "PROFILE", &got); err != nil || got.Name != "user 3" || got.FullName != "" {
+		t.Errorf("unexpected row: %+v, %v", got, err)
+	}
+	if err := client.Get(ctx, "USER#3", "PROFILE", &got); !errors.Is(err, ddb.ErrNotFound) {
+		t.Errorf("expected the old row to be deleted, got: %v", err)
+	}
+
+	states, err := runner.Status(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(states) != 2 || !states[0].Done || !states[1].Done || states[0].Version != 1 {
+		t.Errorf("unexpected states: %+v", states)
+	}
+
+	// done migrations do not run again
+	if reports, err := runner.Run(ctx); err != nil || len(reports) != 0 {
+		t.Errorf("expected nothing to run, got: %+v, %v", reports, err)
+	}
+}
+
+func TestRunnerResumes(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, 6)
+	ctx := context.Background()
+
+	calls := 0
+	failing := func(ctx context.Context, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+		calls++
+		if calls == 4 {
+			return nil, errors.New("interrupted")
+		}
+		return renameFullName(ctx, item)
+	}
+
+	runner := &Runner{Client: client, Segments: 1, PageSize: 2}
+	if err := runner.Register(Migration{Version: 1, Transform: failing}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := runner.Run(ctx); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	// the first page was checkpointed, so it is not scanned again
+	calls = 0
+	reports, err := runner.Run(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls >= 6 {
+		t.Errorf("expected fewer than 6 items to be scanned again, got: %d", calls)
+	}
+	if len(reports) != 1 || reports[0].Changed != 6 {
+		t.Errorf("unexpected reports: %+v", reports)
+	}
+}
+
+func TestRunnerClientOptions(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, 3)
+	ctx := context.Background()
+
+	t.Run("signing client", func(t *testing.T) {
+		signing := *client
+		signing.Encryption = &ddb.Encryption{Keys: &ddb.StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}, Sign: true}
+		runner := &Runner{Client: &signing}
+		if err := runner.Register(Migration{Version: 1, Transform: renameFullName}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := runner.Run(ctx); err == nil {
+			t.Errorf("expected an error")
+		}
+
+		var got user
+		if err := client.Get(ctx, "USER#0", "PROFILE", &got); err != nil || got.FullName != "user 0" {
+			t.Errorf("expected no changes, got: %+v, %v", got, err)
+		}
+	})
+
+	t.Run("rate limiter", func(t *testing.T) {
+		limited := *client
+		limited.RateLimiter = &ddb.RateLimiter{ReadCapacity: 1000, WriteCapacity: 1000}
+		runner := &Runner{Client: &limited}
+		if err := runner.Register(Migration{Version: 2, Transform: renameFullName}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		reports, err := runner.Run(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(reports) != 1 || reports[0].Changed != 3 {
+			t.Errorf("unexpected reports: %+v", reports)
+		}
+	})
+}
@@ -0,0 +1,21 @@
+package mocks
+
+import "github.com/golang/mock/gomock"
+
+// MockTransactPutter is the name MockTransactionPutter had before the mocks were regenerated.
+//
+// Deprecated: Use MockTransactionPutter.
+type MockTransactPutter = MockTransactionPutter
+
+// MockTransactPutterMockRecorder is the name MockTransactionPutterMockRecorder had before the mocks were
+// regenerated.
+//
+// Deprecated: Use MockTransactionPutterMockRecorder.
+type MockTransactPutterMockRecorder = MockTransactionPutterMockRecorder
+
+// NewMockTransactPutter creates a new mock instance.
+//
+// Deprecated: Use NewMockTransactionPutter.
+func NewMockTransactPutter(ctrl *gomock.Controller) *MockTransactionPutter {
+	return NewMockTransactionPutter(ctrl)
+}
@@ -223,6 +223,62 @@ func (mr *MockGetterMockRecorder) Get(ctx, pk, sk, out interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockGetter)(nil).Get), ctx, pk, sk, out)
 }
 
+// MockGetterWithOptions is a mock of GetterWithOptions interface.
+type MockGetterWithOptions struct {
+	ctrl     *gomock.Controller
+	recorder *MockGetterWithOptionsMockRecorder
+}
+
+// MockGetterWithOptionsMockRecorder is the mock recorder for MockGetterWithOptions.
+type MockGetterWithOptionsMockRecorder struct {
+	mock *MockGetterWithOptions
+}
+
+// NewMockGetterWithOptions creates a new mock instance.
+func NewMockGetterWithOptions(ctrl *gomock.Controller) *MockGetterWithOptions {
+	mock := &MockGetterWithOptions{ctrl: ctrl}
+	mock.recorder = &MockGetterWithOptionsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockGetterWithOptions) EXPECT() *MockGetterWithOptionsMockRecorder {
+	return m.recorder
+}
+
+// Get mocks base method.
+func (m *MockGetterWithOptions) Get(ctx context.Context, pk, sk string, out any) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, pk, sk, out)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockGetterWithOptionsMockRecorder) Get(ctx, pk, sk, out interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockGetterWithOptions)(nil).Get), ctx, pk, sk, out)
+}
+
+// GetWithOptions mocks base method.
+func (m *MockGetterWithOptions) GetWithOptions(ctx context.Context, pk, sk string, out any, opts ...ddb.Option) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, pk, sk, out}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetWithOptions", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetWithOptions indicates an expected call of GetWithOptions.
+func (mr *MockGetterWithOptionsMockRecorder) GetWithOptions(ctx, pk, sk, out interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, pk, sk, out}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithOptions", reflect.TypeOf((*MockGetterWithOptions)(nil).GetWithOptions), varargs...)
+}
+
 // MockPutter is a mock of Putter interface.
 type MockPutter struct {
 	ctrl     *gomock.Controller
@@ -307,31 +363,31 @@ func (mr *MockQueryerMockRecorder) Query(ctx, keyCond, out interface{}, opts ...
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Query", reflect.TypeOf((*MockQueryer)(nil).Query), varargs...)
 }
 
-// MockTransactPutter is a mock of TransactPutter interface.
-type MockTransactPutter struct {
+// MockTransactionPutter is a mock of TransactionPutter interface.
+type MockTransactionPutter struct {
 	ctrl     *gomock.Controller
-	recorder *MockTransactPutterMockRecorder
+	recorder *MockTransactionPutterMockRecorder
 }
 
-// MockTransactPutterMockRecorder is the mock recorder for MockTransactPutter.
-type MockTransactPutterMockRecorder struct {
-	mock *MockTransactPutter
+// MockTransactionPutterMockRecorder is the mock recorder for MockTransactionPutter.
+type MockTransactionPutterMockRecorder struct {
+	mock *MockTransactionPutter
 }
 
-// NewMockTransactPutter creates a new mock instance.
-func NewMockTransactPutter(ctrl *gomock.Controller) *MockTransactPutter {
-	mock := &MockTransactPutter{ctrl: ctrl}
-	mock.recorder = &MockTransactPutterMockRecorder{mock}
+// NewMockTransactionPutter creates a new mock instance.
+func NewMockTransactionPutter(ctrl *gomock.Controller) *MockTransactionPutter {
+	mock := &MockTransactionPutter{ctrl: ctrl}
+	mock.recorder = &MockTransactionPutterMockRecorder{mock}
 	return mock
 }
 
 // EXPECT returns an object that allows the caller to indicate expected use.
-func (m *MockTransactPutter) EXPECT() *MockTransactPutterMockRecorder {
+func (m *MockTransactionPutter) EXPECT() *MockTransactionPutterMockRecorder {
 	return m.recorder
 }
 
 // TransactPuts mocks base method.
-func (m *MockTransactPutter) TransactPuts(ctx context.Context, token string, rows ...ddb.PutRow) error {
+func (m *MockTransactionPutter) TransactPuts(ctx context.Context, token string, rows ...ddb.PutRow) error {
 	m.ctrl.T.Helper()
 	varargs := []interface{}{ctx, token}
 	for _, a := range rows {
@@ -343,10 +399,10 @@ func (m *MockTransactPutter) TransactPuts(ctx context.Context, token string, row
 }
 
 // TransactPuts indicates an expected call of TransactPuts.
-func (mr *MockTransactPutterMockRecorder) TransactPuts(ctx, token interface{}, rows ...interface{}) *gomock.Call {
+func (mr *MockTransactionPutterMockRecorder) TransactPuts(ctx, token interface{}, rows ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	varargs := append([]interface{}{ctx, token}, rows...)
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransactPuts", reflect.TypeOf((*MockTransactPutter)(nil).TransactPuts), varargs...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransactPuts", reflect.TypeOf((*MockTransactionPutter)(nil).TransactPuts), varargs...)
 }
 
 // MockUpdater is a mock of Updater interface.
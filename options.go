@@ -3,6 +3,7 @@ package ddb
 import (
 	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
@@ -16,17 +17,37 @@ type options struct {
 	conditionsCount int
 	returnValues    types.ReturnValue
 	returnValuesOut any
+	expiresAt       ExpiresAt
+
+	// for use with update, encrypted by the Client
+	encryptedUpdates map[string]types.AttributeValue
+
+	// the attributes updates set and remove, which a Client that signs rows applies to the row itself
+	setAttributes    map[string]types.AttributeValue
+	removeAttributes []string
+
+	// the partition key prefix of a TenantClient
+	tenant string
+
+	// for use with get and query
+	filterExpired  *bool
+	includeDeleted bool
+
+	// for use with delete
+	hardDelete bool
 
 	// for use with query
 	pageSize      *int32
-	startKey      map[string]types.AttributeValue
+	pageToken     string
 	pageOut       *string
 	scanBackwards bool
+	consistent    bool
 	filter        *expression.ConditionBuilder
 	indexName     string
 	pkName        string
 	skName        string
 	unmarshalFn   func(items []map[string]types.AttributeValue, out any) error
+	rowTypes      *RowTypes
 
 	// use a function for key condition because otherwise the pkColumnName or skColumnName
 	// may not be set yet, depending on the order the options are provided in.
@@ -35,6 +56,32 @@ type options struct {
 
 type Option func(options *options) error
 
+// setAttribute adds an update that sets the attribute name to av.
+func (o *options) setAttribute(name string, av types.AttributeValue) {
+	o.updates = o.updates.Set(expression.Name(name), expression.Value(av))
+	o.updatesCount++
+	if o.setAttributes == nil {
+		o.setAttributes = map[string]types.AttributeValue{}
+	}
+	o.setAttributes[name] = av
+}
+
+// updatedAttributes returns the names of the attributes updates set or remove.
+func (o *options) updatedAttributes() []string {
+	names := make([]string, 0, len(o.setAttributes)+len(o.removeAttributes))
+	for name := range o.setAttributes {
+		names = append(names, name)
+	}
+	return append(names, o.removeAttributes...)
+}
+
+// removeAttribute adds an update that removes the attribute name.
+func (o *options) removeAttribute(name string) {
+	o.updates = o.updates.Remove(expression.Name(name))
+	o.updatesCount++
+	o.removeAttributes = append(o.removeAttributes, name)
+}
+
 // WithFieldUpdates adds field updates to the options. For use with Update.
 func WithFieldUpdates(updates map[string]any) Option {
 	return func(options *options) error {
@@ -43,12 +90,36 @@ func WithFieldUpdates(updates map[string]any) Option {
 			return fmt.Errorf("WithFieldUpdates: MarshalMap: %w", err)
 		}
 
-		for k, v := range item {
-			options.updates = options.updates.Set(expression.Name(k), expression.Value(v))
+		// sort so that the same updates always produce the same expression
+		names := make([]string, 0, len(item))
+		for k := range item {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		for _, k := range names {
+			options.setAttribute(k, item[k])
 		}
 
-		options.updatesCount += len(item)
+		return nil
+	}
+}
+
+// WithEncryptedFieldUpdates adds field updates that are encrypted like fields tagged `ddb:",encrypt"`. For use
+// with Update on a Client with Encryption.
+func WithEncryptedFieldUpdates(updates map[string]any) Option {
+	return func(options *options) error {
+		item, err := attributevalue.MarshalMap(updates)
+		if err != nil {
+			return fmt.Errorf("WithEncryptedFieldUpdates: MarshalMap: %w", err)
+		}
 
+		if options.encryptedUpdates == nil {
+			options.encryptedUpdates = make(map[string]types.AttributeValue, len(item))
+		}
+		for k, v := range item {
+			options.encryptedUpdates[k] = v
+		}
 		return nil
 	}
 }
@@ -69,6 +140,41 @@ func WithIndex(pkName, skName, indexName string) Option {
 	}
 }
 
+// WithGSIKeys sets the key attributes of GSI n, e.g. GSI1PK and GSI1SK, adding the item to the sparse index.
+// For use with Update.
+func WithGSIKeys(n int, pk, sk string) Option {
+	return func(options *options) error {
+		keys, ok := gsiKeys[n]
+		if !ok {
+			return &InvalidArgumentError{err: fmt.Errorf("WithGSIKeys: unsupported GSI number %d", n)}
+		}
+		if pk == "" || sk == "" {
+			return &InvalidArgumentError{err: errors.New("WithGSIKeys: index keys cannot be empty, use WithoutGSI")}
+		}
+
+		options.setAttribute(keys.pk, &types.AttributeValueMemberS{Value: pk})
+		options.setAttribute(keys.sk, &types.AttributeValueMemberS{Value: sk})
+
+		return nil
+	}
+}
+
+// WithoutGSI removes the key attributes of GSI n, removing the item from the sparse index. For use with
+// Update.
+func WithoutGSI(n int) Option {
+	return func(options *options) error {
+		keys, ok := gsiKeys[n]
+		if !ok {
+			return &InvalidArgumentError{err: fmt.Errorf("WithoutGSI: unsupported GSI number %d", n)}
+		}
+
+		options.removeAttribute(keys.pk)
+		options.removeAttribute(keys.sk)
+
+		return nil
+	}
+}
+
 func WithIndexGSI1() Option {
 	return WithIndex(gsi1pk, gsi1sk, indexNameGSI1)
 }
@@ -89,6 +195,43 @@ func WithIndexGSI5() Option {
 	return WithIndex(gsi5pk, gsi5sk, indexNameGSI5)
 }
 
+// WithIndexLSI1 queries LSI1, which is keyed by PK and LSI1SK.
+func WithIndexLSI1() Option {
+	return WithIndex(defaultPK, lsi1sk, indexNameLSI1)
+}
+
+func WithIndexLSI2() Option {
+	return WithIndex(defaultPK, lsi2sk, indexNameLSI2)
+}
+
+func WithIndexLSI3() Option {
+	return WithIndex(defaultPK, lsi3sk, indexNameLSI3)
+}
+
+func WithIndexLSI4() Option {
+	return WithIndex(defaultPK, lsi4sk, indexNameLSI4)
+}
+
+func WithIndexLSI5() Option {
+	return WithIndex(defaultPK, lsi5sk, indexNameLSI5)
+}
+
+// consistentRead is nil unless WithConsistentRead was given, so requests are unchanged by default.
+func (o *options) consistentRead() *bool {
+	if !o.consistent {
+		return nil
+	}
+	return &o.consistent
+}
+
+// WithConsistentRead makes GetWithOptions and Query use strongly consistent reads. It cannot be used with GSIs.
+func WithConsistentRead() Option {
+	return func(options *options) error {
+		options.consistent = true
+		return nil
+	}
+}
+
 // WithItemExists adds a condition that the item exists. For use with Update and Put.
 func WithItemExists() Option {
 	return func(options *options) error {
@@ -121,13 +264,18 @@ func WithItemNotExist() Option {
 	}
 }
 
+// WithPage starts a Query after serializedPage, the token a previous page wrote to out, and writes the token
+// for the next page to out. An empty serializedPage starts from the beginning. The token is written even when
+// Query returns ErrNotFound, as a filter can leave a page empty with more pages after it. For use with Query.
 func WithPage(serializedPage string, out *string) Option {
 	return func(options *options) error {
-		startKey, err := DeserializeExclusiveStartKey(serializedPage)
-		if err != nil {
-			return fmt.Errorf("WithPage: %w", err)
+		if serializedPage != "" && !isSealedPage(serializedPage) {
+			// check plain tokens early, sealed ones can only be checked against the query
+			if _, err := DeserializeExclusiveStartKey(serializedPage); err != nil {
+				return fmt.Errorf("WithPage: %w", err)
+			}
 		}
-		options.startKey = startKey
+		options.pageToken = serializedPage
 		options.pageOut = out
 		return nil
 	}
@@ -180,6 +328,7 @@ func WithScanBackwards() Option {
 func WithUnmarshalFunc(fn func(items []map[string]types.AttributeValue, out any) error) Option {
 	return func(options *options) error {
 		options.unmarshalFn = fn
+		options.rowTypes = nil
 		return nil
 	}
 }
@@ -0,0 +1,152 @@
+package ddb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestWithGSIKeys(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		n       int
+		pk, sk  string
+		want    map[string]types.AttributeValue
+		wantErr bool
+	}{
+		{
+			name: "GSI2",
+			n:    2,
+			pk:   "ORG#1",
+			sk:   "USER#1",
+			want: map[string]types.AttributeValue{
+				gsi2pk: &types.AttributeValueMemberS{Value: "ORG#1"},
+				gsi2sk: &types.AttributeValueMemberS{Value: "USER#1"},
+			},
+		},
+		{name: "unsupported GSI", n: 6, pk: "ORG#1", sk: "USER#1", wantErr: true},
+		{name: "empty partition key", n: 1, sk: "USER#1", wantErr: true},
+		{name: "empty sort key", n: 1, pk: "ORG#1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var o options
+			err := WithGSIKeys(tt.n, tt.pk, tt.sk)(&o)
+			if tt.wantErr {
+				var invalidArgumentErr *InvalidArgumentError
+				if !errors.As(err, &invalidArgumentErr) {
+					t.Errorf("expected InvalidArgumentError, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, o.setAttributes, cmpopts.IgnoreUnexported(types.AttributeValueMemberS{})); diff != "" {
+				t.Errorf("unexpected attributes (-want +got):\n%s", diff)
+			}
+			if o.updatesCount != 2 {
+				t.Errorf("expected 2 updates, got: %d", o.updatesCount)
+			}
+		})
+	}
+}
+
+func TestWithoutGSI(t *testing.T) {
+	t.Parallel()
+
+	var o options
+	if err := WithoutGSI(3)(&o); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{gsi3pk, gsi3sk}, o.removeAttributes); diff != "" {
+		t.Errorf("unexpected attributes (-want +got):\n%s", diff)
+	}
+	if o.updatesCount != 2 {
+		t.Errorf("expected 2 updates, got: %d", o.updatesCount)
+	}
+
+	var invalidArgumentErr *InvalidArgumentError
+	if err := WithoutGSI(0)(&options{}); !errors.As(err, &invalidArgumentErr) {
+		t.Errorf("expected InvalidArgumentError, got: %v", err)
+	}
+}
+
+func TestOmitEmptyIndexKeys(t *testing.T) {
+	t.Parallel()
+
+	item := map[string]types.AttributeValue{
+		"PK":   &types.AttributeValueMemberS{Value: "USER#1"},
+		"SK":   &types.AttributeValueMemberS{Value: "PROFILE"},
+		"Name": &types.AttributeValueMemberS{Value: ""},
+		gsi1pk: &types.AttributeValueMemberS{Value: ""},
+		gsi1sk: &types.AttributeValueMemberS{Value: ""},
+		gsi2pk: &types.AttributeValueMemberNULL{Value: true},
+		gsi3pk: &types.AttributeValueMemberS{Value: "ORG#1"},
+		gsi3sk: &types.AttributeValueMemberS{Value: "USER#1"},
+		lsi1sk: &types.AttributeValueMemberS{Value: ""},
+		lsi2sk: &types.AttributeValueMemberS{Value: "2024"},
+	}
+	omitEmptyIndexKeys(item)
+
+	// only empty index keys are removed, so rows are left out of sparse indexes
+	want := map[string]types.AttributeValue{
+		"PK":   &types.AttributeValueMemberS{Value: "USER#1"},
+		"SK":   &types.AttributeValueMemberS{Value: "PROFILE"},
+		"Name": &types.AttributeValueMemberS{Value: ""},
+		gsi3pk: &types.AttributeValueMemberS{Value: "ORG#1"},
+		gsi3sk: &types.AttributeValueMemberS{Value: "USER#1"},
+		lsi2sk: &types.AttributeValueMemberS{Value: "2024"},
+	}
+	if diff := cmp.Diff(want, item, cmpopts.IgnoreUnexported(types.AttributeValueMemberS{})); diff != "" {
+		t.Errorf("unexpected item (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithIndexLSI(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		option    Option
+		indexName string
+		skName    string
+	}{
+		{WithIndexLSI1(), indexNameLSI1, lsi1sk},
+		{WithIndexLSI2(), indexNameLSI2, lsi2sk},
+		{WithIndexLSI3(), indexNameLSI3, lsi3sk},
+		{WithIndexLSI4(), indexNameLSI4, lsi4sk},
+		{WithIndexLSI5(), indexNameLSI5, lsi5sk},
+	}
+	for _, tt := range tests {
+		var o options
+		if err := tt.option(&o); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// LSIs share the table partition key
+		if o.indexName != tt.indexName || o.pkName != defaultPK || o.skName != tt.skName {
+			t.Errorf("%s: unexpected index: %s, %s, %s", tt.indexName, o.indexName, o.pkName, o.skName)
+		}
+	}
+}
+
+func TestWithConsistentRead(t *testing.T) {
+	t.Parallel()
+
+	// requests are unchanged by default
+	var o options
+	if got := o.consistentRead(); got != nil {
+		t.Errorf("expected nil, got: %v", *got)
+	}
+
+	if err := WithConsistentRead()(&o); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := o.consistentRead(); got == nil || !*got {
+		t.Errorf("expected a consistent read, got: %v", got)
+	}
+}
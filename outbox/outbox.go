@@ -0,0 +1,221 @@
+// Package outbox implements the transactional outbox pattern. Domain events are written in the same
+// transaction as the rows they describe, and a Relay publishes them afterwards, so an event is never lost
+// when a process dies between a write and a publish. Delivery is at least once.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/danielwchapman/ddb"
+	"github.com/danielwchapman/ddb/keys"
+)
+
+// RowType is the RowType of outbox rows.
+const RowType = "OUTBOX"
+
+// DefaultPartition is the partition key outbox rows are written under when Outbox.Partition is empty.
+const DefaultPartition = "OUTBOX"
+
+const skPrefix = "EVENT"
+
+// Event is an outbox row. Its SK is EVENT#<CreatedAt>#<ID> with a nanosecond sortable time, so a Relay
+// publishes events in the order they were created.
+type Event struct {
+	ddb.RowHeader
+	ID        string
+	Topic     string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+// NewEvent returns an Event for topic with payload marshalled to JSON. The event is keyed when it is written.
+func NewEvent(topic string, payload any) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, fmt.Errorf("NewEvent: Marshal: %w", err)
+	}
+
+	now := time.Now().UTC()
+	id, err := keys.NewULID(now)
+	if err != nil {
+		return Event{}, fmt.Errorf("NewEvent: NewULID: %w", err)
+	}
+
+	return Event{ID: id, Topic: topic, Payload: data, CreatedAt: now}, nil
+}
+
+// Outbox writes events alongside business rows.
+type Outbox struct {
+	Client *ddb.Client
+
+	// Partition is the partition key of outbox rows. Empty uses DefaultPartition.
+	Partition string
+}
+
+func (o *Outbox) partition() string {
+	if o.Partition == "" {
+		return DefaultPartition
+	}
+	return o.Partition
+}
+
+// Write puts rows and events in one transaction with TransactPuts, so the events exist if and only if the
+// rows were written. Events without a CreatedAt or an ID are given one.
+func (o *Outbox) Write(ctx context.Context, token string, events []Event, rows ...ddb.PutRow) error {
+	if len(events) == 0 {
+		return errors.New("Write: at least one event is required")
+	}
+
+	puts := make([]ddb.PutRow, 0, len(rows)+len(events))
+	puts = append(puts, rows...)
+
+	condition := "attribute_not_exists(PK)"
+	for _, event := range events {
+		if event.CreatedAt.IsZero() {
+			event.CreatedAt = time.Now().UTC()
+		}
+		if event.ID == "" {
+			id, err := keys.NewULID(event.CreatedAt)
+			if err != nil {
+				return fmt.Errorf("Write: NewULID: %w", err)
+			}
+			event.ID = id
+		}
+
+		event.RowHeader = ddb.RowHeader{
+			PK:      o.partition(),
+			SK:      keys.Build(keys.String(skPrefix), keys.SortableTime(event.CreatedAt), keys.ULID(event.ID)),
+			RowType: RowType,
+		}
+
+		puts = append(puts, ddb.PutRow{Row: event, Condition: &condition})
+	}
+
+	if err := o.Client.TransactPuts(ctx, token, puts...); err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+
+	return nil
+}
+
+// Publisher delivers events to a message broker.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// DefaultBatchSize is used when Relay.BatchSize is zero.
+const DefaultBatchSize = 25
+
+// Relay publishes the events in an outbox partition and deletes each one once it has been delivered.
+// Events are published in order, and a pass stops at the first event that cannot be published so that
+// ordering is kept when it is retried. Only one Relay should run per partition.
+type Relay struct {
+	Outbox    *Outbox
+	Publisher Publisher
+
+	// BatchSize is the number of events read per Query. Zero uses DefaultBatchSize.
+	BatchSize int
+
+	// PollInterval is how long Run waits after the outbox has been drained. Zero uses one second.
+	PollInterval time.Duration
+}
+
+// RelayOnce publishes every event currently in the outbox. It returns the number of events delivered.
+// Delivered events are removed with a hard delete even if the Client soft deletes, and pages are followed by
+// their page token rather than by counting events, as a filter such as FilterExpired can shorten a page.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	batchSize := r.BatchSize
+	if batchSize == 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	keyCond := ddb.KeySkBeginsWith(r.Outbox.partition(), keys.Prefix(keys.String(skPrefix)))
+	page := ""
+	delivered := 0
+
+	for {
+		var (
+			events []Event
+			next   string
+		)
+		err := r.Outbox.Client.Query(ctx, keyCond, &events, ddb.WithPageSize(batchSize), ddb.WithPage(page, &next))
+		if err != nil && !errors.Is(err, ddb.ErrNotFound) {
+			return delivered, fmt.Errorf("RelayOnce: %w", err)
+		}
+
+		for _, event := range events {
+			if err := r.Publisher.Publish(ctx, event); err != nil {
+				return delivered, fmt.Errorf("RelayOnce: Publish %s: %w", event.ID, err)
+			}
+			if err := r.Outbox.Client.Delete(ctx, event.PK, event.SK, ddb.WithHardDelete()); err != nil {
+				return delivered, fmt.Errorf("RelayOnce: %w", err)
+			}
+			delivered++
+		}
+
+		if next == "" {
+			return delivered, nil
+		}
+		page = next
+	}
+}
+
+// Run relays events until ctx is done or an event cannot be published. It returns ctx.Err() when ctx is done.
+func (r *Relay) Run(ctx context.Context) error {
+	interval := r.PollInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if _, err := r.RelayOnce(ctx); err != nil {
+			return fmt.Errorf("Run: %w", err)
+		}
+
+		timer.Reset(interval)
+	}
+}
+
+// LocalPublisher is an in-memory Publisher for tests and offline development.
+type LocalPublisher struct {
+	mu     sync.Mutex
+	events []Event
+
+	// Err, if set, is called before each event is recorded and a non-nil result fails the publish.
+	Err func(event Event) error
+}
+
+func (p *LocalPublisher) Publish(ctx context.Context, event Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Err != nil {
+		if err := p.Err(event); err != nil {
+			return err
+		}
+	}
+
+	p.events = append(p.events, event)
+	return nil
+}
+
+// Events returns the events published so far, in order.
+func (p *LocalPublisher) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Event(nil), p.events...)
+}
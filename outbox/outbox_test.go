@@ -0,0 +1,158 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/danielwchapman/ddb"
+	"github.com/danielwchapman/ddb/ddblocal"
+)
+
+type testOrder struct {
+	ddb.RowHeader
+	Total int
+}
+
+func TestOutboxRelay(t *testing.T) {
+	t.Parallel()
+
+	server := ddblocal.NewServer()
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	client := &ddb.Client{Ddb: server.DynamoDB(), Table: "Outbox"}
+	if err := client.CreateTable(ctx, ddb.TableSpec{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	box := &Outbox{Client: client}
+
+	for i, topic := range []string{"order.created", "order.paid", "order.shipped"} {
+		event, err := NewEvent(topic, map[string]int{"total": 10})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		order := testOrder{RowHeader: ddb.RowHeader{PK: "USER#1", SK: "ORDER#1", RowType: "ORDER"}, Total: i}
+		if err := box.Write(ctx, topic, []Event{event}, ddb.PutRow{Row: order}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	publisher := &LocalPublisher{Err: func(event Event) error {
+		if event.Topic == "order.shipped" {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	}}
+	relay := &Relay{Outbox: box, Publisher: publisher, BatchSize: 2}
+
+	// delivery stops at the failed event and keeps it for the next pass
+	delivered, err := relay.RelayOnce(ctx)
+	if err == nil || delivered != 2 {
+		t.Fatalf("expected 2 events delivered before an error, got: %d, %v", delivered, err)
+	}
+
+	publisher.Err = nil
+	if delivered, err = relay.RelayOnce(ctx); err != nil || delivered != 1 {
+		t.Fatalf("expected 1 event delivered, got: %d, %v", delivered, err)
+	}
+
+	var topics []string
+	for _, event := range publisher.Events() {
+		topics = append(topics, event.Topic)
+	}
+	if diff := cmp.Diff([]string{"order.created", "order.paid", "order.shipped"}, topics); diff != "" {
+		t.Errorf("unexpected diff: %s", diff)
+	}
+
+	if delivered, err = relay.RelayOnce(ctx); err != nil || delivered != 0 {
+		t.Errorf("expected an empty outbox, got: %d, %v", delivered, err)
+	}
+}
+
+func TestOutboxWriteIsAtomic(t *testing.T) {
+	t.Parallel()
+
+	server := ddblocal.NewServer()
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	client := &ddb.Client{Ddb: server.DynamoDB(), Table: "Outbox"}
+	if err := client.CreateTable(ctx, ddb.TableSpec{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	box := &Outbox{Client: client}
+
+	event, err := NewEvent("order.created", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	exists := "attribute_exists(PK)"
+	order := ddb.PutRow{Row: testOrder{RowHeader: ddb.RowHeader{PK: "USER#1", SK: "ORDER#1"}}, Condition: &exists}
+	if err := box.Write(ctx, "token", []Event{event}, order); err == nil {
+		t.Fatalf("expected the transaction to be canceled")
+	}
+
+	// the event is not written when the business row is not
+	var events []Event
+	if err := client.Query(ctx, ddb.KeyPkOnly(DefaultPartition), &events); !errors.Is(err, ddb.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got: %v, %v", err, events)
+	}
+}
+
+func TestOutboxRelaySoftDelete(t *testing.T) {
+	t.Parallel()
+
+	server := ddblocal.NewServer()
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	client := &ddb.Client{Ddb: server.DynamoDB(), Table: "Outbox", SoftDelete: &ddb.SoftDelete{}}
+	if err := client.CreateTable(ctx, ddb.TableSpec{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	box := &Outbox{Client: client}
+	for i := 0; i < 5; i++ {
+		event, err := NewEvent("order.created", i)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		order := testOrder{RowHeader: ddb.RowHeader{PK: "USER#1", SK: "ORDER#1", RowType: "ORDER"}, Total: i}
+		if err := box.Write(ctx, "token", []Event{event}, ddb.PutRow{Row: order}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// soft-deleted events fill the first two pages
+	var events []Event
+	if err := client.Query(ctx, ddb.KeyPkOnly(DefaultPartition), &events); err != nil || len(events) != 5 {
+		t.Fatalf("expected 5 events, got: %d, %v", len(events), err)
+	}
+	for _, event := range events[:4] {
+		if err := client.Delete(ctx, event.PK, event.SK); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	publisher := &LocalPublisher{}
+	relay := &Relay{Outbox: box, Publisher: publisher, BatchSize: 2}
+	if delivered, err := relay.RelayOnce(ctx); err != nil || delivered != 1 {
+		t.Fatalf("expected 1 event delivered, got: %d, %v", delivered, err)
+	}
+	if got := publisher.Events(); len(got) != 1 || got[0].ID != events[4].ID {
+		t.Errorf("unexpected events: %+v", got)
+	}
+
+	// the relayed event is removed, not soft-deleted
+	var remaining []Event
+	if err := client.Query(ctx, ddb.KeyPkOnly(DefaultPartition), &remaining, ddb.WithIncludeDeleted()); err != nil || len(remaining) != 4 {
+		t.Errorf("expected the 4 soft-deleted events to remain, got: %d, %v", len(remaining), err)
+	}
+}
@@ -0,0 +1,167 @@
+package ddb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/danielwchapman/ddb/internal/avjson"
+)
+
+// sealedPagePrefix starts every page token sealed with PageTokenKeys, followed by the key ID and the sealed key.
+const sealedPagePrefix = "p1."
+
+// PageTokenKeys encrypts and authenticates the page tokens Query returns with AES-GCM, so that callers cannot
+// read or edit them. A sealed token is bound to the table, index, key condition and WithFilters filter of the
+// Query that issued it, and passing it to any other Query returns an InvalidArgumentError.
+//
+// To rotate keys, add a new key and make it Current. Tokens sealed with the old key are accepted until it is
+// removed from Keys.
+type PageTokenKeys struct {
+	// Current is the ID of the key new tokens are sealed with. IDs cannot contain a dot.
+	Current string
+	// Keys maps key IDs to AES keys of 16, 24 or 32 bytes.
+	Keys map[string][]byte
+}
+
+func (k *PageTokenKeys) aead(id string) (cipher.AEAD, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", id, err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts a LastEvaluatedKey with the current key, authenticating binding with it.
+func (k *PageTokenKeys) seal(key map[string]types.AttributeValue, binding []byte) (string, error) {
+	if k.Current == "" || strings.Contains(k.Current, ".") {
+		return "", fmt.Errorf("invalid current key ID %q", k.Current)
+	}
+	aead, err := k.aead(k.Current)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := avjson.MarshalItem(key)
+	if err != nil {
+		return "", fmt.Errorf("avjson.MarshalItem: %w", err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("rand.Read: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, binding)
+
+	return sealedPagePrefix + k.Current + "." + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a token from seal. Any token that was not sealed by one of the keys for the same binding is
+// an InvalidArgumentError.
+func (k *PageTokenKeys) open(token string, binding []byte) (map[string]types.AttributeValue, error) {
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(token, sealedPagePrefix), ".")
+	if !strings.HasPrefix(token, sealedPagePrefix) || !ok {
+		return nil, &InvalidArgumentError{err: errors.New("page token is not sealed")}
+	}
+
+	aead, err := k.aead(id)
+	if err != nil {
+		return nil, &InvalidArgumentError{err: fmt.Errorf("page token: %w", err)}
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, &InvalidArgumentError{err: errors.New("page token is malformed")}
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, binding)
+	if err != nil {
+		return nil, &InvalidArgumentError{err: errors.New("page token was altered or issued for a different query")}
+	}
+
+	key, err := avjson.UnmarshalItem(plaintext)
+	if err != nil {
+		return nil, &InternalError{err: fmt.Errorf("page token: avjson.UnmarshalItem: %w", err)}
+	}
+	return key, nil
+}
+
+// pageBinding identifies the query a sealed page token may be used with. Filters added by the Client, such as
+// the expiry filter, are left out because they change between pages. The key condition and filter are not yet
+// scoped to the tenant, so the tenant is bound separately.
+func pageBinding(table, tenant, indexName string, keyCondition expression.KeyConditionBuilder, filter *expression.ConditionBuilder) ([]byte, error) {
+	builder := expression.NewBuilder().WithKeyCondition(keyCondition)
+	if filter != nil {
+		builder = builder.WithFilter(*filter)
+	}
+	expr, err := builder.Build()
+	if err != nil {
+		return nil, fmt.Errorf("expression builder: %w", err)
+	}
+
+	names, err := json.Marshal(expr.Names())
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal: %w", err)
+	}
+	values, err := avjson.MarshalItem(expr.Values())
+	if err != nil {
+		return nil, fmt.Errorf("avjson.MarshalItem: %w", err)
+	}
+
+	var filterExpr string
+	if expr.Filter() != nil {
+		filterExpr = *expr.Filter()
+	}
+
+	hash := sha256.New()
+	writeParts(hash, []byte(table), []byte(tenant), []byte(indexName), []byte(*expr.KeyCondition()), []byte(filterExpr), names, values)
+	return hash.Sum(nil), nil
+}
+
+// isSealedPage reports whether a page token was sealed with PageTokenKeys.
+func isSealedPage(token string) bool {
+	return strings.HasPrefix(token, sealedPagePrefix)
+}
+
+// openPage returns the ExclusiveStartKey for a token passed to WithPage.
+func (c *Client) openPage(token string, binding []byte) (map[string]types.AttributeValue, error) {
+	if token == "" {
+		return nil, nil
+	}
+	if c.PageTokenKeys != nil {
+		return c.PageTokenKeys.open(token, binding)
+	}
+	if isSealedPage(token) {
+		return nil, &InvalidArgumentError{err: errors.New("page token is sealed but the client has no PageTokenKeys")}
+	}
+	return DeserializeExclusiveStartKey(token)
+}
+
+// sealPage returns the token for a LastEvaluatedKey, sealed if the Client has PageTokenKeys.
+func (c *Client) sealPage(key map[string]types.AttributeValue, binding []byte) (string, error) {
+	if c.PageTokenKeys != nil {
+		token, err := c.PageTokenKeys.seal(key, binding)
+		if err != nil {
+			return "", fmt.Errorf("seal page token: %w", err)
+		}
+		return token, nil
+	}
+	token, err := SerializeExclusiveStartKey(key)
+	if err != nil {
+		return "", fmt.Errorf("SerializeExclusiveStartKey: %w", err)
+	}
+	return token, nil
+}
@@ -0,0 +1,146 @@
+package ddb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+type pageTokenRow struct {
+	RowHeader
+	Name string
+}
+
+func TestPageTokenKeys(t *testing.T) {
+	t.Parallel()
+
+	keys := &PageTokenKeys{Current: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+	client, _ := newTestClient(t, TableSpec{}, func(c *Client) { c.PageTokenKeys = keys })
+	ctx := context.Background()
+
+	for _, pk := range []string{"TENANT#1", "TENANT#2"} {
+		for _, sk := range []string{"A", "B", "C"} {
+			row := pageTokenRow{RowHeader: RowHeader{PK: pk, SK: sk, RowType: "NOTE"}, Name: sk}
+			if err := client.Put(ctx, row); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	}
+
+	firstPage := func(t *testing.T, pk string) string {
+		t.Helper()
+		var rows []pageTokenRow
+		var token string
+		if err := client.Query(ctx, KeyPkOnly(pk), &rows, WithPage("", &token), WithPageSize(1)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !isSealedPage(token) {
+			t.Fatalf("expected a sealed token, got: %q", token)
+		}
+		return token
+	}
+
+	isInvalidArgument := func(err error) bool {
+		var invalidArgumentErr *InvalidArgumentError
+		return errors.As(err, &invalidArgumentErr)
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		token := firstPage(t, "TENANT#1")
+
+		var rows []pageTokenRow
+		if err := client.Query(ctx, KeyPkOnly("TENANT#1"), &rows, WithPage(token, &token), WithPageSize(1)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(rows) != 1 || rows[0].SK != "B" {
+			t.Errorf("unexpected rows: %+v", rows)
+		}
+	})
+
+	t.Run("different partition key", func(t *testing.T) {
+		token := firstPage(t, "TENANT#1")
+
+		var rows []pageTokenRow
+		err := client.Query(ctx, KeyPkOnly("TENANT#2"), &rows, WithPage(token, &token))
+		if !isInvalidArgument(err) {
+			t.Errorf("expected InvalidArgumentError, got: %v", err)
+		}
+	})
+
+	t.Run("different filter", func(t *testing.T) {
+		token := firstPage(t, "TENANT#1")
+
+		var rows []pageTokenRow
+		filter := expression.Name("Name").NotEqual(expression.Value("C"))
+		err := client.Query(ctx, KeyPkOnly("TENANT#1"), &rows, WithPage(token, &token), WithFilters(filter))
+		if !isInvalidArgument(err) {
+			t.Errorf("expected InvalidArgumentError, got: %v", err)
+		}
+	})
+
+	t.Run("different index", func(t *testing.T) {
+		token := firstPage(t, "TENANT#1")
+
+		var rows []pageTokenRow
+		err := client.Query(ctx, KeyPkOnly("TENANT#1"), &rows, WithPage(token, &token), WithIndexLSI1())
+		if !isInvalidArgument(err) {
+			t.Errorf("expected InvalidArgumentError, got: %v", err)
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		token := firstPage(t, "TENANT#1")
+		middle := len(token) / 2
+		flipped := byte('A')
+		if token[middle] == 'A' {
+			flipped = 'B'
+		}
+		tampered := token[:middle] + string(flipped) + token[middle+1:]
+
+		var rows []pageTokenRow
+		if err := client.Query(ctx, KeyPkOnly("TENANT#1"), &rows, WithPage(tampered, &token)); !isInvalidArgument(err) {
+			t.Errorf("expected InvalidArgumentError, got: %v", err)
+		}
+	})
+
+	t.Run("plain token", func(t *testing.T) {
+		plain, err := SerializeExclusiveStartKey(itemKey("TENANT#2", "A"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var rows []pageTokenRow
+		if err := client.Query(ctx, KeyPkOnly("TENANT#2"), &rows, WithPage(plain, &plain)); !isInvalidArgument(err) {
+			t.Errorf("expected InvalidArgumentError, got: %v", err)
+		}
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		token := firstPage(t, "TENANT#1")
+
+		rotated := &Client{Ddb: client.Ddb, Table: client.Table, PageTokenKeys: &PageTokenKeys{
+			Current: "k2",
+			Keys:    map[string][]byte{"k1": keys.Keys["k1"], "k2": bytes.Repeat([]byte{2}, 32)},
+		}}
+
+		var rows []pageTokenRow
+		if err := rotated.Query(ctx, KeyPkOnly("TENANT#1"), &rows, WithPage(token, &token), WithPageSize(1)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if token[:len(sealedPagePrefix+"k2.")] != sealedPagePrefix+"k2." {
+			t.Errorf("expected a token sealed with the new key, got: %q", token)
+		}
+
+		retired := &Client{Ddb: client.Ddb, Table: client.Table, PageTokenKeys: &PageTokenKeys{
+			Current: "k2",
+			Keys:    map[string][]byte{"k2": rotated.PageTokenKeys.Keys["k2"]},
+		}}
+		oldToken := firstPage(t, "TENANT#1")
+		if err := retired.Query(ctx, KeyPkOnly("TENANT#1"), &rows, WithPage(oldToken, &oldToken)); !isInvalidArgument(err) {
+			t.Errorf("expected InvalidArgumentError, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,308 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+const (
+	// rateIncrease is the fraction of the target a throttled rate recovers by on every successful request.
+	rateIncrease = 0.05
+
+	// minRate is the fraction of the target a rate is never backed off below.
+	minRate = 1.0 / 64
+)
+
+// RateLimiter paces requests so a background job stays under a target of read and write capacity units per
+// second, leaving the rest of a table's capacity to other traffic. The capacity a request will consume is
+// estimated from earlier requests and corrected with the ConsumedCapacity of its response. When DynamoDB
+// throttles a request, the rate is halved, and it recovers gradually as requests succeed.
+//
+// A RateLimiter is attached to every call of a Client with Client.RateLimiter, or to the calls made with one
+// context with WithRateLimiter. It can be shared by the Clients of a job.
+type RateLimiter struct {
+	// ReadCapacity is the target of read capacity units per second. Zero leaves reads unlimited.
+	ReadCapacity float64
+
+	// WriteCapacity is the target of write capacity units per second. Zero leaves writes unlimited.
+	WriteCapacity float64
+
+	once  sync.Once
+	mu    sync.Mutex
+	read  bucket
+	write bucket
+
+	// now and sleep are replaced in tests.
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// bucket is a token bucket of capacity units that can go into debt, so a request larger than the bucket
+// waits for the time its capacity takes to refill instead of being refused.
+type bucket struct {
+	target   float64
+	rate     float64
+	tokens   float64
+	last     time.Time
+	estimate float64
+}
+
+type rateLimiterKey struct{}
+
+// WithRateLimiter returns a context whose Client calls are paced by l, instead of by Client.RateLimiter.
+func WithRateLimiter(ctx context.Context, l *RateLimiter) context.Context {
+	return context.WithValue(ctx, rateLimiterKey{}, l)
+}
+
+func (l *RateLimiter) init() {
+	l.once.Do(func() {
+		if l.now == nil {
+			l.now = time.Now
+		}
+		if l.sleep == nil {
+			l.sleep = sleep
+		}
+		now := l.now()
+		l.read = bucket{target: l.ReadCapacity, rate: l.ReadCapacity, last: now, estimate: 1}
+		l.write = bucket{target: l.WriteCapacity, rate: l.WriteCapacity, last: now, estimate: 1}
+	})
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RateLimitOptions returns the options that pace a request made with Client.Ddb directly, as the calls of the
+// Client are paced. Packages that build their own requests, such as migrate, pass them to every call.
+func (c *Client) RateLimitOptions(ctx context.Context) []func(*dynamodb.Options) {
+	return c.rateLimit(ctx)
+}
+
+// rateLimit returns the options that attach the RateLimiter of ctx, or else of the Client, to a request.
+func (c *Client) rateLimit(ctx context.Context) []func(*dynamodb.Options) {
+	l, _ := ctx.Value(rateLimiterKey{}).(*RateLimiter)
+	if l == nil {
+		l = c.RateLimiter
+	}
+	if l == nil {
+		return nil
+	}
+	return []func(*dynamodb.Options){func(o *dynamodb.Options) {
+		o.APIOptions = append(o.APIOptions, l.addMiddleware)
+	}}
+}
+
+func (l *RateLimiter) addMiddleware(stack *middleware.Stack) error {
+	l.init()
+
+	returnCapacity := middleware.InitializeMiddlewareFunc("ddb.ReturnConsumedCapacity", func(
+		ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+	) (middleware.InitializeOutput, middleware.Metadata, error) {
+		requestConsumedCapacity(in.Parameters)
+		return next.HandleInitialize(ctx, in)
+	})
+	if err := stack.Initialize.Add(returnCapacity, middleware.After); err != nil {
+		return err
+	}
+
+	pace := middleware.FinalizeMiddlewareFunc("ddb.RateLimiter", func(
+		ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler,
+	) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		b := l.bucket(awsmiddleware.GetOperationName(ctx))
+		if b == nil {
+			return next.HandleFinalize(ctx, in)
+		}
+
+		estimate, err := l.reserve(ctx, b)
+		if err != nil {
+			return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+		}
+		out, metadata, err := next.HandleFinalize(ctx, in)
+		switch {
+		case isThrottled(err):
+			l.settle(b, estimate, 0, true)
+		case err != nil:
+			l.settle(b, estimate, estimate, false)
+		default:
+			consumed, ok := consumedCapacity(out.Result)
+			if !ok {
+				consumed = estimate
+			}
+			l.settle(b, estimate, consumed, false)
+		}
+		return out, metadata, err
+	})
+	// after the retry middleware, so every attempt is paced
+	retryID := (*retry.Attempt)(nil).ID()
+	if _, ok := stack.Finalize.Get(retryID); ok {
+		return stack.Finalize.Insert(pace, retryID, middleware.After)
+	}
+	return stack.Finalize.Add(pace, middleware.After)
+}
+
+// bucket returns the bucket an operation draws from, or nil if it is not limited.
+func (l *RateLimiter) bucket(operation string) *bucket {
+	var b *bucket
+	switch operation {
+	case "GetItem", "Query", "Scan", "BatchGetItem", "TransactGetItems":
+		b = &l.read
+	case "PutItem", "UpdateItem", "DeleteItem", "BatchWriteItem", "TransactWriteItems":
+		b = &l.write
+	default:
+		return nil
+	}
+	if b.target <= 0 {
+		return nil
+	}
+	return b
+}
+
+// reserve takes the estimated capacity of a request from b and waits until the bucket is out of debt.
+func (l *RateLimiter) reserve(ctx context.Context, b *bucket) (float64, error) {
+	l.mu.Lock()
+	b.refill(l.now())
+	estimate := b.estimate
+	b.tokens -= estimate
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait > 0 {
+		if err := l.sleep(ctx, wait); err != nil {
+			// the request is not made, so its capacity is returned
+			l.mu.Lock()
+			b.tokens += estimate
+			l.mu.Unlock()
+			return 0, err
+		}
+	}
+	return estimate, nil
+}
+
+// settle corrects b by the capacity a request consumed and adapts the rate.
+func (l *RateLimiter) settle(b *bucket, estimate, consumed float64, throttled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b.tokens += estimate - consumed
+	if throttled {
+		b.rate = math.Max(b.rate/2, b.target*minRate)
+		b.tokens = math.Min(b.tokens, 0)
+		return
+	}
+	b.rate = math.Min(b.rate+b.target*rateIncrease, b.target)
+	if consumed > 0 {
+		b.estimate = 0.8*b.estimate + 0.2*consumed
+	}
+}
+
+// refill adds the tokens accrued since the last refill. At most a second of tokens is kept.
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(b.tokens+b.rate*now.Sub(b.last).Seconds(), b.rate)
+	b.last = now
+}
+
+func isThrottled(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	_, ok := retry.DefaultThrottleErrorCodes[apiErr.ErrorCode()]
+	return ok
+}
+
+// requestConsumedCapacity asks for the consumed capacity in the response of a request that does not already.
+func requestConsumedCapacity(params any) {
+	var mode *types.ReturnConsumedCapacity
+	switch in := params.(type) {
+	case *dynamodb.GetItemInput:
+		mode = &in.ReturnConsumedCapacity
+	case *dynamodb.QueryInput:
+		mode = &in.ReturnConsumedCapacity
+	case *dynamodb.ScanInput:
+		mode = &in.ReturnConsumedCapacity
+	case *dynamodb.BatchGetItemInput:
+		mode = &in.ReturnConsumedCapacity
+	case *dynamodb.TransactGetItemsInput:
+		mode = &in.ReturnConsumedCapacity
+	case *dynamodb.PutItemInput:
+		mode = &in.ReturnConsumedCapacity
+	case *dynamodb.UpdateItemInput:
+		mode = &in.ReturnConsumedCapacity
+	case *dynamodb.DeleteItemInput:
+		mode = &in.ReturnConsumedCapacity
+	case *dynamodb.BatchWriteItemInput:
+		mode = &in.ReturnConsumedCapacity
+	case *dynamodb.TransactWriteItemsInput:
+		mode = &in.ReturnConsumedCapacity
+	default:
+		return
+	}
+	if *mode == "" || *mode == types.ReturnConsumedCapacityNone {
+		*mode = types.ReturnConsumedCapacityTotal
+	}
+}
+
+// consumedCapacity returns the capacity units a response reports, and false if it reports none.
+func consumedCapacity(result any) (float64, bool) {
+	var capacities []types.ConsumedCapacity
+	switch out := result.(type) {
+	case *dynamodb.GetItemOutput:
+		capacities = single(out.ConsumedCapacity)
+	case *dynamodb.QueryOutput:
+		capacities = single(out.ConsumedCapacity)
+	case *dynamodb.ScanOutput:
+		capacities = single(out.ConsumedCapacity)
+	case *dynamodb.BatchGetItemOutput:
+		capacities = out.ConsumedCapacity
+	case *dynamodb.TransactGetItemsOutput:
+		capacities = out.ConsumedCapacity
+	case *dynamodb.PutItemOutput:
+		capacities = single(out.ConsumedCapacity)
+	case *dynamodb.UpdateItemOutput:
+		capacities = single(out.ConsumedCapacity)
+	case *dynamodb.DeleteItemOutput:
+		capacities = single(out.ConsumedCapacity)
+	case *dynamodb.BatchWriteItemOutput:
+		capacities = out.ConsumedCapacity
+	case *dynamodb.TransactWriteItemsOutput:
+		capacities = out.ConsumedCapacity
+	}
+	if len(capacities) == 0 {
+		return 0, false
+	}
+
+	units := 0.0
+	for _, c := range capacities {
+		if c.CapacityUnits != nil {
+			units += *c.CapacityUnits
+		}
+	}
+	return units, true
+}
+
+func single(c *types.ConsumedCapacity) []types.ConsumedCapacity {
+	if c == nil {
+		return nil
+	}
+	return []types.ConsumedCapacity{*c}
+}
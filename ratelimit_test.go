@@ -0,0 +1,118 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/danielwchapman/ddb/ddblocal"
+)
+
+// newFakeClockLimiter returns a RateLimiter whose sleeps advance a fake clock instead of waiting.
+func newFakeClockLimiter(read, write float64) (*RateLimiter, *time.Duration) {
+	now := time.Unix(0, 0)
+	slept := new(time.Duration)
+	l := &RateLimiter{ReadCapacity: read, WriteCapacity: write}
+	l.now = func() time.Time { return now }
+	l.sleep = func(_ context.Context, d time.Duration) error {
+		*slept += d
+		now = now.Add(d)
+		return nil
+	}
+	return l, slept
+}
+
+func newRateLimitedClient(t *testing.T) (*Client, *ddblocal.Server) {
+	t.Helper()
+
+	client, server := newTestClient(t, TableSpec{}, nil)
+	client.Ddb = server.DynamoDB(func(o *dynamodb.Options) {
+		o.Retryer = retry.AddWithMaxBackoffDelay(retry.NewStandard(), time.Millisecond)
+	})
+	return client, server
+}
+
+type rateLimitedRow struct {
+	RowHeader
+	Data string
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newRateLimitedClient(t)
+	limiter, slept := newFakeClockLimiter(0, 100)
+	client.RateLimiter = limiter
+	ctx := context.Background()
+
+	// each row is just over 3 KB, so every Put consumes 4 write units
+	for i := 0; i < 50; i++ {
+		row := rateLimitedRow{RowHeader: RowHeader{PK: fmt.Sprintf("ROW#%d", i), SK: "A"}, Data: strings.Repeat("x", 3100)}
+		if err := client.Put(ctx, row); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// 200 units at 100 per second, less the units left over at the end
+	if *slept < 1900*time.Millisecond || *slept > 2*time.Second {
+		t.Errorf("expected about 2s of waiting, got: %v", *slept)
+	}
+	if math.Abs(limiter.write.estimate-4) > 0.01 {
+		t.Errorf("expected the estimate to converge on 4 units, got: %v", limiter.write.estimate)
+	}
+
+	// reads are not limited
+	var got rateLimitedRow
+	before := *slept
+	if err := client.Get(ctx, "ROW#1", "A", &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *slept != before {
+		t.Errorf("expected reads not to wait")
+	}
+}
+
+func TestRateLimiterThrottled(t *testing.T) {
+	t.Parallel()
+
+	client, server := newRateLimitedClient(t)
+	limiter, _ := newFakeClockLimiter(100, 0)
+	ctx := WithRateLimiter(context.Background(), limiter)
+
+	// the SDK retries the throttled attempts, and each one halves the rate
+	server.Store.Throttle(2)
+	var got rateLimitedRow
+	if err := client.Get(ctx, "ROW#1", "A", &got); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got: %v", err)
+	}
+	if limiter.read.rate != 25+100*rateIncrease {
+		t.Errorf("expected the rate to be backed off, got: %v", limiter.read.rate)
+	}
+
+	for i := 0; i < 30; i++ {
+		_ = client.Get(ctx, "ROW#1", "A", &got)
+	}
+	if limiter.read.rate != 100 {
+		t.Errorf("expected the rate to recover, got: %v", limiter.read.rate)
+	}
+}
+
+func TestRateLimiterCanceled(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newRateLimitedClient(t)
+	client.RateLimiter = &RateLimiter{ReadCapacity: 0.001}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var got rateLimitedRow
+	if err := client.Get(ctx, "ROW#1", "A", &got); err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("expected a deadline error, got: %v", err)
+	}
+}
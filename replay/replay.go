@@ -0,0 +1,284 @@
+// Package replay records DynamoDB interactions to golden files and replays them, so tests that ran once
+// against a real table can run deterministically in CI.
+//
+// A Transport is installed as the HTTP client of Client.Ddb:
+//
+//	tr := replay.New(t, "testdata/orders.json", replay.ModeFromEnv(), nil)
+//	client := &ddb.Client{
+//		Ddb: dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+//			o.HTTPClient = tr.HTTPClient()
+//		}),
+//		Table: "Orders",
+//	}
+//
+// Only the operation, the request body and a few response headers are recorded. Credentials, signatures
+// and other request headers are never written to the golden file.
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Mode selects whether a Transport records or replays.
+type Mode int
+
+const (
+	ModeReplay Mode = iota
+	ModeRecord
+)
+
+// RecordEnv is the environment variable read by ModeFromEnv.
+const RecordEnv = "DDB_RECORD"
+
+// ModeFromEnv returns ModeRecord when the DDB_RECORD environment variable is set, otherwise ModeReplay.
+func ModeFromEnv() Mode {
+	if os.Getenv(RecordEnv) != "" {
+		return ModeRecord
+	}
+	return ModeReplay
+}
+
+// recordedHeaders are the response headers kept in golden files. The CRC32 checksum header is dropped
+// because golden files are reformatted when written.
+var recordedHeaders = []string{"Content-Type", "X-Amzn-ErrorType"}
+
+// Interaction is one recorded request and its response.
+type Interaction struct {
+	Operation string
+	Request   json.RawMessage
+	Status    int
+	Headers   map[string]string `json:",omitempty"`
+	Response  json.RawMessage
+}
+
+type golden struct {
+	Interactions []Interaction
+}
+
+// Transport is an http.RoundTripper that records or replays DynamoDB interactions.
+type Transport struct {
+	t    testing.TB
+	path string
+	mode Mode
+	next http.RoundTripper
+
+	// IgnoreFields are top level request fields removed before requests are recorded or matched, for
+	// values that change between runs such as generated ClientRequestTokens.
+	IgnoreFields []string
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// New returns a Transport for the golden file at path. In ModeRecord requests are sent through next
+// (http.DefaultTransport if nil) and the golden file is written when the test finishes. In ModeReplay the
+// golden file is loaded and every request must match an unused recorded interaction with the same operation
+// and normalized body, or the test fails.
+func New(t testing.TB, path string, mode Mode, next http.RoundTripper) *Transport {
+	t.Helper()
+
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	tr := &Transport{t: t, path: path, mode: mode, next: next}
+
+	switch mode {
+	case ModeRecord:
+		t.Cleanup(func() {
+			if err := tr.save(); err != nil {
+				t.Errorf("replay: %v", err)
+			}
+		})
+	default:
+		if err := tr.load(); err != nil {
+			t.Fatalf("replay: %v", err)
+		}
+	}
+
+	return tr
+}
+
+// HTTPClient returns an http.Client using the Transport, for use as dynamodb.Options.HTTPClient.
+func (tr *Transport) HTTPClient() *http.Client {
+	return &http.Client{Transport: tr}
+}
+
+func (tr *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("replay: read request body: %w", err)
+		}
+		_ = req.Body.Close()
+	}
+
+	operation := operationOf(req)
+
+	normalized, err := normalize(body, tr.IgnoreFields)
+	if err != nil {
+		return nil, fmt.Errorf("replay: normalize %s request: %w", operation, err)
+	}
+
+	if tr.mode == ModeRecord {
+		return tr.record(req, body, operation, normalized)
+	}
+
+	return tr.replay(req, operation, normalized)
+}
+
+func (tr *Transport) record(req *http.Request, body []byte, operation string, normalized json.RawMessage) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	resp, err := tr.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("replay: read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	if len(bytes.TrimSpace(respBody)) == 0 {
+		respBody = []byte("{}")
+	}
+
+	interaction := Interaction{
+		Operation: operation,
+		Request:   normalized,
+		Status:    resp.StatusCode,
+		Headers:   map[string]string{},
+		Response:  respBody,
+	}
+	for _, h := range recordedHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			interaction.Headers[h] = v
+		}
+	}
+
+	tr.mu.Lock()
+	tr.interactions = append(tr.interactions, interaction)
+	tr.mu.Unlock()
+
+	return resp, nil
+}
+
+func (tr *Transport) replay(req *http.Request, operation string, normalized json.RawMessage) (*http.Response, error) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	for i, interaction := range tr.interactions {
+		if tr.used[i] || interaction.Operation != operation || !bytes.Equal(interaction.Request, normalized) {
+			continue
+		}
+		tr.used[i] = true
+
+		header := http.Header{}
+		for k, v := range interaction.Headers {
+			header.Set(k, v)
+		}
+
+		return &http.Response{
+			Status:        http.StatusText(interaction.Status),
+			StatusCode:    interaction.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(interaction.Response)),
+			ContentLength: int64(len(interaction.Response)),
+			Request:       req,
+		}, nil
+	}
+
+	tr.t.Errorf("replay: no recorded interaction matches %s %s", operation, normalized)
+	return nil, fmt.Errorf("replay: no recorded interaction matches %s", operation)
+}
+
+func (tr *Transport) load() error {
+	data, err := os.ReadFile(tr.path)
+	if err != nil {
+		return fmt.Errorf("load: %w", err)
+	}
+
+	var g golden
+	if err := json.Unmarshal(data, &g); err != nil {
+		return fmt.Errorf("load: %s: %w", tr.path, err)
+	}
+
+	// recorded requests are compacted again so they compare equal to normalized requests
+	for i := range g.Interactions {
+		if g.Interactions[i].Request, err = normalize(g.Interactions[i].Request, nil); err != nil {
+			return fmt.Errorf("load: %s: %w", tr.path, err)
+		}
+	}
+
+	tr.interactions = g.Interactions
+	tr.used = make([]bool, len(g.Interactions))
+	return nil
+}
+
+func (tr *Transport) save() error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	data, err := json.MarshalIndent(golden{Interactions: tr.interactions}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(tr.path), 0o755); err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+
+	if err := os.WriteFile(tr.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+
+	return nil
+}
+
+// operationOf returns the DynamoDB operation from the X-Amz-Target header, e.g. "PutItem".
+func operationOf(req *http.Request) string {
+	target := req.Header.Get("X-Amz-Target")
+	return target[strings.LastIndex(target, ".")+1:]
+}
+
+// normalize compacts a JSON body with sorted object keys, without the ignored top level fields.
+func normalize(body []byte, ignore []string) (json.RawMessage, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return json.RawMessage("{}"), nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	if m, ok := v.(map[string]any); ok {
+		for _, field := range ignore {
+			delete(m, field)
+		}
+	}
+
+	return json.Marshal(v)
+}
@@ -0,0 +1,76 @@
+package replay
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/danielwchapman/ddb"
+	"github.com/danielwchapman/ddb/ddblocal"
+)
+
+type testRow struct {
+	PK    string
+	SK    string
+	Value int
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "golden.json")
+	want := testRow{PK: "PK#1", SK: "SK#1", Value: 42}
+
+	exercise := func(t *testing.T, client *ddb.Client) {
+		ctx := context.Background()
+
+		if err := client.Put(ctx, want); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var got testRow
+		if err := client.Get(ctx, want.PK, want.SK, &got); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("unexpected diff: %s", diff)
+		}
+	}
+
+	t.Run("record", func(t *testing.T) {
+		server := ddblocal.NewServer()
+		t.Cleanup(server.Close)
+
+		client := &ddb.Client{Ddb: server.DynamoDB(), Table: "Test"}
+		if err := client.CreateTable(context.Background(), ddb.TableSpec{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		tr := New(t, path, ModeRecord, nil)
+		client.Ddb = server.DynamoDB(func(o *dynamodb.Options) {
+			o.HTTPClient = tr.HTTPClient()
+		})
+
+		exercise(t, client)
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		tr := New(t, path, ModeReplay, nil)
+
+		// the endpoint is never contacted when replaying
+		client := &ddb.Client{
+			Ddb: dynamodb.New(dynamodb.Options{
+				Region:       "local",
+				BaseEndpoint: new(string),
+				HTTPClient:   tr.HTTPClient(),
+			}),
+			Table: "Test",
+		}
+
+		exercise(t, client)
+	})
+}
@@ -0,0 +1,156 @@
+package ddb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const rowTypeColumn = "RowType"
+
+// RowTypes maps RowType values (see RowHeader) to Go types, so that a Query returning a mix of entities from
+// one partition can decode each item into the right type.
+type RowTypes struct {
+	types map[string]reflect.Type
+}
+
+func NewRowTypes() *RowTypes {
+	return &RowTypes{types: map[string]reflect.Type{}}
+}
+
+// Register maps rowType to the type of prototype, e.g. Register("USER", User{}). It returns the receiver so
+// calls can be chained. It panics if prototype is nil, as there is no type to register; a typed nil pointer
+// such as (*User)(nil) registers User.
+func (r *RowTypes) Register(rowType string, prototype any) *RowTypes {
+	t := reflect.TypeOf(prototype)
+	if t == nil {
+		panic(fmt.Sprintf("ddb: RowTypes.Register(%q, nil): prototype must not be nil", rowType))
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	r.types[rowType] = t
+	return r
+}
+
+// New returns a pointer to a new zero value of the type registered for rowType.
+func (r *RowTypes) New(rowType string) (any, bool) {
+	t, ok := r.types[rowType]
+	if !ok {
+		return nil, false
+	}
+	return reflect.New(t).Interface(), true
+}
+
+// Unmarshal decodes each item into the type registered for its RowType. out must be a *[]any, which receives
+// values of the registered types, or a pointer to a struct with slice fields, e.g.
+//
+//	var out struct {
+//		Users  []User
+//		Orders []*Order
+//	}
+//
+// where each item is appended to the field whose element type matches its registered type. Items with an
+// unregistered RowType are an error.
+func (r *RowTypes) Unmarshal(items []map[string]types.AttributeValue, out any) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return &InvalidArgumentError{err: errors.New("RowTypes.Unmarshal: out must be a non-nil pointer")}
+	}
+	v = v.Elem()
+
+	var appendFn func(item reflect.Value) error
+
+	switch {
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Interface:
+		appendFn = func(item reflect.Value) error {
+			v.Set(reflect.Append(v, item.Elem()))
+			return nil
+		}
+	case v.Kind() == reflect.Struct:
+		appendFn = func(item reflect.Value) error {
+			field, ok := sliceFieldFor(v, item.Type())
+			if !ok {
+				return fmt.Errorf("no field for %s", item.Type().Elem())
+			}
+			if field.Type().Elem().Kind() == reflect.Pointer {
+				field.Set(reflect.Append(field, item))
+			} else {
+				field.Set(reflect.Append(field, item.Elem()))
+			}
+			return nil
+		}
+	default:
+		return &InvalidArgumentError{err: errors.New("RowTypes.Unmarshal: out must point to a []any or a struct")}
+	}
+
+	for i := range items {
+		rowType, err := RowTypeOf(items[i])
+		if err != nil {
+			return fmt.Errorf("RowTypes.Unmarshal: %w", err)
+		}
+
+		item, ok := r.New(rowType)
+		if !ok {
+			return fmt.Errorf("RowTypes.Unmarshal: unregistered RowType %q", rowType)
+		}
+
+		if err := attributevalue.UnmarshalMap(items[i], item); err != nil {
+			return fmt.Errorf("RowTypes.Unmarshal: UnmarshalMap: %w", err)
+		}
+
+		if err := appendFn(reflect.ValueOf(item)); err != nil {
+			return fmt.Errorf("RowTypes.Unmarshal: RowType %q: %w", rowType, err)
+		}
+	}
+
+	return nil
+}
+
+// RowTypeOf returns the RowType attribute of an item.
+func RowTypeOf(item map[string]types.AttributeValue) (string, error) {
+	v, ok := item[rowTypeColumn].(*types.AttributeValueMemberS)
+	if !ok {
+		return "", errors.New("item has no RowType")
+	}
+	return v.Value, nil
+}
+
+// sliceFieldFor finds the first exported slice field of v whose elements are of type ptr or ptr.Elem().
+func sliceFieldFor(v reflect.Value, ptr reflect.Type) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		if !v.Type().Field(i).IsExported() {
+			continue
+		}
+		field := v.Field(i)
+		if field.Kind() != reflect.Slice {
+			continue
+		}
+		if elem := field.Type().Elem(); elem == ptr || elem == ptr.Elem() {
+			return field, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// typeOf returns the type registered for the RowType of item, or nil if there is none.
+func (r *RowTypes) typeOf(item map[string]types.AttributeValue) reflect.Type {
+	rowType, err := RowTypeOf(item)
+	if err != nil {
+		return nil
+	}
+	return r.types[rowType]
+}
+
+// WithRowTypes decodes Query results with RowTypes.Unmarshal. Encrypted and compressed fields are decoded by
+// the type registered for the RowType of each item. For use with Query.
+func WithRowTypes(rowTypes *RowTypes) Option {
+	return func(options *options) error {
+		options.rowTypes = rowTypes
+		options.unmarshalFn = rowTypes.Unmarshal
+		return nil
+	}
+}
@@ -0,0 +1,88 @@
+package ddb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+type testUser struct {
+	RowHeader
+	Name string
+}
+
+type testOrder struct {
+	RowHeader
+	Total int
+}
+
+func TestRowTypesUnmarshal(t *testing.T) {
+	t.Parallel()
+
+	user := testUser{RowHeader: RowHeader{PK: "USER#1", SK: "USER#1", RowType: "USER"}, Name: "Ann"}
+	order1 := testOrder{RowHeader: RowHeader{PK: "USER#1", SK: "ORDER#1", RowType: "ORDER"}, Total: 10}
+	order2 := testOrder{RowHeader: RowHeader{PK: "USER#1", SK: "ORDER#2", RowType: "ORDER"}, Total: 20}
+
+	items := make([]map[string]types.AttributeValue, 0, 3)
+	for _, row := range []any{user, order1, order2} {
+		item, err := attributevalue.MarshalMap(row)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		items = append(items, item)
+	}
+
+	rowTypes := NewRowTypes().
+		Register("USER", testUser{}).
+		Register("ORDER", &testOrder{})
+
+	t.Run("slice of any", func(t *testing.T) {
+		var got []any
+		if err := rowTypes.Unmarshal(items, &got); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([]any{user, order1, order2}, got); diff != "" {
+			t.Errorf("unexpected diff: %s", diff)
+		}
+	})
+
+	t.Run("struct of typed slices", func(t *testing.T) {
+		var got struct {
+			Users  []testUser
+			Orders []*testOrder
+		}
+		if err := rowTypes.Unmarshal(items, &got); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if diff := cmp.Diff([]testUser{user}, got.Users); diff != "" {
+			t.Errorf("unexpected diff: %s", diff)
+		}
+		if diff := cmp.Diff([]*testOrder{&order1, &order2}, got.Orders); diff != "" {
+			t.Errorf("unexpected diff: %s", diff)
+		}
+	})
+
+	t.Run("unregistered RowType", func(t *testing.T) {
+		var got []any
+		if err := NewRowTypes().Register("USER", testUser{}).Unmarshal(items, &got); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+}
+
+func TestRowTypesRegisterNil(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "prototype must not be nil") {
+			t.Errorf("expected a panic for a nil prototype, got: %v", r)
+		}
+	}()
+	NewRowTypes().Register("USER", nil)
+}
@@ -0,0 +1,343 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// deletedAtColumn marks a soft-deleted row.
+const deletedAtColumn = "DeletedAt"
+
+// archivedIndexKeysColumn holds the index keys of an archived row, which are removed from the row itself so it
+// drops out of the indexes, until Restore puts them back.
+const archivedIndexKeysColumn = "ArchivedIndexKeys"
+
+// notDeletedCondition is added to soft deletes so that a missing or already deleted row is not written.
+const notDeletedCondition = "attribute_exists(PK) AND attribute_not_exists(" + deletedAtColumn + ")"
+
+// SoftDelete makes Delete and TransactDeletes mark rows as deleted instead of removing them. Get and Query
+// exclude soft-deleted rows unless WithIncludeDeleted is passed, and Restore undoes a soft delete.
+type SoftDelete struct {
+	// ArchivePrefix, if set, moves soft-deleted rows to the SK ArchivePrefix + SK in the same transaction
+	// that marks them, so they drop out of queries on the original sort key range. Their index keys are set
+	// aside until Restore, so they drop out of the indexes too. The move fails if the row changes after it
+	// is read.
+	ArchivePrefix string
+}
+
+// RowSoftDeleteHeader is embedded in rows to read when they were soft-deleted, with WithIncludeDeleted.
+type RowSoftDeleteHeader struct {
+	DeletedAt *time.Time `dynamodbav:",omitempty"`
+}
+
+// WithIncludeDeleted includes soft-deleted rows in the results of GetWithOptions and Query.
+func WithIncludeDeleted() Option {
+	return func(options *options) error {
+		options.includeDeleted = true
+		return nil
+	}
+}
+
+// WithHardDelete removes the row with DeleteItem even if the Client soft deletes.
+func WithHardDelete() Option {
+	return func(options *options) error {
+		options.hardDelete = true
+		return nil
+	}
+}
+
+func (c *Client) excludeDeleted(o *options) bool {
+	return c.SoftDelete != nil && !o.includeDeleted
+}
+
+func isDeleted(item map[string]types.AttributeValue) bool {
+	_, ok := item[deletedAtColumn]
+	return ok
+}
+
+func notDeletedFilter() expression.ConditionBuilder {
+	return expression.AttributeNotExists(expression.Name(deletedAtColumn))
+}
+
+func (s *SoftDelete) archived(sk string) string {
+	return s.ArchivePrefix + sk
+}
+
+func deletedAtValue(now time.Time) (types.AttributeValue, error) {
+	return attributevalue.Marshal(now.UTC())
+}
+
+// softDelete sets DeletedAt on a row, moving it under the archive prefix if one is configured. Deleting a row
+// that does not exist or is already deleted does nothing, like DeleteItem.
+func (c *Client) softDelete(ctx context.Context, pk, sk string, deleteOptions *options) error {
+	deletedAt, err := deletedAtValue(time.Now())
+	if err != nil {
+		return fmt.Errorf("Delete: %w", err)
+	}
+
+	cond := expression.Name(deletedAtColumn).AttributeNotExists().And(expression.Name(defaultPK).AttributeExists())
+	if deleteOptions.conditionsCount > 0 {
+		cond = deleteOptions.conditions.And(cond)
+	}
+
+	if c.SoftDelete.ArchivePrefix == "" {
+		expr, err := expression.NewBuilder().
+			WithCondition(cond).
+			WithUpdate(expression.Set(expression.Name(deletedAtColumn), expression.Value(deletedAt))).
+			Build()
+		if err != nil {
+			return fmt.Errorf("Delete: expression builder: %w", err)
+		}
+		if _, err := deleteOptions.scopeExpression(expr, expr.Condition()); err != nil {
+			return fmt.Errorf("Delete: %w", err)
+		}
+
+		_, err = c.Ddb.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 &c.Table,
+			Key:                       itemKey(pk, sk),
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			UpdateExpression:          expr.Update(),
+		}, c.rateLimit(ctx)...)
+		if err != nil {
+			var condFailedErr *types.ConditionalCheckFailedException
+			if errors.As(err, &condFailedErr) && deleteOptions.conditionsCount == 0 {
+				return nil
+			}
+			return fmt.Errorf("Delete: UpdateItem: %w", err)
+		}
+		return nil
+	}
+
+	item, err := c.getConsistent(ctx, pk, sk)
+	if err != nil {
+		return fmt.Errorf("Delete: %w", err)
+	}
+	if item == nil || isDeleted(item) {
+		return nil
+	}
+
+	// the row is deleted only as it was copied; its partition keys are scoped again with the condition
+	read := copyItem(item)
+	if err := deleteOptions.unscopeItem(read); err != nil {
+		return fmt.Errorf("Delete: %w", err)
+	}
+
+	expr, err := expression.NewBuilder().WithCondition(cond.And(UnchangedCondition(read))).Build()
+	if err != nil {
+		return fmt.Errorf("Delete: expression builder: %w", err)
+	}
+	if _, err := deleteOptions.scopeExpression(expr, expr.Condition()); err != nil {
+		return fmt.Errorf("Delete: %w", err)
+	}
+
+	_, err = c.Ddb.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: c.archivePut(item, sk, deletedAt)},
+			{Delete: &types.Delete{
+				TableName:                 &c.Table,
+				Key:                       itemKey(pk, sk),
+				ConditionExpression:       expr.Condition(),
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+			}},
+		},
+	}, c.rateLimit(ctx)...)
+	if err != nil {
+		if canceledErr, ok := IsTransactionCanceled(err); ok {
+			return fmt.Errorf("Delete: TransactWriteItems: %w", canceledErr)
+		}
+		return fmt.Errorf("Delete: TransactWriteItems: %w", err)
+	}
+
+	return nil
+}
+
+// archivePut copies item under the archive prefix with DeletedAt set and its index keys set aside. An older
+// archived copy is replaced.
+func (c *Client) archivePut(item map[string]types.AttributeValue, sk string, deletedAt types.AttributeValue) *types.Put {
+	archived := make(map[string]types.AttributeValue, len(item)+1)
+	indexKeys := map[string]types.AttributeValue{}
+	for k, v := range item {
+		if isIndexKey(k) {
+			indexKeys[k] = v
+			continue
+		}
+		archived[k] = v
+	}
+	archived[defaultSK] = &types.AttributeValueMemberS{Value: c.SoftDelete.archived(sk)}
+	archived[deletedAtColumn] = deletedAt
+	if len(indexKeys) > 0 {
+		archived[archivedIndexKeysColumn] = &types.AttributeValueMemberM{Value: indexKeys}
+	}
+
+	return &types.Put{TableName: &c.Table, Item: archived}
+}
+
+// isIndexKey reports whether name is a key attribute of one of the GSIs or LSIs.
+func isIndexKey(name string) bool {
+	for _, keys := range gsiKeys {
+		if keys.pk == name || keys.sk == name {
+			return true
+		}
+	}
+	for _, keys := range lsiKeys {
+		if keys.sk == name {
+			return true
+		}
+	}
+	return false
+}
+
+// makeSoftDeletes returns the transaction items that soft delete rows. Unlike a single Delete, every row must
+// exist and not already be deleted, otherwise the transaction is not written.
+func (c *Client) makeSoftDeletes(ctx context.Context, rows ...DeleteRow) ([]types.TransactWriteItem, error) {
+	deletedAt, err := deletedAtValue(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var out []types.TransactWriteItem
+	for _, row := range rows {
+		condition := notDeletedCondition
+		if row.Condition != nil {
+			condition = "(" + *row.Condition + ") AND " + notDeletedCondition
+		}
+
+		if c.SoftDelete.ArchivePrefix == "" {
+			update := "SET " + deletedAtColumn + " = :deletedAt"
+			out = append(out, types.TransactWriteItem{Update: &types.Update{
+				TableName:                 &c.Table,
+				Key:                       itemKey(row.PK, row.SK),
+				UpdateExpression:          &update,
+				ConditionExpression:       &condition,
+				ExpressionAttributeValues: map[string]types.AttributeValue{":deletedAt": deletedAt},
+			}})
+			continue
+		}
+
+		item, err := c.getConsistent(ctx, row.PK, row.SK)
+		if err != nil {
+			return nil, err
+		}
+		if item == nil || isDeleted(item) {
+			return nil, fmt.Errorf("PK %s SK %s: %w", row.PK, row.SK, ErrNotFound)
+		}
+
+		unchanged, err := expression.NewBuilder().WithCondition(UnchangedCondition(item)).Build()
+		if err != nil {
+			return nil, fmt.Errorf("expression builder: %w", err)
+		}
+		condition = condition + " AND (" + *unchanged.Condition() + ")"
+
+		out = append(out,
+			types.TransactWriteItem{Put: c.archivePut(item, row.SK, deletedAt)},
+			types.TransactWriteItem{Delete: &types.Delete{
+				TableName:                 &c.Table,
+				Key:                       itemKey(row.PK, row.SK),
+				ConditionExpression:       &condition,
+				ExpressionAttributeNames:  unchanged.Names(),
+				ExpressionAttributeValues: unchanged.Values(),
+			}},
+		)
+	}
+
+	return out, nil
+}
+
+// Restore undoes a soft delete of the row with the original pk and sk. It returns ErrNotFound if the row is
+// not soft-deleted, and ErrAlreadyExists if an archived row cannot be restored because its SK was reused.
+func (c *Client) Restore(ctx context.Context, pk, sk string) error {
+	if c.SoftDelete == nil {
+		return &InvalidArgumentError{err: errors.New("Restore: client does not soft delete")}
+	}
+
+	if c.SoftDelete.ArchivePrefix == "" {
+		condition := "attribute_exists(" + deletedAtColumn + ")"
+		update := "REMOVE " + deletedAtColumn
+		_, err := c.Ddb.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:           &c.Table,
+			Key:                 itemKey(pk, sk),
+			ConditionExpression: &condition,
+			UpdateExpression:    &update,
+		}, c.rateLimit(ctx)...)
+		if err != nil {
+			var condFailedErr *types.ConditionalCheckFailedException
+			if errors.As(err, &condFailedErr) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("Restore: UpdateItem: %w", err)
+		}
+		return nil
+	}
+
+	archivedSK := c.SoftDelete.archived(sk)
+
+	item, err := c.getConsistent(ctx, pk, archivedSK)
+	if err != nil {
+		return fmt.Errorf("Restore: %w", err)
+	}
+	if item == nil {
+		return ErrNotFound
+	}
+
+	delete(item, deletedAtColumn)
+	item[defaultSK] = &types.AttributeValueMemberS{Value: sk}
+	if indexKeys, ok := item[archivedIndexKeysColumn].(*types.AttributeValueMemberM); ok {
+		for k, v := range indexKeys.Value {
+			item[k] = v
+		}
+	}
+	delete(item, archivedIndexKeysColumn)
+
+	notExists := "attribute_not_exists(PK)"
+	exists := "attribute_exists(" + deletedAtColumn + ")"
+	_, err = c.Ddb.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{TableName: &c.Table, Item: item, ConditionExpression: &notExists}},
+			{Delete: &types.Delete{TableName: &c.Table, Key: itemKey(pk, archivedSK), ConditionExpression: &exists}},
+		},
+	}, c.rateLimit(ctx)...)
+	if err != nil {
+		var canceledErr *types.TransactionCanceledException
+		if errors.As(err, &canceledErr) && len(canceledErr.CancellationReasons) > 0 &&
+			canceledErr.CancellationReasons[0].Code != nil && *canceledErr.CancellationReasons[0].Code == "ConditionalCheckFailed" {
+			return ErrAlreadyExists
+		}
+		return fmt.Errorf("Restore: TransactWriteItems: %w", err)
+	}
+
+	return nil
+}
+
+// getConsistent returns an item with a strongly consistent read, or nil if it does not exist.
+func (c *Client) getConsistent(ctx context.Context, pk, sk string) (map[string]types.AttributeValue, error) {
+	consistent := true
+	resp, err := c.Ddb.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      &c.Table,
+		Key:            itemKey(pk, sk),
+		ConsistentRead: &consistent,
+	}, c.rateLimit(ctx)...)
+	if err != nil {
+		return nil, fmt.Errorf("GetItem: %w", err)
+	}
+	if len(resp.Item) == 0 {
+		return nil, nil
+	}
+	return resp.Item, nil
+}
+
+func itemKey(pk, sk string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		defaultPK: &types.AttributeValueMemberS{Value: pk},
+		defaultSK: &types.AttributeValueMemberS{Value: sk},
+	}
+}
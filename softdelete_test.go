@@ -0,0 +1,275 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+type softDeleteRow struct {
+	RowHeader
+	RowSoftDeleteHeader
+	Name string
+}
+
+func withSoftDelete(softDelete *SoftDelete) func(*Client) {
+	return func(c *Client) {
+		c.SoftDelete = softDelete
+	}
+}
+
+func putSoftDeleteRows(t *testing.T, client *Client, sks ...string) {
+	t.Helper()
+	for _, sk := range sks {
+		row := softDeleteRow{RowHeader: RowHeader{PK: "USER#1", SK: sk, RowType: "NOTE"}, Name: sk}
+		if err := client.Put(context.Background(), row); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newTestClient(t, TableSpec{}, withSoftDelete(&SoftDelete{}))
+	ctx := context.Background()
+	putSoftDeleteRows(t, client, "NOTE#1", "NOTE#2")
+
+	if err := client.Delete(ctx, "USER#1", "NOTE#1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// deleting again, or deleting a missing row, does nothing like DeleteItem
+	if err := client.Delete(ctx, "USER#1", "NOTE#1"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := client.Delete(ctx, "USER#1", "NOTE#9"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	var got softDeleteRow
+	if err := client.Get(ctx, "USER#1", "NOTE#1", &got); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got: %v", err)
+	}
+	if err := client.GetWithOptions(ctx, "USER#1", "NOTE#1", &got, WithIncludeDeleted()); err != nil || got.DeletedAt == nil {
+		t.Errorf("expected a soft-deleted row, got: %+v, %v", got, err)
+	}
+
+	var rows []softDeleteRow
+	if err := client.Query(ctx, KeyPkOnly("USER#1"), &rows); err != nil || len(rows) != 1 {
+		t.Errorf("expected 1 row, got: %+v, %v", rows, err)
+	}
+
+	if err := client.Restore(ctx, "USER#1", "NOTE#1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.Restore(ctx, "USER#1", "NOTE#1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got: %v", err)
+	}
+	got = softDeleteRow{}
+	if err := client.Get(ctx, "USER#1", "NOTE#1", &got); err != nil || got.DeletedAt != nil {
+		t.Errorf("expected a restored row, got: %+v, %v", got, err)
+	}
+
+	if err := client.Delete(ctx, "USER#1", "NOTE#1", WithHardDelete()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.GetWithOptions(ctx, "USER#1", "NOTE#1", &got, WithIncludeDeleted()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after a hard delete, got: %v", err)
+	}
+}
+
+func TestSoftDeleteArchive(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newTestClient(t, TableSpec{}, withSoftDelete(&SoftDelete{ArchivePrefix: "ARCHIVED#"}))
+	ctx := context.Background()
+	putSoftDeleteRows(t, client, "NOTE#1", "NOTE#2", "NOTE#3")
+
+	if err := client.Delete(ctx, "USER#1", "NOTE#1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got softDeleteRow
+	if err := client.GetWithOptions(ctx, "USER#1", "NOTE#1", &got, WithIncludeDeleted()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the row to be moved, got: %v", err)
+	}
+	if err := client.GetWithOptions(ctx, "USER#1", "ARCHIVED#NOTE#1", &got, WithIncludeDeleted()); err != nil || got.Name != "NOTE#1" {
+		t.Errorf("expected the archived row, got: %+v, %v", got, err)
+	}
+
+	if err := client.Restore(ctx, "USER#1", "NOTE#1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got = softDeleteRow{}
+	if err := client.Get(ctx, "USER#1", "NOTE#1", &got); err != nil || got.DeletedAt != nil {
+		t.Errorf("expected a restored row, got: %+v, %v", got, err)
+	}
+	if err := client.GetWithOptions(ctx, "USER#1", "ARCHIVED#NOTE#1", &got, WithIncludeDeleted()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the archived row to be removed, got: %v", err)
+	}
+
+	t.Run("TransactDeletes", func(t *testing.T) {
+		// a missing row fails the whole transaction
+		err := client.TransactDeletes(ctx, "token-1",
+			DeleteRow{PK: "USER#1", SK: "NOTE#2"},
+			DeleteRow{PK: "USER#1", SK: "NOTE#9"},
+		)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got: %v", err)
+		}
+
+		err = client.TransactDeletes(ctx, "token-2",
+			DeleteRow{PK: "USER#1", SK: "NOTE#2"},
+			DeleteRow{PK: "USER#1", SK: "NOTE#3"},
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var rows []softDeleteRow
+		if err := client.Query(ctx, KeySkBeginsWith("USER#1", "ARCHIVED#"), &rows, WithIncludeDeleted()); err != nil || len(rows) != 2 {
+			t.Errorf("expected 2 archived rows, got: %+v, %v", rows, err)
+		}
+
+		rows = nil
+		if err := client.Query(ctx, KeyPkOnly("USER#1"), &rows); err != nil || len(rows) != 1 || rows[0].SK != "NOTE#1" {
+			t.Errorf("expected only NOTE#1, got: %+v, %v", rows, err)
+		}
+	})
+}
+
+type softDeleteIndexRow struct {
+	RowHeader
+	RowGSI1Header
+	RowSoftDeleteHeader
+	Name string
+}
+
+func TestSoftDeleteArchiveIndexKeys(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newTestClient(t, TableSpec{GSIs: []int{1}}, withSoftDelete(&SoftDelete{ArchivePrefix: "ARCHIVED#"}))
+	ctx := context.Background()
+
+	row := softDeleteIndexRow{
+		RowHeader:     RowHeader{PK: "USER#1", SK: "NOTE#1", RowType: "NOTE"},
+		RowGSI1Header: RowGSI1Header{GSI1PK: "NOTES", GSI1SK: "NOTE#1"},
+		Name:          "note",
+	}
+	if err := client.Put(ctx, row); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.Delete(ctx, "USER#1", "NOTE#1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the archived copy is not in the GSI
+	var rows []softDeleteIndexRow
+	err := client.Query(ctx, KeyPkOnly("NOTES"), &rows, WithIndexGSI1(), WithIncludeDeleted())
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got: %+v, %v", rows, err)
+	}
+
+	// Restore puts the index keys back
+	if err := client.Restore(ctx, "USER#1", "NOTE#1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rows = nil
+	if err := client.Query(ctx, KeyPkOnly("NOTES"), &rows, WithIndexGSI1()); err != nil || len(rows) != 1 || rows[0].GSI1SK != "NOTE#1" {
+		t.Errorf("expected the restored row, got: %+v, %v", rows, err)
+	}
+}
+
+func TestSoftDeleteArchiveSigned(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newTestClient(t, TableSpec{GSIs: []int{1}}, func(c *Client) {
+		withEncryption(true)(c)
+		withSoftDelete(&SoftDelete{ArchivePrefix: "ARCHIVED#"})(c)
+	})
+	ctx := context.Background()
+
+	row := softDeleteIndexRow{
+		RowHeader:     RowHeader{PK: "USER#1", SK: "NOTE#1", RowType: "NOTE"},
+		RowGSI1Header: RowGSI1Header{GSI1PK: "NOTES", GSI1SK: "NOTE#1"},
+		Name:          "note",
+	}
+	if err := client.Put(ctx, row); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.Delete(ctx, "USER#1", "NOTE#1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the signature still verifies with the index keys set aside
+	var got softDeleteIndexRow
+	if err := client.GetWithOptions(ctx, "USER#1", "ARCHIVED#NOTE#1", &got, WithIncludeDeleted()); err != nil || got.Name != "note" {
+		t.Errorf("expected the archived row, got: %+v, %v", got, err)
+	}
+	var rows []softDeleteIndexRow
+	if err := client.Query(ctx, KeySkBeginsWith("USER#1", "ARCHIVED#"), &rows, WithIncludeDeleted()); err != nil || len(rows) != 1 {
+		t.Errorf("expected 1 archived row, got: %+v, %v", rows, err)
+	}
+
+	if err := client.Restore(ctx, "USER#1", "NOTE#1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got = softDeleteIndexRow{}
+	if err := client.Get(ctx, "USER#1", "NOTE#1", &got); err != nil || got.GSI1SK != "NOTE#1" {
+		t.Errorf("expected the restored row, got: %+v, %v", got, err)
+	}
+}
+
+func TestSoftDeleteArchiveConcurrentChange(t *testing.T) {
+	t.Parallel()
+
+	client, server := newTestClient(t, TableSpec{}, withSoftDelete(&SoftDelete{ArchivePrefix: "ARCHIVED#"}))
+	ctx := context.Background()
+
+	plain := client.Ddb
+	changed := false
+	// changes the row after it is read and before it is archived
+	changeBeforeArchive := middleware.InitializeMiddlewareFunc("changeBeforeArchive", func(
+		ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+	) (middleware.InitializeOutput, middleware.Metadata, error) {
+		if awsmiddleware.GetOperationName(ctx) == "TransactWriteItems" && !changed {
+			changed = true
+			update := "SET #name = :name"
+			_, err := plain.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName:                 &client.Table,
+				Key:                       itemKey("USER#1", "NOTE#1"),
+				UpdateExpression:          &update,
+				ExpressionAttributeNames:  map[string]string{"#name": "Name"},
+				ExpressionAttributeValues: map[string]types.AttributeValue{":name": &types.AttributeValueMemberS{Value: "changed"}},
+			})
+			if err != nil {
+				return middleware.InitializeOutput{}, middleware.Metadata{}, err
+			}
+		}
+		return next.HandleInitialize(ctx, in)
+	})
+	client.Ddb = server.DynamoDB(func(o *dynamodb.Options) {
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Initialize.Add(changeBeforeArchive, middleware.After)
+		})
+	})
+	putSoftDeleteRows(t, client, "NOTE#1")
+
+	if err := client.Delete(ctx, "USER#1", "NOTE#1"); err == nil {
+		t.Errorf("expected an error for a row changed after it was read")
+	}
+
+	var got softDeleteRow
+	if err := client.Get(ctx, "USER#1", "NOTE#1", &got); err != nil || got.Name != "changed" {
+		t.Errorf("expected the changed row to be kept, got: %+v, %v", got, err)
+	}
+	if err := client.GetWithOptions(ctx, "USER#1", "ARCHIVED#NOTE#1", &got, WithIncludeDeleted()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected no archived row, got: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/danielwchapman/ddb"
+	"github.com/danielwchapman/ddb/keys"
+)
+
+// Checkpoint is the position of a Reader in a shard. SequenceNumber is the last record handled, and is
+// empty if none has been. Finished is set once the shard has been read to its end.
+type Checkpoint struct {
+	ShardID        string
+	SequenceNumber string
+	Finished       bool
+}
+
+// CheckpointStore persists Reader checkpoints per stream and shard.
+type CheckpointStore interface {
+	// Get returns the checkpoint of a shard, or found false if there is none.
+	Get(ctx context.Context, streamArn, shardID string) (checkpoint Checkpoint, found bool, err error)
+	Put(ctx context.Context, streamArn string, checkpoint Checkpoint) error
+}
+
+// ErrStaleCheckpoint is returned by TableCheckpoints.Put when the stored checkpoint is ahead of the one being
+// written, or is written by someone else at the same time, which means another Reader is consuming the shard.
+var ErrStaleCheckpoint = errors.New("checkpoint is behind the stored checkpoint")
+
+// MemoryCheckpoints is a CheckpointStore that keeps checkpoints in memory, for tests and for readers that
+// start from Latest on every run.
+type MemoryCheckpoints struct {
+	mu          sync.Mutex
+	checkpoints map[string]Checkpoint
+}
+
+func (m *MemoryCheckpoints) Get(ctx context.Context, streamArn, shardID string) (Checkpoint, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	checkpoint, ok := m.checkpoints[streamArn+"\n"+shardID]
+	return checkpoint, ok, nil
+}
+
+func (m *MemoryCheckpoints) Put(ctx context.Context, streamArn string, checkpoint Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.checkpoints == nil {
+		m.checkpoints = map[string]Checkpoint{}
+	}
+	m.checkpoints[streamArn+"\n"+checkpoint.ShardID] = checkpoint
+	return nil
+}
+
+// CheckpointRowType is the RowType of the rows written by TableCheckpoints.
+const CheckpointRowType = "STREAM_CHECKPOINT"
+
+// TableCheckpoints is a CheckpointStore that keeps one row per shard in the Client's table, under the
+// partition key CHECKPOINT#<Consumer>#<stream ARN>. Put reads the stored checkpoint and writes only if it is not
+// ahead of the new one and has not changed since, so a checkpoint never moves backwards.
+type TableCheckpoints struct {
+	Client *ddb.Client
+
+	// Consumer names the reader, so several readers of one stream keep separate checkpoints.
+	Consumer string
+}
+
+type checkpointRow struct {
+	ddb.RowHeader
+	SequenceNumber sequenceNumber
+	Finished       bool
+	UpdatedAt      time.Time
+}
+
+func (c *TableCheckpoints) key(streamArn, shardID string) (pk, sk string) {
+	return keys.Build(keys.String("CHECKPOINT"), keys.String(c.Consumer), keys.String(streamArn)),
+		keys.Build(keys.String("SHARD"), keys.String(shardID))
+}
+
+func (c *TableCheckpoints) Get(ctx context.Context, streamArn, shardID string) (Checkpoint, bool, error) {
+	pk, sk := c.key(streamArn, shardID)
+
+	var row checkpointRow
+	if err := c.Client.Get(ctx, pk, sk, &row); err != nil {
+		if errors.Is(err, ddb.ErrNotFound) {
+			return Checkpoint{}, false, nil
+		}
+		return Checkpoint{}, false, fmt.Errorf("TableCheckpoints.Get: %w", err)
+	}
+
+	return Checkpoint{
+		ShardID:        shardID,
+		SequenceNumber: string(row.SequenceNumber),
+		Finished:       row.Finished,
+	}, true, nil
+}
+
+func (c *TableCheckpoints) Put(ctx context.Context, streamArn string, checkpoint Checkpoint) error {
+	pk, sk := c.key(streamArn, checkpoint.ShardID)
+
+	// Sequence numbers can be longer than DynamoDB numbers, so they are stored as strings and compared here.
+	var stored checkpointRow
+	cond := expression.AttributeNotExists(expression.Name("PK"))
+	err := c.Client.GetWithOptions(ctx, pk, sk, &stored, ddb.WithConsistentRead())
+	switch {
+	case err == nil:
+		if compareSequenceNumbers(string(stored.SequenceNumber), checkpoint.SequenceNumber) > 0 {
+			return fmt.Errorf("TableCheckpoints.Put: shard %s: %w", checkpoint.ShardID, ErrStaleCheckpoint)
+		}
+		cond = expression.Name("UpdatedAt").Equal(expression.Value(stored.UpdatedAt))
+	case !errors.Is(err, ddb.ErrNotFound):
+		return fmt.Errorf("TableCheckpoints.Put: %w", err)
+	}
+
+	row := checkpointRow{
+		RowHeader:      ddb.RowHeader{PK: pk, SK: sk, RowType: CheckpointRowType},
+		SequenceNumber: sequenceNumber(checkpoint.SequenceNumber),
+		Finished:       checkpoint.Finished,
+		UpdatedAt:      time.Now().UTC(),
+	}
+
+	if err := c.Client.Put(ctx, row, ddb.WithCondition(cond)); err != nil {
+		var condFailedErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condFailedErr) {
+			return fmt.Errorf("TableCheckpoints.Put: shard %s: %w", checkpoint.ShardID, ErrStaleCheckpoint)
+		}
+		return fmt.Errorf("TableCheckpoints.Put: %w", err)
+	}
+
+	return nil
+}
+
+// sequenceNumber is stored as a string, because sequence numbers can have more digits than a DynamoDB number.
+type sequenceNumber string
+
+func (s sequenceNumber) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	return &types.AttributeValueMemberS{Value: string(s)}, nil
+}
+
+func (s *sequenceNumber) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
+	v, ok := av.(*types.AttributeValueMemberS)
+	if !ok {
+		return fmt.Errorf("sequence number must be a string, got %T", av)
+	}
+	*s = sequenceNumber(v.Value)
+	return nil
+}
@@ -0,0 +1,336 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamstypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// StreamsAPI is the subset of the dynamodbstreams client used by Reader.
+type StreamsAPI interface {
+	DescribeStream(ctx context.Context, params *dynamodbstreams.DescribeStreamInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error)
+	GetShardIterator(ctx context.Context, params *dynamodbstreams.GetShardIteratorInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error)
+	GetRecords(ctx context.Context, params *dynamodbstreams.GetRecordsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error)
+}
+
+// Position is where a Reader starts reading a shard it has no checkpoint for.
+type Position int
+
+const (
+	// TrimHorizon starts at the oldest record still in the stream.
+	TrimHorizon Position = iota
+	// Latest starts after the newest record, so only changes made after the Reader starts are read.
+	Latest
+	// AtSequenceNumber starts at Reader.SequenceNumber. Shards that end before it are skipped and shards
+	// that start after it are read from their beginning.
+	AtSequenceNumber
+)
+
+// DefaultPollInterval is used when Reader.PollInterval is zero. DynamoDB Streams allows at most 5 GetRecords
+// calls per second per shard.
+const DefaultPollInterval = time.Second
+
+// Reader tails a DynamoDB stream. It discovers shards as the stream splits them, reads a child shard only
+// after its parent has been read to the end, and checkpoints each shard after every batch it handles.
+// Delivery is at least once: a batch whose handler fails is retried from the last checkpoint.
+type Reader struct {
+	Streams     StreamsAPI
+	StreamArn   string
+	Checkpoints CheckpointStore
+
+	// Handler receives the records of each batch in stream order. Router.Route can be used directly; when it
+	// returns a *RecordError, the records before the failed one are checkpointed.
+	Handler func(ctx context.Context, records []Record) error
+
+	// Start and SequenceNumber select where shards without a checkpoint are read from. Child shards of a
+	// shard the Reader has read are always read from their beginning.
+	Start          Position
+	SequenceNumber string
+
+	// PollInterval is how long the Reader waits after it has caught up on every open shard.
+	PollInterval time.Duration
+
+	// Limit is the maximum number of records per GetRecords call. Zero uses the service default.
+	Limit int32
+
+	iterators map[string]string
+	finished  map[string]bool
+}
+
+// Run reads the stream until ctx is done or a handler fails. It returns ctx.Err() when ctx is done.
+func (r *Reader) Run(ctx context.Context) error {
+	if r.Streams == nil || r.Checkpoints == nil || r.Handler == nil {
+		return errors.New("Run: Streams, Checkpoints and Handler are required")
+	}
+
+	interval := r.PollInterval
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if err := r.Poll(ctx); err != nil {
+			return fmt.Errorf("Run: %w", err)
+		}
+
+		timer.Reset(interval)
+	}
+}
+
+// Poll makes a single pass over the stream: it reads every readable shard until it has caught up or reached
+// the end of the shard. Shards whose parents are finished during the pass are read in the same pass.
+func (r *Reader) Poll(ctx context.Context) error {
+	if r.iterators == nil {
+		r.iterators = map[string]string{}
+		r.finished = map[string]bool{}
+	}
+
+	shards, err := r.describeShards(ctx)
+	if err != nil {
+		return fmt.Errorf("Poll: %w", err)
+	}
+
+	known := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		known[aws.ToString(shard.ShardId)] = true
+	}
+
+	read := map[string]bool{}
+	for progressed := true; progressed; {
+		progressed = false
+
+		for _, shard := range shards {
+			shardID := aws.ToString(shard.ShardId)
+			if r.finished[shardID] || read[shardID] {
+				continue
+			}
+
+			checkpoint, found, err := r.Checkpoints.Get(ctx, r.StreamArn, shardID)
+			if err != nil {
+				return fmt.Errorf("Poll: Checkpoints.Get: %w", err)
+			}
+			if found && checkpoint.Finished {
+				r.finished[shardID] = true
+				progressed = true
+				continue
+			}
+
+			// a parent that is no longer in the stream has been trimmed, so its child is readable
+			parentID := aws.ToString(shard.ParentShardId)
+			if parentID != "" && known[parentID] && !r.finished[parentID] {
+				continue
+			}
+
+			read[shardID] = true
+			if err := r.readShard(ctx, shard, checkpoint, found, known[parentID]); err != nil {
+				return fmt.Errorf("Poll: shard %s: %w", shardID, err)
+			}
+			if r.finished[shardID] {
+				progressed = true
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *Reader) describeShards(ctx context.Context) ([]streamstypes.Shard, error) {
+	var (
+		shards  []streamstypes.Shard
+		startID *string
+	)
+	for {
+		out, err := r.Streams.DescribeStream(ctx, &dynamodbstreams.DescribeStreamInput{
+			StreamArn:             &r.StreamArn,
+			ExclusiveStartShardId: startID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("DescribeStream: %w", err)
+		}
+		if out.StreamDescription == nil {
+			return shards, nil
+		}
+
+		shards = append(shards, out.StreamDescription.Shards...)
+
+		startID = out.StreamDescription.LastEvaluatedShardId
+		if startID == nil {
+			return shards, nil
+		}
+	}
+}
+
+// readShard reads a shard until it has caught up or reached its end, which is checkpointed as finished.
+func (r *Reader) readShard(ctx context.Context, shard streamstypes.Shard, checkpoint Checkpoint, hasCheckpoint, hasParent bool) error {
+	shardID := aws.ToString(shard.ShardId)
+
+	iterator, ok := r.iterators[shardID]
+	if !ok {
+		in, skip := r.iteratorInput(shard, checkpoint, hasCheckpoint, hasParent)
+		if skip {
+			return r.finish(ctx, shardID, checkpoint.SequenceNumber)
+		}
+
+		out, err := r.Streams.GetShardIterator(ctx, in)
+		if err != nil {
+			return fmt.Errorf("GetShardIterator: %w", err)
+		}
+		iterator = aws.ToString(out.ShardIterator)
+	}
+
+	for iterator != "" {
+		in := &dynamodbstreams.GetRecordsInput{ShardIterator: &iterator}
+		if r.Limit > 0 {
+			in.Limit = &r.Limit
+		}
+
+		out, err := r.Streams.GetRecords(ctx, in)
+		if err != nil {
+			var expiredErr *streamstypes.ExpiredIteratorException
+			if errors.As(err, &expiredErr) {
+				// the next poll gets a new iterator from the checkpoint
+				delete(r.iterators, shardID)
+				return nil
+			}
+			return fmt.Errorf("GetRecords: %w", err)
+		}
+
+		records, err := FromStreams(out.Records)
+		if err != nil {
+			return err
+		}
+
+		if len(records) > 0 {
+			if err := r.handle(ctx, shardID, records); err != nil {
+				delete(r.iterators, shardID)
+				return err
+			}
+			checkpoint.SequenceNumber = records[len(records)-1].SequenceNumber
+		}
+
+		next := aws.ToString(out.NextShardIterator)
+		if next == "" {
+			delete(r.iterators, shardID)
+			return r.finish(ctx, shardID, checkpoint.SequenceNumber)
+		}
+
+		r.iterators[shardID] = next
+		iterator = next
+
+		// an open shard with nothing new has caught up; it is read again on the next poll
+		if len(records) == 0 {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// iteratorInput returns the GetShardIterator request for a shard without an iterator, or skip if the shard
+// ends before the Reader's starting sequence number.
+func (r *Reader) iteratorInput(shard streamstypes.Shard, checkpoint Checkpoint, hasCheckpoint, hasParent bool) (in *dynamodbstreams.GetShardIteratorInput, skip bool) {
+	in = &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         &r.StreamArn,
+		ShardId:           shard.ShardId,
+		ShardIteratorType: streamstypes.ShardIteratorTypeTrimHorizon,
+	}
+
+	switch {
+	case hasCheckpoint && checkpoint.SequenceNumber != "":
+		in.ShardIteratorType = streamstypes.ShardIteratorTypeAfterSequenceNumber
+		in.SequenceNumber = aws.String(checkpoint.SequenceNumber)
+	case hasCheckpoint || hasParent:
+		// read from the beginning
+	case r.Start == Latest:
+		in.ShardIteratorType = streamstypes.ShardIteratorTypeLatest
+	case r.Start == AtSequenceNumber:
+		var start, end string
+		if shard.SequenceNumberRange != nil {
+			start = aws.ToString(shard.SequenceNumberRange.StartingSequenceNumber)
+			end = aws.ToString(shard.SequenceNumberRange.EndingSequenceNumber)
+		}
+		switch {
+		case end != "" && compareSequenceNumbers(end, r.SequenceNumber) < 0:
+			return nil, true
+		case start == "" || compareSequenceNumbers(start, r.SequenceNumber) <= 0:
+			in.ShardIteratorType = streamstypes.ShardIteratorTypeAtSequenceNumber
+			in.SequenceNumber = aws.String(r.SequenceNumber)
+		}
+	}
+
+	return in, false
+}
+
+// handle passes records to the Handler and checkpoints the last record handled.
+func (r *Reader) handle(ctx context.Context, shardID string, records []Record) error {
+	err := r.Handler(ctx, records)
+
+	var (
+		recordErr *RecordError
+		handled   = len(records)
+	)
+	if errors.As(err, &recordErr) {
+		for i, record := range records {
+			if record.SequenceNumber == recordErr.Record.SequenceNumber {
+				handled = i
+				break
+			}
+		}
+	} else if err != nil {
+		handled = 0
+	}
+
+	if handled > 0 {
+		if putErr := r.Checkpoints.Put(ctx, r.StreamArn, Checkpoint{
+			ShardID:        shardID,
+			SequenceNumber: records[handled-1].SequenceNumber,
+		}); putErr != nil {
+			return fmt.Errorf("Checkpoints.Put: %w", putErr)
+		}
+	}
+
+	return err
+}
+
+func (r *Reader) finish(ctx context.Context, shardID, sequenceNumber string) error {
+	if err := r.Checkpoints.Put(ctx, r.StreamArn, Checkpoint{
+		ShardID:        shardID,
+		SequenceNumber: sequenceNumber,
+		Finished:       true,
+	}); err != nil {
+		return fmt.Errorf("Checkpoints.Put: %w", err)
+	}
+	r.finished[shardID] = true
+	return nil
+}
+
+// compareSequenceNumbers compares stream sequence numbers, which are decimal strings of varying length.
+func compareSequenceNumbers(a, b string) int {
+	x, okA := new(big.Int).SetString(a, 10)
+	y, okB := new(big.Int).SetString(b, 10)
+	if !okA || !okB {
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	}
+	return x.Cmp(y)
+}
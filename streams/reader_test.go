@@ -0,0 +1,236 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamstypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/danielwchapman/ddb"
+	"github.com/danielwchapman/ddb/ddblocal"
+)
+
+// fakeShard is a shard of fakeStreams. Iterators are "<shard>:<offset>".
+type fakeShard struct {
+	id, parent string
+	sequences  []string
+	closed     bool
+}
+
+type fakeStreams struct {
+	shards []fakeShard
+}
+
+func (f *fakeStreams) shard(id string) fakeShard {
+	for _, shard := range f.shards {
+		if shard.id == id {
+			return shard
+		}
+	}
+	panic("unknown shard " + id)
+}
+
+func (f *fakeStreams) DescribeStream(ctx context.Context, in *dynamodbstreams.DescribeStreamInput, _ ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error) {
+	var shards []streamstypes.Shard
+	for _, shard := range f.shards {
+		out := streamstypes.Shard{ShardId: aws.String(shard.id), SequenceNumberRange: &streamstypes.SequenceNumberRange{
+			StartingSequenceNumber: aws.String(shard.sequences[0]),
+		}}
+		if shard.parent != "" {
+			out.ParentShardId = aws.String(shard.parent)
+		}
+		if shard.closed {
+			out.SequenceNumberRange.EndingSequenceNumber = aws.String(shard.sequences[len(shard.sequences)-1])
+		}
+		shards = append(shards, out)
+	}
+	return &dynamodbstreams.DescribeStreamOutput{StreamDescription: &streamstypes.StreamDescription{Shards: shards}}, nil
+}
+
+func (f *fakeStreams) GetShardIterator(ctx context.Context, in *dynamodbstreams.GetShardIteratorInput, _ ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	shard := f.shard(aws.ToString(in.ShardId))
+
+	offset := 0
+	switch in.ShardIteratorType {
+	case streamstypes.ShardIteratorTypeLatest:
+		offset = len(shard.sequences)
+	case streamstypes.ShardIteratorTypeAtSequenceNumber, streamstypes.ShardIteratorTypeAfterSequenceNumber:
+		for offset < len(shard.sequences) && compareSequenceNumbers(shard.sequences[offset], aws.ToString(in.SequenceNumber)) < 0 {
+			offset++
+		}
+		if in.ShardIteratorType == streamstypes.ShardIteratorTypeAfterSequenceNumber {
+			offset++
+		}
+	}
+
+	return &dynamodbstreams.GetShardIteratorOutput{ShardIterator: aws.String(fmt.Sprintf("%s:%d", shard.id, offset))}, nil
+}
+
+func (f *fakeStreams) GetRecords(ctx context.Context, in *dynamodbstreams.GetRecordsInput, _ ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error) {
+	id, offsetStr, _ := strings.Cut(aws.ToString(in.ShardIterator), ":")
+	offset, _ := strconv.Atoi(offsetStr)
+	shard := f.shard(id)
+
+	out := &dynamodbstreams.GetRecordsOutput{}
+	for _, seq := range shard.sequences[min(offset, len(shard.sequences)):] {
+		out.Records = append(out.Records, streamstypes.Record{
+			EventID:   aws.String(seq),
+			EventName: streamstypes.OperationTypeInsert,
+			Dynamodb:  &streamstypes.StreamRecord{SequenceNumber: aws.String(seq)},
+		})
+	}
+
+	if offset < len(shard.sequences) || !shard.closed {
+		out.NextShardIterator = aws.String(fmt.Sprintf("%s:%d", id, len(shard.sequences)))
+	}
+	return out, nil
+}
+
+func TestReaderFollowsLineage(t *testing.T) {
+	t.Parallel()
+
+	// the child is listed first but must not be read until its parent is finished
+	streams := &fakeStreams{shards: []fakeShard{
+		{id: "child", parent: "parent", sequences: []string{"300", "400"}},
+		{id: "parent", sequences: []string{"100", "200"}, closed: true},
+	}}
+
+	var got []string
+	fail := "400"
+
+	checkpoints := &MemoryCheckpoints{}
+	reader := &Reader{
+		Streams:     streams,
+		StreamArn:   "arn",
+		Checkpoints: checkpoints,
+		Handler: func(ctx context.Context, records []Record) error {
+			for _, record := range records {
+				if record.SequenceNumber == fail {
+					return &RecordError{Record: record, Err: errors.New("failed")}
+				}
+				got = append(got, record.SequenceNumber)
+			}
+			return nil
+		},
+	}
+
+	ctx := context.Background()
+
+	if err := reader.Poll(ctx); err == nil {
+		t.Fatalf("expected handler error")
+	}
+
+	// records before the failed one are checkpointed, so a new reader resumes at the failed record
+	fail = ""
+	reader = &Reader{Streams: streams, StreamArn: "arn", Checkpoints: checkpoints, Handler: reader.Handler}
+	if err := reader.Poll(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"100", "200", "300", "400"}, got); diff != "" {
+		t.Errorf("unexpected diff: %s", diff)
+	}
+
+	parent, _, _ := checkpoints.Get(ctx, "arn", "parent")
+	child, _, _ := checkpoints.Get(ctx, "arn", "child")
+	want := []Checkpoint{
+		{ShardID: "parent", SequenceNumber: "200", Finished: true},
+		{ShardID: "child", SequenceNumber: "400"},
+	}
+	if diff := cmp.Diff(want, []Checkpoint{parent, child}); diff != "" {
+		t.Errorf("unexpected diff: %s", diff)
+	}
+}
+
+func TestReaderAtSequenceNumber(t *testing.T) {
+	t.Parallel()
+
+	streams := &fakeStreams{shards: []fakeShard{
+		{id: "old", sequences: []string{"1", "2"}, closed: true},
+		{id: "current", parent: "old", sequences: []string{"3", "40", "500"}},
+	}}
+
+	var got []string
+	reader := &Reader{
+		Streams:        streams,
+		StreamArn:      "arn",
+		Checkpoints:    &MemoryCheckpoints{},
+		Start:          AtSequenceNumber,
+		SequenceNumber: "40",
+		Handler: func(ctx context.Context, records []Record) error {
+			for _, record := range records {
+				got = append(got, record.SequenceNumber)
+			}
+			return nil
+		},
+	}
+
+	if err := reader.Poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the parent ends before 40 and is skipped, so its child is read from its beginning
+	if diff := cmp.Diff([]string{"3", "40", "500"}, got); diff != "" {
+		t.Errorf("unexpected diff: %s", diff)
+	}
+}
+
+func TestTableCheckpoints(t *testing.T) {
+	t.Parallel()
+
+	server := ddblocal.NewServer()
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	client := &ddb.Client{Ddb: server.DynamoDB(), Table: "Checkpoints"}
+	if err := client.CreateTable(ctx, ddb.TableSpec{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	store := &TableCheckpoints{Client: client, Consumer: "indexer"}
+
+	if _, found, err := store.Get(ctx, "arn", "shard"); err != nil || found {
+		t.Fatalf("expected no checkpoint, got: %v, %v", found, err)
+	}
+
+	if err := store.Put(ctx, "arn", Checkpoint{ShardID: "shard", SequenceNumber: "900"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// sequence numbers are compared as numbers, not strings
+	if err := store.Put(ctx, "arn", Checkpoint{ShardID: "shard", SequenceNumber: "1000", Finished: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := store.Put(ctx, "arn", Checkpoint{ShardID: "shard", SequenceNumber: "950"}); !errors.Is(err, ErrStaleCheckpoint) {
+		t.Errorf("expected ErrStaleCheckpoint, got: %v", err)
+	}
+
+	got, found, err := store.Get(ctx, "arn", "shard")
+	if err != nil || !found {
+		t.Fatalf("expected checkpoint, got: %v, %v", found, err)
+	}
+	if diff := cmp.Diff(Checkpoint{ShardID: "shard", SequenceNumber: "1000", Finished: true}, got); diff != "" {
+		t.Errorf("unexpected diff: %s", diff)
+	}
+
+	// sequence numbers can have more digits than a DynamoDB number
+	long := "4000000000000000000000000000000000000001"
+	if err := store.Put(ctx, "arn", Checkpoint{ShardID: "long", SequenceNumber: long}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.Put(ctx, "arn", Checkpoint{ShardID: "long", SequenceNumber: "999"}); !errors.Is(err, ErrStaleCheckpoint) {
+		t.Errorf("expected ErrStaleCheckpoint, got: %v", err)
+	}
+	if got, _, err := store.Get(ctx, "arn", "long"); err != nil || got.SequenceNumber != long {
+		t.Errorf("unexpected checkpoint: %+v, %v", got, err)
+	}
+
+}
@@ -0,0 +1,103 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/danielwchapman/ddb"
+)
+
+// Handler processes a single stream record.
+type Handler func(ctx context.Context, record Record) error
+
+// Router dispatches stream records to handlers by RowType. Records are processed in order, and processing
+// stops at the first failure so that the failed record and everything after it can be retried.
+type Router struct {
+	handlers map[string]Handler
+
+	// Default handles records whose RowType has no handler, including records without images. If nil,
+	// those records are skipped.
+	Default Handler
+
+	// Client, if set, decodes the records of handlers registered with Handle. See Decoder.
+	Client *ddb.Client
+}
+
+func NewRouter() *Router {
+	return &Router{handlers: map[string]Handler{}}
+}
+
+// HandleRecord registers h for records of rowType. It returns the receiver so calls can be chained.
+func (r *Router) HandleRecord(rowType string, h Handler) *Router {
+	r.handlers[rowType] = h
+	return r
+}
+
+// Handle registers fn for records of rowType, decoding them into a Change[T].
+func Handle[T any](r *Router, rowType string, fn func(ctx context.Context, change Change[T]) error) {
+	r.HandleRecord(rowType, func(ctx context.Context, record Record) error {
+		change, err := Decoder[T]{Client: r.Client}.Decode(ctx, record)
+		if err != nil {
+			return err
+		}
+		return fn(ctx, change)
+	})
+}
+
+// RecordError is returned by Route for the first record that failed.
+type RecordError struct {
+	Record Record
+	Err    error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("record %s (sequence number %s): %s", e.Record.EventID, e.Record.SequenceNumber, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// Route dispatches records in order. It returns a *RecordError for the first record that fails.
+func (r *Router) Route(ctx context.Context, records []Record) error {
+	for _, record := range records {
+		h, ok := r.handlers[record.RowType()]
+		if !ok {
+			h = r.Default
+		}
+		if h == nil {
+			continue
+		}
+		if err := h(ctx, record); err != nil {
+			return &RecordError{Record: record, Err: err}
+		}
+	}
+	return nil
+}
+
+// HandleLambda is a Lambda handler for DynamoDB stream events with ReportBatchItemFailures enabled. A failed
+// record is reported by its sequence number, so Lambda retries the batch from that record. An event that
+// cannot be decoded fails the whole batch.
+func (r *Router) HandleLambda(ctx context.Context, event events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+	records, err := FromLambda(event)
+	if err != nil {
+		return events.DynamoDBEventResponse{}, fmt.Errorf("HandleLambda: %w", err)
+	}
+
+	var response events.DynamoDBEventResponse
+
+	if err := r.Route(ctx, records); err != nil {
+		var recordErr *RecordError
+		if !errors.As(err, &recordErr) {
+			return events.DynamoDBEventResponse{}, fmt.Errorf("HandleLambda: %w", err)
+		}
+		response.BatchItemFailures = append(response.BatchItemFailures, events.DynamoDBBatchItemFailure{
+			ItemIdentifier: recordErr.Record.SequenceNumber,
+		})
+	}
+
+	return response, nil
+}
@@ -0,0 +1,235 @@
+// Package streams decodes DynamoDB Streams records, from a Lambda event or from dynamodbstreams GetRecords,
+// into typed change events and routes them to handlers by RowType. Services that do not run on Lambda can tail
+// a stream with a Reader.
+package streams
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	streamstypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+
+	"github.com/danielwchapman/ddb"
+)
+
+// Kind is the type of modification a change event describes.
+type Kind int
+
+const (
+	Insert Kind = iota + 1
+	Modify
+	Remove
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Insert:
+		return "INSERT"
+	case Modify:
+		return "MODIFY"
+	case Remove:
+		return "REMOVE"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func parseKind(eventName string) (Kind, error) {
+	switch eventName {
+	case "INSERT":
+		return Insert, nil
+	case "MODIFY":
+		return Modify, nil
+	case "REMOVE":
+		return Remove, nil
+	default:
+		return 0, fmt.Errorf("unknown event name %q", eventName)
+	}
+}
+
+// Record is a stream record with its images converted to DynamoDB attribute values, independent of where it
+// was read from.
+type Record struct {
+	EventID        string
+	SequenceNumber string
+	Kind           Kind
+	CreatedAt      time.Time
+	Keys           map[string]types.AttributeValue
+	OldImage       map[string]types.AttributeValue
+	NewImage       map[string]types.AttributeValue
+
+	// ExpiredByTTL is true for REMOVE records created by DynamoDB Time to Live.
+	ExpiredByTTL bool
+}
+
+// RowType returns the RowType of the item the record describes, taken from the new image or, for removals,
+// the old image. It is empty if the stream does not include images.
+func (r Record) RowType() string {
+	image := r.NewImage
+	if r.Kind == Remove || image == nil {
+		image = r.OldImage
+	}
+	rowType, _ := ddb.RowTypeOf(image)
+	return rowType
+}
+
+// Change is a typed change event. Old is nil for inserts and New is nil for removals. Either may also be nil
+// if the stream view type does not include that image.
+type Change[T any] struct {
+	Kind           Kind
+	EventID        string
+	SequenceNumber string
+	CreatedAt      time.Time
+	Keys           map[string]types.AttributeValue
+	Old            *T
+	New            *T
+	ExpiredByTTL   bool
+}
+
+// Decode unmarshals the images of r into a Change[T] with attributevalue.UnmarshalMap. Unlike Client.Get, it
+// does not decrypt, decompress, verify or upcast rows; use a Decoder for tables written by a Client that does.
+func Decode[T any](r Record) (Change[T], error) {
+	return Decoder[T]{}.Decode(context.Background(), r)
+}
+
+// Decoder decodes records into a Change[T] with the Client that wrote them, so images are verified, decrypted,
+// decompressed and upcast like rows read with Client.Get. Deleted and expired rows are still decoded. If Client
+// is nil, images are unmarshaled as they are.
+type Decoder[T any] struct {
+	Client *ddb.Client
+}
+
+func (d Decoder[T]) Decode(ctx context.Context, r Record) (Change[T], error) {
+	change := Change[T]{
+		Kind:           r.Kind,
+		EventID:        r.EventID,
+		SequenceNumber: r.SequenceNumber,
+		CreatedAt:      r.CreatedAt,
+		Keys:           r.Keys,
+		ExpiredByTTL:   r.ExpiredByTTL,
+	}
+
+	if len(r.OldImage) > 0 {
+		change.Old = new(T)
+		if err := d.unmarshal(ctx, r.OldImage, change.Old); err != nil {
+			return Change[T]{}, fmt.Errorf("Decode: OldImage: %w", err)
+		}
+	}
+
+	if len(r.NewImage) > 0 {
+		change.New = new(T)
+		if err := d.unmarshal(ctx, r.NewImage, change.New); err != nil {
+			return Change[T]{}, fmt.Errorf("Decode: NewImage: %w", err)
+		}
+	}
+
+	return change, nil
+}
+
+func (d Decoder[T]) unmarshal(ctx context.Context, image map[string]types.AttributeValue, out *T) error {
+	if d.Client != nil {
+		return d.Client.UnmarshalItem(ctx, image, out)
+	}
+	if err := attributevalue.UnmarshalMap(image, out); err != nil {
+		return fmt.Errorf("UnmarshalMap: %w", err)
+	}
+	return nil
+}
+
+// FromLambda converts the records of a Lambda DynamoDB event.
+func FromLambda(event events.DynamoDBEvent) ([]Record, error) {
+	out := make([]Record, len(event.Records))
+	for i, rec := range event.Records {
+		kind, err := parseKind(rec.EventName)
+		if err != nil {
+			return nil, fmt.Errorf("FromLambda: %s: %w", rec.EventID, err)
+		}
+
+		out[i] = Record{
+			EventID:        rec.EventID,
+			SequenceNumber: rec.Change.SequenceNumber,
+			Kind:           kind,
+			CreatedAt:      rec.Change.ApproximateCreationDateTime.Time,
+			ExpiredByTTL:   isTTLIdentity(rec.UserIdentity),
+		}
+
+		if out[i].Keys, err = fromLambdaMap(rec.Change.Keys); err != nil {
+			return nil, fmt.Errorf("FromLambda: %s: Keys: %w", rec.EventID, err)
+		}
+		if out[i].OldImage, err = fromLambdaMap(rec.Change.OldImage); err != nil {
+			return nil, fmt.Errorf("FromLambda: %s: OldImage: %w", rec.EventID, err)
+		}
+		if out[i].NewImage, err = fromLambdaMap(rec.Change.NewImage); err != nil {
+			return nil, fmt.Errorf("FromLambda: %s: NewImage: %w", rec.EventID, err)
+		}
+	}
+	return out, nil
+}
+
+// FromStreams converts the records returned by dynamodbstreams GetRecords.
+func FromStreams(records []streamstypes.Record) ([]Record, error) {
+	out := make([]Record, len(records))
+	for i, rec := range records {
+		eventID := deref(rec.EventID)
+
+		kind, err := parseKind(string(rec.EventName))
+		if err != nil {
+			return nil, fmt.Errorf("FromStreams: %s: %w", eventID, err)
+		}
+
+		if rec.Dynamodb == nil {
+			return nil, fmt.Errorf("FromStreams: %s: record has no stream record", eventID)
+		}
+
+		out[i] = Record{
+			EventID:        eventID,
+			SequenceNumber: deref(rec.Dynamodb.SequenceNumber),
+			Kind:           kind,
+			ExpiredByTTL: rec.UserIdentity != nil &&
+				deref(rec.UserIdentity.Type) == ttlIdentityType &&
+				deref(rec.UserIdentity.PrincipalId) == ttlPrincipal,
+		}
+
+		if rec.Dynamodb.ApproximateCreationDateTime != nil {
+			out[i].CreatedAt = *rec.Dynamodb.ApproximateCreationDateTime
+		}
+
+		if out[i].Keys, err = fromStreamsMap(rec.Dynamodb.Keys); err != nil {
+			return nil, fmt.Errorf("FromStreams: %s: Keys: %w", eventID, err)
+		}
+		if out[i].OldImage, err = fromStreamsMap(rec.Dynamodb.OldImage); err != nil {
+			return nil, fmt.Errorf("FromStreams: %s: OldImage: %w", eventID, err)
+		}
+		if out[i].NewImage, err = fromStreamsMap(rec.Dynamodb.NewImage); err != nil {
+			return nil, fmt.Errorf("FromStreams: %s: NewImage: %w", eventID, err)
+		}
+	}
+	return out, nil
+}
+
+const (
+	ttlIdentityType = "Service"
+	ttlPrincipal    = "dynamodb.amazonaws.com"
+)
+
+func isTTLIdentity(identity *events.DynamoDBUserIdentity) bool {
+	return identity != nil && identity.Type == ttlIdentityType && identity.PrincipalID == ttlPrincipal
+}
+
+func fromStreamsMap(m map[string]streamstypes.AttributeValue) (map[string]types.AttributeValue, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	return attributevalue.FromDynamoDBStreamsMap(m)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
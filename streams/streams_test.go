@@ -0,0 +1,195 @@
+package streams
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	streamstypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/danielwchapman/ddb"
+	"github.com/danielwchapman/ddb/ddblocal"
+)
+
+type testOrder struct {
+	ddb.RowHeader
+	Total int
+}
+
+func lambdaImage(sk string, total string) map[string]events.DynamoDBAttributeValue {
+	return map[string]events.DynamoDBAttributeValue{
+		"PK":      events.NewStringAttribute("USER#1"),
+		"SK":      events.NewStringAttribute(sk),
+		"RowType": events.NewStringAttribute("ORDER"),
+		"Total":   events.NewNumberAttribute(total),
+	}
+}
+
+func TestRouterHandleLambda(t *testing.T) {
+	t.Parallel()
+
+	event := events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{
+		{
+			EventID:   "1",
+			EventName: "INSERT",
+			Change:    events.DynamoDBStreamRecord{SequenceNumber: "100", NewImage: lambdaImage("ORDER#1", "10")},
+		},
+		{
+			EventID:   "2",
+			EventName: "MODIFY",
+			Change: events.DynamoDBStreamRecord{
+				SequenceNumber: "200",
+				OldImage:       lambdaImage("ORDER#1", "10"),
+				NewImage:       lambdaImage("ORDER#1", "-1"),
+			},
+		},
+		{
+			EventID:   "3",
+			EventName: "REMOVE",
+			Change:    events.DynamoDBStreamRecord{SequenceNumber: "300", OldImage: lambdaImage("ORDER#1", "10")},
+		},
+	}}
+
+	var got []Change[testOrder]
+
+	router := NewRouter()
+	Handle(router, "ORDER", func(ctx context.Context, change Change[testOrder]) error {
+		if change.New != nil && change.New.Total < 0 {
+			return errors.New("negative total")
+		}
+		got = append(got, change)
+		return nil
+	})
+
+	resp, err := router.HandleLambda(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// processing stops at the failed record, which is reported so Lambda retries from it
+	want := []events.DynamoDBBatchItemFailure{{ItemIdentifier: "200"}}
+	if diff := cmp.Diff(want, resp.BatchItemFailures); diff != "" {
+		t.Errorf("unexpected diff: %s", diff)
+	}
+
+	if len(got) != 1 || got[0].Kind != Insert || got[0].Old != nil || got[0].New.Total != 10 {
+		t.Errorf("unexpected changes: %+v", got)
+	}
+}
+
+func TestFromStreams(t *testing.T) {
+	t.Parallel()
+
+	records, err := FromStreams([]streamstypes.Record{{
+		EventID:   aws.String("1"),
+		EventName: streamstypes.OperationTypeRemove,
+		Dynamodb: &streamstypes.StreamRecord{
+			SequenceNumber: aws.String("100"),
+			OldImage: map[string]streamstypes.AttributeValue{
+				"PK":      &streamstypes.AttributeValueMemberS{Value: "USER#1"},
+				"SK":      &streamstypes.AttributeValueMemberS{Value: "ORDER#1"},
+				"RowType": &streamstypes.AttributeValueMemberS{Value: "ORDER"},
+				"Total":   &streamstypes.AttributeValueMemberN{Value: "10"},
+			},
+		},
+		UserIdentity: &streamstypes.Identity{
+			Type:        aws.String("Service"),
+			PrincipalId: aws.String("dynamodb.amazonaws.com"),
+		},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := records[0].RowType(); got != "ORDER" {
+		t.Errorf("unexpected RowType: %q", got)
+	}
+
+	change, err := Decode[testOrder](records[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := Change[testOrder]{
+		Kind:           Remove,
+		EventID:        "1",
+		SequenceNumber: "100",
+		Old: &testOrder{
+			RowHeader: ddb.RowHeader{PK: "USER#1", SK: "ORDER#1", RowType: "ORDER"},
+			Total:     10,
+		},
+		ExpiredByTTL: true,
+	}
+	if diff := cmp.Diff(want, change); diff != "" {
+		t.Errorf("unexpected diff: %s", diff)
+	}
+}
+
+type testNote struct {
+	ddb.RowHeader
+	Secret  string   `ddb:",encrypt"`
+	Entries []string `ddb:",compress"`
+}
+
+func TestDecoder(t *testing.T) {
+	t.Parallel()
+
+	server := ddblocal.NewServer()
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	keys := &ddb.StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+	client := &ddb.Client{Ddb: server.DynamoDB(), Table: "Notes", Encryption: &ddb.Encryption{Keys: keys, Sign: true}}
+	if err := client.CreateTable(ctx, ddb.TableSpec{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	note := testNote{
+		RowHeader: ddb.RowHeader{PK: "USER#1", SK: "NOTE#1", RowType: "NOTE"},
+		Secret:    "secret",
+		Entries:   []string{"a", "b"},
+	}
+	if err := client.Put(ctx, note); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := client.Ddb.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &client.Table,
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: "USER#1"},
+			"SK": &types.AttributeValueMemberS{Value: "NOTE#1"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	record := Record{EventID: "1", SequenceNumber: "100", Kind: Insert, NewImage: resp.Item}
+
+	// the stored image is encrypted and compressed
+	if _, err := Decode[testNote](record); err == nil {
+		t.Errorf("expected an error decoding the stored image")
+	}
+
+	decoder := Decoder[testNote]{Client: client}
+	change, err := decoder.Decode(ctx, record)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(&note, change.New); diff != "" {
+		t.Errorf("unexpected diff: %s", diff)
+	}
+	if _, ok := resp.Item["Secret"].(*types.AttributeValueMemberB); !ok {
+		t.Errorf("expected the image to be left encrypted, got: %T", resp.Item["Secret"])
+	}
+
+	// a changed image fails verification
+	record.NewImage["Secret"] = &types.AttributeValueMemberS{Value: "forged"}
+	if _, err := decoder.Decode(ctx, record); !errors.Is(err, ddb.ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got: %v", err)
+	}
+}
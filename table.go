@@ -0,0 +1,327 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	defaultTableWaitTimeout = 5 * time.Minute
+	tableStatusPollInterval = 2 * time.Second
+)
+
+// indexKeys are the conventional names of a secondary index and its key columns.
+type indexKeys struct {
+	name string
+	pk   string
+	sk   string
+}
+
+var gsiKeys = map[int]indexKeys{
+	1: {name: indexNameGSI1, pk: gsi1pk, sk: gsi1sk},
+	2: {name: indexNameGSI2, pk: gsi2pk, sk: gsi2sk},
+	3: {name: indexNameGSI3, pk: gsi3pk, sk: gsi3sk},
+	4: {name: indexNameGSI4, pk: gsi4pk, sk: gsi4sk},
+	5: {name: indexNameGSI5, pk: gsi5pk, sk: gsi5sk},
+}
+
+// isGlobalIndex reports whether indexName is one of GSI1..GSI5.
+func isGlobalIndex(indexName string) bool {
+	for _, keys := range gsiKeys {
+		if keys.name == indexName {
+			return true
+		}
+	}
+	return false
+}
+
+// LSIs share the table partition key.
+var lsiKeys = map[int]indexKeys{
+	1: {name: indexNameLSI1, pk: defaultPK, sk: lsi1sk},
+	2: {name: indexNameLSI2, pk: defaultPK, sk: lsi2sk},
+	3: {name: indexNameLSI3, pk: defaultPK, sk: lsi3sk},
+	4: {name: indexNameLSI4, pk: defaultPK, sk: lsi4sk},
+	5: {name: indexNameLSI5, pk: defaultPK, sk: lsi5sk},
+}
+
+// TableSpec describes a table following the conventions of this library: a PK and SK string key, and any
+// of the GSI1..GSI5 and LSI1..LSI5 indexes whose key columns are named like RowGSI1Header.
+type TableSpec struct {
+	// GSIs lists the global secondary indexes by number, e.g. []int{1, 2} for GSI1 and GSI2.
+	GSIs []int
+
+	// LSIs lists the local secondary indexes by number. LSIs can only be created with the table.
+	LSIs []int
+
+	// BillingMode defaults to on-demand (PAY_PER_REQUEST).
+	BillingMode types.BillingMode
+
+	// ReadCapacity and WriteCapacity are applied to the table and each GSI with PROVISIONED billing.
+	ReadCapacity  int64
+	WriteCapacity int64
+
+	// TTL enables Time to Live on the ExpiresAt attribute, see RowTTLHeader.
+	TTL bool
+
+	// WaitTimeout limits how long to wait for the table and its indexes to become ACTIVE. Defaults to
+	// 5 minutes.
+	WaitTimeout time.Duration
+}
+
+func (s TableSpec) validate() error {
+	for _, n := range s.GSIs {
+		if _, ok := gsiKeys[n]; !ok {
+			return &InvalidArgumentError{err: fmt.Errorf("unsupported GSI number %d", n)}
+		}
+	}
+	for _, n := range s.LSIs {
+		if _, ok := lsiKeys[n]; !ok {
+			return &InvalidArgumentError{err: fmt.Errorf("unsupported LSI number %d", n)}
+		}
+	}
+	if s.billingMode() == types.BillingModeProvisioned && (s.ReadCapacity <= 0 || s.WriteCapacity <= 0) {
+		return &InvalidArgumentError{err: errors.New("provisioned billing requires read and write capacity")}
+	}
+	return nil
+}
+
+func (s TableSpec) billingMode() types.BillingMode {
+	if s.BillingMode == "" {
+		return types.BillingModePayPerRequest
+	}
+	return s.BillingMode
+}
+
+func (s TableSpec) throughput() *types.ProvisionedThroughput {
+	if s.billingMode() != types.BillingModeProvisioned {
+		return nil
+	}
+	return &types.ProvisionedThroughput{
+		ReadCapacityUnits:  &s.ReadCapacity,
+		WriteCapacityUnits: &s.WriteCapacity,
+	}
+}
+
+func (s TableSpec) waitTimeout() time.Duration {
+	if s.WaitTimeout <= 0 {
+		return defaultTableWaitTimeout
+	}
+	return s.WaitTimeout
+}
+
+func (s TableSpec) gsi(n int) types.GlobalSecondaryIndex {
+	keys := gsiKeys[n]
+	return types.GlobalSecondaryIndex{
+		IndexName: &keys.name,
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: &keys.pk, KeyType: types.KeyTypeHash},
+			{AttributeName: &keys.sk, KeyType: types.KeyTypeRange},
+		},
+		Projection:            &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		ProvisionedThroughput: s.throughput(),
+	}
+}
+
+func (s TableSpec) lsi(n int) types.LocalSecondaryIndex {
+	keys := lsiKeys[n]
+	return types.LocalSecondaryIndex{
+		IndexName: &keys.name,
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: &keys.pk, KeyType: types.KeyTypeHash},
+			{AttributeName: &keys.sk, KeyType: types.KeyTypeRange},
+		},
+		Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+	}
+}
+
+// attributeDefinitions declares every key column used by the table and the given indexes.
+func attributeDefinitions(gsis, lsis []int) []types.AttributeDefinition {
+	names := map[string]struct{}{defaultPK: {}, defaultSK: {}}
+	for _, n := range gsis {
+		names[gsiKeys[n].pk] = struct{}{}
+		names[gsiKeys[n].sk] = struct{}{}
+	}
+	for _, n := range lsis {
+		names[lsiKeys[n].sk] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	out := make([]types.AttributeDefinition, len(sorted))
+	for i := range sorted {
+		out[i] = types.AttributeDefinition{AttributeName: &sorted[i], AttributeType: types.ScalarAttributeTypeS}
+	}
+	return out
+}
+
+// CreateTable creates the table described by spec and waits for it to become ACTIVE.
+func (c *Client) CreateTable(ctx context.Context, spec TableSpec) error {
+	if err := spec.validate(); err != nil {
+		return fmt.Errorf("CreateTable: %w", err)
+	}
+
+	pk, sk := defaultPK, defaultSK
+
+	req := dynamodb.CreateTableInput{
+		TableName:            &c.Table,
+		AttributeDefinitions: attributeDefinitions(spec.GSIs, spec.LSIs),
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: &pk, KeyType: types.KeyTypeHash},
+			{AttributeName: &sk, KeyType: types.KeyTypeRange},
+		},
+		BillingMode:           spec.billingMode(),
+		ProvisionedThroughput: spec.throughput(),
+	}
+
+	for _, n := range spec.GSIs {
+		req.GlobalSecondaryIndexes = append(req.GlobalSecondaryIndexes, spec.gsi(n))
+	}
+
+	for _, n := range spec.LSIs {
+		req.LocalSecondaryIndexes = append(req.LocalSecondaryIndexes, spec.lsi(n))
+	}
+
+	if _, err := c.Ddb.CreateTable(ctx, &req); err != nil {
+		return fmt.Errorf("CreateTable: %w", err)
+	}
+
+	if err := c.waitForTableActive(ctx, spec.waitTimeout()); err != nil {
+		return fmt.Errorf("CreateTable: %w", err)
+	}
+
+	if spec.TTL {
+		if err := c.EnableTTL(ctx); err != nil {
+			return fmt.Errorf("CreateTable: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// EnsureTable creates the table described by spec if it does not exist. If it does exist, any missing GSIs
+// are added one at a time, waiting for each to become ACTIVE. Missing LSIs are an error because they cannot
+// be added to an existing table.
+func (c *Client) EnsureTable(ctx context.Context, spec TableSpec) error {
+	if err := spec.validate(); err != nil {
+		return fmt.Errorf("EnsureTable: %w", err)
+	}
+
+	desc, err := c.Ddb.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &c.Table})
+	if err != nil {
+		var notFoundErr *types.ResourceNotFoundException
+		if errors.As(err, &notFoundErr) {
+			return c.CreateTable(ctx, spec)
+		}
+		return fmt.Errorf("EnsureTable: DescribeTable: %w", err)
+	}
+
+	existing := map[string]struct{}{}
+	for _, index := range desc.Table.GlobalSecondaryIndexes {
+		existing[*index.IndexName] = struct{}{}
+	}
+	for _, index := range desc.Table.LocalSecondaryIndexes {
+		existing[*index.IndexName] = struct{}{}
+	}
+
+	for _, n := range spec.LSIs {
+		if _, ok := existing[lsiKeys[n].name]; !ok {
+			return fmt.Errorf("EnsureTable: %s is missing and cannot be added to an existing table", lsiKeys[n].name)
+		}
+	}
+
+	var missing []int
+	for _, n := range spec.GSIs {
+		if _, ok := existing[gsiKeys[n].name]; !ok {
+			missing = append(missing, n)
+		}
+	}
+
+	// GSI throughput must match the billing mode of the existing table, not the spec.
+	tableSpec := spec
+	tableSpec.BillingMode = types.BillingModePayPerRequest
+	if desc.Table.BillingModeSummary == nil || desc.Table.BillingModeSummary.BillingMode == types.BillingModeProvisioned {
+		tableSpec.BillingMode = types.BillingModeProvisioned
+		if len(missing) > 0 && (spec.ReadCapacity <= 0 || spec.WriteCapacity <= 0) {
+			return &InvalidArgumentError{err: errors.New("EnsureTable: adding a GSI to a provisioned table requires read and write capacity")}
+		}
+	}
+
+	// DynamoDB allows only one GSI to be created per UpdateTable request.
+	for _, n := range missing {
+		gsi := tableSpec.gsi(n)
+		req := dynamodb.UpdateTableInput{
+			TableName:            &c.Table,
+			AttributeDefinitions: attributeDefinitions([]int{n}, nil),
+			GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{{
+				Create: &types.CreateGlobalSecondaryIndexAction{
+					IndexName:             gsi.IndexName,
+					KeySchema:             gsi.KeySchema,
+					Projection:            gsi.Projection,
+					ProvisionedThroughput: gsi.ProvisionedThroughput,
+				},
+			}},
+		}
+
+		if _, err := c.Ddb.UpdateTable(ctx, &req); err != nil {
+			return fmt.Errorf("EnsureTable: UpdateTable %s: %w", gsiKeys[n].name, err)
+		}
+
+		if err := c.waitForTableActive(ctx, spec.waitTimeout()); err != nil {
+			return fmt.Errorf("EnsureTable: %w", err)
+		}
+	}
+
+	if spec.TTL {
+		if err := c.EnableTTL(ctx); err != nil {
+			return fmt.Errorf("EnsureTable: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// waitForTableActive polls until the table and all of its GSIs are ACTIVE.
+func (c *Client) waitForTableActive(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		desc, err := c.Ddb.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &c.Table})
+		if err != nil {
+			var notFoundErr *types.ResourceNotFoundException
+			if !errors.As(err, &notFoundErr) {
+				return fmt.Errorf("waitForTableActive: DescribeTable: %w", err)
+			}
+		} else if isTableActive(desc.Table) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waitForTableActive: %w", ctx.Err())
+		case <-time.After(tableStatusPollInterval):
+		}
+	}
+}
+
+func isTableActive(table *types.TableDescription) bool {
+	if table == nil || table.TableStatus != types.TableStatusActive {
+		return false
+	}
+	for _, index := range table.GlobalSecondaryIndexes {
+		if index.IndexStatus != types.IndexStatusActive {
+			return false
+		}
+	}
+	return true
+}
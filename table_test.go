@@ -0,0 +1,115 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/danielwchapman/ddb/ddblocal"
+)
+
+func TestTableSpecValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		spec    TableSpec
+		wantErr bool
+	}{
+		{name: "empty", spec: TableSpec{}},
+		{name: "indexes", spec: TableSpec{GSIs: []int{1, 5}, LSIs: []int{1, 5}}},
+		{name: "unsupported GSI", spec: TableSpec{GSIs: []int{6}}, wantErr: true},
+		{name: "unsupported LSI", spec: TableSpec{LSIs: []int{0}}, wantErr: true},
+		{name: "provisioned", spec: TableSpec{BillingMode: types.BillingModeProvisioned, ReadCapacity: 1, WriteCapacity: 1}},
+		{name: "provisioned without capacity", spec: TableSpec{BillingMode: types.BillingModeProvisioned, ReadCapacity: 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.spec.validate()
+			var invalidArgumentErr *InvalidArgumentError
+			if tt.wantErr && !errors.As(err, &invalidArgumentErr) {
+				t.Errorf("expected InvalidArgumentError, got: %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestEnsureTable(t *testing.T) {
+	t.Parallel()
+
+	server := ddblocal.NewServer()
+	t.Cleanup(server.Close)
+	ctx := context.Background()
+
+	indexes := func(t *testing.T, client *Client) map[string]bool {
+		t.Helper()
+		desc, err := client.Ddb.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &client.Table})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		names := map[string]bool{}
+		for _, index := range desc.Table.GlobalSecondaryIndexes {
+			names[*index.IndexName] = true
+		}
+		for _, index := range desc.Table.LocalSecondaryIndexes {
+			names[*index.IndexName] = true
+		}
+		return names
+	}
+
+	t.Run("create and add GSIs", func(t *testing.T) {
+		client := &Client{Ddb: server.DynamoDB(), Table: "EnsureCreate"}
+		if err := client.EnsureTable(ctx, TableSpec{GSIs: []int{1}, LSIs: []int{1}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := indexes(t, client); !got[indexNameGSI1] || !got[indexNameLSI1] || len(got) != 2 {
+			t.Errorf("unexpected indexes: %v", got)
+		}
+
+		if err := client.EnsureTable(ctx, TableSpec{GSIs: []int{1, 2}, LSIs: []int{1}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := indexes(t, client); !got[indexNameGSI2] || len(got) != 3 {
+			t.Errorf("unexpected indexes: %v", got)
+		}
+	})
+
+	t.Run("missing LSI", func(t *testing.T) {
+		client := &Client{Ddb: server.DynamoDB(), Table: "EnsureLSI"}
+		if err := client.CreateTable(ctx, TableSpec{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := client.EnsureTable(ctx, TableSpec{LSIs: []int{2}}); err == nil {
+			t.Errorf("expected an error for a missing LSI")
+		}
+	})
+
+	t.Run("provisioned table", func(t *testing.T) {
+		client := &Client{Ddb: server.DynamoDB(), Table: "EnsureProvisioned"}
+		spec := TableSpec{GSIs: []int{1}, BillingMode: types.BillingModeProvisioned, ReadCapacity: 5, WriteCapacity: 5}
+		if err := client.CreateTable(ctx, spec); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// capacity is only needed to add a GSI
+		if err := client.EnsureTable(ctx, TableSpec{GSIs: []int{1}}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		var invalidArgumentErr *InvalidArgumentError
+		if err := client.EnsureTable(ctx, TableSpec{GSIs: []int{1, 2}}); !errors.As(err, &invalidArgumentErr) {
+			t.Errorf("expected InvalidArgumentError, got: %v", err)
+		}
+		if err := client.EnsureTable(ctx, TableSpec{GSIs: []int{1, 2}, ReadCapacity: 5, WriteCapacity: 5}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := indexes(t, client); !got[indexNameGSI2] {
+			t.Errorf("unexpected indexes: %v", got)
+		}
+	})
+}
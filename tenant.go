@@ -0,0 +1,287 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// tenantKeyPrefix starts the partition keys of every tenant, as in TENANT#<id>#USER#1.
+const tenantKeyPrefix = "TENANT#"
+
+// TenantClient is a view of a Client scoped to one tenant. Partition keys, including GSI partition keys, are
+// prefixed with TENANT#<id># on the way in and the prefix is removed from results, so callers use the same keys
+// they would without tenancy. Keys that already name a tenant are rejected, as are page tokens from another
+// tenant.
+//
+// Conditions and filters are rewritten where they compare a partition key attribute with =, <> or begins_with.
+// Raw condition strings, such as PutRow.Condition, cannot hold key values and are passed through.
+type TenantClient struct {
+	client *Client
+	id     string
+	prefix string
+}
+
+var (
+	_ ClientInterface   = (*TenantClient)(nil)
+	_ GetterWithOptions = (*TenantClient)(nil)
+)
+
+// ForTenant returns a view of the Client that can only read and write the rows of tenant id.
+func (c *Client) ForTenant(id string) *TenantClient {
+	return &TenantClient{client: c, id: id, prefix: tenantKeyPrefix + id + "#"}
+}
+
+// ID returns the tenant the client is scoped to.
+func (t *TenantClient) ID() string {
+	return t.id
+}
+
+func (t *TenantClient) Delete(ctx context.Context, pk, sk string, opts ...Option) error {
+	pk, opts, err := t.scope(pk, opts)
+	if err != nil {
+		return fmt.Errorf("Delete: %w", err)
+	}
+	return t.client.Delete(ctx, pk, sk, opts...)
+}
+
+func (t *TenantClient) Get(ctx context.Context, pk, sk string, out any) error {
+	return t.GetWithOptions(ctx, pk, sk, out)
+}
+
+func (t *TenantClient) GetWithOptions(ctx context.Context, pk, sk string, out any, opts ...Option) error {
+	pk, opts, err := t.scope(pk, opts)
+	if err != nil {
+		return fmt.Errorf("Get: %w", err)
+	}
+	return t.client.GetWithOptions(ctx, pk, sk, out, opts...)
+}
+
+func (t *TenantClient) Put(ctx context.Context, row any, opts ...Option) error {
+	_, opts, err := t.scope("", opts)
+	if err != nil {
+		return fmt.Errorf("Put: %w", err)
+	}
+	return t.client.Put(ctx, row, opts...)
+}
+
+func (t *TenantClient) Query(ctx context.Context, keyCond KeyCondition, out any, opts ...Option) error {
+	_, opts, err := t.scope("", opts)
+	if err != nil {
+		return fmt.Errorf("Query: %w", err)
+	}
+	return t.client.Query(ctx, keyCond, out, opts...)
+}
+
+func (t *TenantClient) TransactPuts(ctx context.Context, token string, rows ...PutRow) error {
+	if err := t.validate(); err != nil {
+		return fmt.Errorf("TransactPuts: %w", err)
+	}
+	return t.client.transactPuts(ctx, token, &options{tenant: t.prefix}, rows...)
+}
+
+func (t *TenantClient) Update(ctx context.Context, pk, sk string, opts ...Option) error {
+	pk, opts, err := t.scope(pk, opts)
+	if err != nil {
+		return fmt.Errorf("Update: %w", err)
+	}
+	return t.client.Update(ctx, pk, sk, opts...)
+}
+
+func (t *TenantClient) validate() error {
+	if t.id == "" || strings.Contains(t.id, "#") {
+		return &InvalidArgumentError{err: fmt.Errorf("invalid tenant ID %q", t.id)}
+	}
+	return nil
+}
+
+// scope prefixes pk, unless it is empty, and adds the tenant to a copy of opts.
+func (t *TenantClient) scope(pk string, opts []Option) (string, []Option, error) {
+	if err := t.validate(); err != nil {
+		return "", nil, err
+	}
+	if pk != "" {
+		if err := checkTenantKey(pk); err != nil {
+			return "", nil, err
+		}
+		pk = t.prefix + pk
+	}
+
+	scoped := make([]Option, len(opts), len(opts)+1)
+	copy(scoped, opts)
+	return pk, append(scoped, withTenant(t.prefix)), nil
+}
+
+// withTenant scopes a call to the tenant with key prefix prefix.
+func withTenant(prefix string) Option {
+	return func(options *options) error {
+		options.tenant = prefix
+		return nil
+	}
+}
+
+func checkTenantKey(key string) error {
+	if strings.HasPrefix(key, tenantKeyPrefix) {
+		return &InvalidArgumentError{err: fmt.Errorf("key %q already names a tenant", key)}
+	}
+	return nil
+}
+
+// isTenantKey reports whether an attribute is a partition key, which is prefixed with the tenant.
+func isTenantKey(name string) bool {
+	if name == defaultPK {
+		return true
+	}
+	for _, keys := range gsiKeys {
+		if keys.pk == name {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeItem prefixes the partition keys of an item to write.
+func (o *options) scopeItem(item map[string]types.AttributeValue) error {
+	if o.tenant == "" {
+		return nil
+	}
+	for name, av := range item {
+		s, ok := av.(*types.AttributeValueMemberS)
+		if !ok || !isTenantKey(name) || s.Value == "" {
+			continue
+		}
+		if err := checkTenantKey(s.Value); err != nil {
+			return err
+		}
+		item[name] = &types.AttributeValueMemberS{Value: o.tenant + s.Value}
+	}
+	return nil
+}
+
+// unscopeItem removes the tenant prefix from the partition keys of an item that was read.
+func (o *options) unscopeItem(item map[string]types.AttributeValue) error {
+	if o.tenant == "" {
+		return nil
+	}
+	for name, av := range item {
+		s, ok := av.(*types.AttributeValueMemberS)
+		if !ok || !isTenantKey(name) {
+			continue
+		}
+		value, ok := strings.CutPrefix(s.Value, o.tenant)
+		if !ok {
+			return &InternalError{err: errors.New("row belongs to another tenant")}
+		}
+		item[name] = &types.AttributeValueMemberS{Value: value}
+	}
+	return nil
+}
+
+// checkStartKey rejects a page token for a partition of another tenant.
+func (o *options) checkStartKey(startKey map[string]types.AttributeValue) error {
+	if o.tenant == "" {
+		return nil
+	}
+	for name, av := range startKey {
+		if !isTenantKey(name) {
+			continue
+		}
+		if s, ok := av.(*types.AttributeValueMemberS); !ok || !strings.HasPrefix(s.Value, o.tenant) {
+			return &InvalidArgumentError{err: errors.New("page token belongs to another tenant")}
+		}
+	}
+	return nil
+}
+
+var (
+	// these match the comparisons the expression builder writes, e.g. "#0 = :0" and "begins_with (#1, :1)"
+	nameValueComparison = regexp.MustCompile(`(#\w+) (?:=|<>) (:\w+)`)
+	valueNameComparison = regexp.MustCompile(`(:\w+) (?:=|<>) (#\w+)`)
+	beginsWithName      = regexp.MustCompile(`begins_with \((#\w+), (:\w+)\)`)
+	existsName          = regexp.MustCompile(`attribute_(?:not_)?exists \((#\w+)\)`)
+	namePlaceholder     = regexp.MustCompile(`#\w+`)
+)
+
+// scopeExpression prefixes the values compared with partition key attributes in the expression strings built
+// with expr, whose value map it changes in place. It returns how many comparisons were scoped. Any other use of
+// a partition key attribute, besides checking that it exists or removing it, is rejected, because its value
+// could not be scoped.
+func (o *options) scopeExpression(expr expression.Expression, exprs ...*string) (int, error) {
+	if o.tenant == "" {
+		return 0, nil
+	}
+
+	names, values := expr.Names(), expr.Values()
+	scoped := map[string]bool{}
+	count := 0
+
+	scopeValue := func(name, value string) error {
+		if !isTenantKey(names[name]) {
+			return nil
+		}
+		count++
+		if scoped[value] {
+			return nil
+		}
+		s, ok := values[value].(*types.AttributeValueMemberS)
+		if !ok {
+			return &InvalidArgumentError{err: fmt.Errorf("%s must be compared with a string", names[name])}
+		}
+		if err := checkTenantKey(s.Value); err != nil {
+			return err
+		}
+		values[value] = &types.AttributeValueMemberS{Value: o.tenant + s.Value}
+		scoped[value] = true
+		return nil
+	}
+
+	for _, e := range exprs {
+		if e == nil {
+			continue
+		}
+		for _, m := range nameValueComparison.FindAllStringSubmatch(*e, -1) {
+			if err := scopeValue(m[1], m[2]); err != nil {
+				return 0, err
+			}
+		}
+		for _, m := range valueNameComparison.FindAllStringSubmatch(*e, -1) {
+			if err := scopeValue(m[2], m[1]); err != nil {
+				return 0, err
+			}
+		}
+		for _, m := range beginsWithName.FindAllStringSubmatch(*e, -1) {
+			if err := scopeValue(m[1], m[2]); err != nil {
+				return 0, err
+			}
+		}
+		if err := checkUnscopedNames(*e, names); err != nil {
+			return 0, err
+		}
+	}
+
+	return count, nil
+}
+
+// checkUnscopedNames rejects an expression that uses a partition key attribute other than in the comparisons
+// scopeExpression rewrites, attribute_exists and attribute_not_exists, or the REMOVE clause of an update.
+func checkUnscopedNames(e string, names map[string]string) error {
+	for _, clause := range strings.Split(e, "\n") {
+		if strings.HasPrefix(clause, "REMOVE ") {
+			continue
+		}
+		for _, re := range []*regexp.Regexp{nameValueComparison, valueNameComparison, beginsWithName, existsName} {
+			clause = re.ReplaceAllString(clause, "")
+		}
+		for _, name := range namePlaceholder.FindAllString(clause, -1) {
+			if isTenantKey(names[name]) {
+				return &InvalidArgumentError{err: fmt.Errorf("%s can only be compared with = or <>, or begins_with", names[name])}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type tenantRow struct {
+	RowHeader
+	RowGSI1Header
+	Name string
+}
+
+func TestForTenant(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newTestClient(t, TableSpec{GSIs: []int{1}}, nil)
+	ctx := context.Background()
+
+	acme, globex := client.ForTenant("acme"), client.ForTenant("globex")
+
+	for _, tenant := range []*TenantClient{acme, globex} {
+		for _, sk := range []string{"A", "B"} {
+			row := tenantRow{
+				RowHeader:     RowHeader{PK: "USER#1", SK: sk, RowType: "USER"},
+				RowGSI1Header: RowGSI1Header{GSI1PK: "EMAIL#ada@example.com", GSI1SK: sk},
+				Name:          tenant.ID() + sk,
+			}
+			if err := tenant.Put(ctx, row); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	}
+
+	isInvalidArgument := func(err error) bool {
+		var invalidArgumentErr *InvalidArgumentError
+		return errors.As(err, &invalidArgumentErr)
+	}
+
+	t.Run("keys are prefixed", func(t *testing.T) {
+		item := rawItem(t, client, "TENANT#acme#USER#1", "A")
+		if key, ok := item[gsi1pk].(*types.AttributeValueMemberS); !ok || key.Value != "TENANT#acme#EMAIL#ada@example.com" {
+			t.Errorf("unexpected GSI1PK: %#v", item[gsi1pk])
+		}
+	})
+
+	t.Run("Get and Query strip the prefix", func(t *testing.T) {
+		var got tenantRow
+		if err := acme.Get(ctx, "USER#1", "A", &got); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.PK != "USER#1" || got.GSI1PK != "EMAIL#ada@example.com" || got.Name != "acmeA" {
+			t.Errorf("unexpected row: %+v", got)
+		}
+
+		var rows []tenantRow
+		if err := globex.Query(ctx, KeyPkOnly("EMAIL#ada@example.com"), &rows, WithIndexGSI1()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(rows) != 2 || rows[0].Name != "globexA" || rows[0].PK != "USER#1" {
+			t.Errorf("unexpected rows: %+v", rows)
+		}
+	})
+
+	t.Run("conditions are scoped", func(t *testing.T) {
+		err := acme.Update(ctx, "USER#1", "A",
+			WithFieldUpdates(map[string]any{"Name": "updated"}),
+			WithCondition(expression.Name("PK").Equal(expression.Value("USER#1"))),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		err = acme.Delete(ctx, "USER#1", "B", WithCondition(expression.Name("GSI1PK").Equal(expression.Value("EMAIL#other"))))
+		var condFailedErr *types.ConditionalCheckFailedException
+		if !errors.As(err, &condFailedErr) {
+			t.Errorf("expected a failed condition, got: %v", err)
+		}
+	})
+
+	t.Run("conditions that cannot be scoped are rejected", func(t *testing.T) {
+		for _, cond := range []expression.ConditionBuilder{
+			expression.Name("PK").LessThan(expression.Value("USER#2")),
+			expression.Name("GSI1PK").Between(expression.Value("A"), expression.Value("Z")),
+			expression.Name("PK").In(expression.Value("USER#1"), expression.Value("USER#2")),
+			expression.Contains(expression.Name("GSI1PK"), "EMAIL"),
+			expression.Name("PK").Size().GreaterThan(expression.Value(0)),
+		} {
+			err := acme.Update(ctx, "USER#1", "A", WithFieldUpdates(map[string]any{"Name": "updated"}), WithCondition(cond))
+			if !isInvalidArgument(err) {
+				t.Errorf("expected InvalidArgumentError, got: %v", err)
+			}
+
+			var rows []tenantRow
+			if err := acme.Query(ctx, KeyPkOnly("USER#1"), &rows, WithFilters(cond)); !isInvalidArgument(err) {
+				t.Errorf("expected InvalidArgumentError, got: %v", err)
+			}
+		}
+
+		// checking that a key exists needs no scoping
+		err := acme.Update(ctx, "USER#1", "A", WithFieldUpdates(map[string]any{"Name": "updated"}),
+			WithCondition(expression.AttributeExists(expression.Name("GSI1PK"))))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("keys of another tenant are rejected", func(t *testing.T) {
+		var got tenantRow
+		if err := acme.Get(ctx, "TENANT#globex#USER#1", "A", &got); !isInvalidArgument(err) {
+			t.Errorf("expected InvalidArgumentError, got: %v", err)
+		}
+
+		var rows []tenantRow
+		if err := acme.Query(ctx, KeyPkOnly("TENANT#globex#USER#1"), &rows); !isInvalidArgument(err) {
+			t.Errorf("expected InvalidArgumentError, got: %v", err)
+		}
+
+		row := tenantRow{RowHeader: RowHeader{PK: "TENANT#globex#USER#2", SK: "A", RowType: "USER"}}
+		if err := acme.TransactPuts(ctx, "token", PutRow{Row: row}); !isInvalidArgument(err) {
+			t.Errorf("expected InvalidArgumentError, got: %v", err)
+		}
+	})
+
+	t.Run("page tokens of another tenant are rejected", func(t *testing.T) {
+		var rows []tenantRow
+		var token string
+		if err := acme.Query(ctx, KeyPkOnly("USER#1"), &rows, WithPage("", &token), WithPageSize(1)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := globex.Query(ctx, KeyPkOnly("USER#1"), &rows, WithPage(token, &token)); !isInvalidArgument(err) {
+			t.Errorf("expected InvalidArgumentError, got: %v", err)
+		}
+	})
+
+	t.Run("invalid tenant", func(t *testing.T) {
+		var got tenantRow
+		if err := client.ForTenant("a#b").Get(ctx, "USER#1", "A", &got); !isInvalidArgument(err) {
+			t.Errorf("expected InvalidArgumentError, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ttlColumn is the attribute Time to Live is enabled on by EnableTTL.
+const ttlColumn = "ExpiresAt"
+
+// ExpiresAt is an expiry time stored as epoch seconds, the format DynamoDB Time to Live requires. The zero
+// value means the row does not expire.
+type ExpiresAt int64
+
+// NewExpiresAt returns t as an ExpiresAt, truncated to the second.
+func NewExpiresAt(t time.Time) ExpiresAt {
+	return ExpiresAt(t.Unix())
+}
+
+// ExpiresIn returns the ExpiresAt d from now.
+func ExpiresIn(d time.Duration) ExpiresAt {
+	return NewExpiresAt(time.Now().Add(d))
+}
+
+// Time returns the expiry time, or the zero time if e is zero.
+func (e ExpiresAt) Time() time.Time {
+	if e == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(e), 0).UTC()
+}
+
+// Expired reports whether the expiry time is before now. A zero ExpiresAt never expires.
+func (e ExpiresAt) Expired(now time.Time) bool {
+	return e != 0 && int64(e) < now.Unix()
+}
+
+// RowTTLHeader is embedded in rows that expire with Time to Live. Rows without an expiry omit the attribute.
+type RowTTLHeader struct {
+	ExpiresAt ExpiresAt `dynamodbav:",omitempty"`
+}
+
+// WithTTL sets the row to expire d from now. For use with Put and Update.
+func WithTTL(d time.Duration) Option {
+	return func(options *options) error {
+		if d <= 0 {
+			return &InvalidArgumentError{err: errors.New("WithTTL: duration must be positive")}
+		}
+		options.expiresAt = ExpiresIn(d)
+		return nil
+	}
+}
+
+// WithFilterExpired overrides Client.FilterExpired for one call to GetWithOptions or Query.
+func WithFilterExpired(filter bool) Option {
+	return func(options *options) error {
+		options.filterExpired = &filter
+		return nil
+	}
+}
+
+func (o *options) shouldFilterExpired(clientDefault bool) bool {
+	if o.filterExpired != nil {
+		return *o.filterExpired
+	}
+	return clientDefault
+}
+
+// isExpired reports whether an item has a numeric TTL attribute in the past. Items whose TTL attribute is not
+// a number are never deleted by Time to Live, so they are not expired.
+func isExpired(item map[string]types.AttributeValue, now time.Time) bool {
+	n, ok := item[ttlColumn].(*types.AttributeValueMemberN)
+	if !ok {
+		return false
+	}
+	seconds, err := strconv.ParseFloat(n.Value, 64)
+	if err != nil {
+		return false
+	}
+	return ExpiresAt(seconds).Expired(now)
+}
+
+// notExpiredFilter keeps the items isExpired does not consider expired.
+func notExpiredFilter(now time.Time) expression.ConditionBuilder {
+	return expression.Or(
+		expression.AttributeNotExists(expression.Name(ttlColumn)),
+		expression.Not(expression.AttributeType(expression.Name(ttlColumn), expression.Number)),
+		expression.Name(ttlColumn).GreaterThanEqual(expression.Value(now.Unix())),
+	)
+}
+
+// EnableTTL enables Time to Live on the table using the ExpiresAt attribute. It does nothing if TTL is
+// already enabled on that attribute.
+func (c *Client) EnableTTL(ctx context.Context) error {
+	desc, err := c.Ddb.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: &c.Table})
+	if err != nil {
+		return fmt.Errorf("EnableTTL: DescribeTimeToLive: %w", err)
+	}
+
+	if ttl := desc.TimeToLiveDescription; ttl != nil {
+		switch ttl.TimeToLiveStatus {
+		case types.TimeToLiveStatusEnabled, types.TimeToLiveStatusEnabling:
+			if ttl.AttributeName != nil && *ttl.AttributeName == ttlColumn {
+				return nil
+			}
+			return fmt.Errorf("EnableTTL: TTL is already enabled on attribute %q", *ttl.AttributeName)
+		}
+	}
+
+	name := ttlColumn
+	enabled := true
+	_, err = c.Ddb.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: &c.Table,
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: &name,
+			Enabled:       &enabled,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("EnableTTL: UpdateTimeToLive: %w", err)
+	}
+
+	return nil
+}
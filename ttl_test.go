@@ -0,0 +1,91 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type ttlRow struct {
+	RowHeader
+	RowTTLHeader
+	Name string
+}
+
+func TestTTL(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newTestClient(t, TableSpec{TTL: true}, func(c *Client) { c.FilterExpired = true })
+	ctx := context.Background()
+
+	// enabling twice is a no-op
+	if err := client.EnableTTL(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expired := ttlRow{
+		RowHeader:    RowHeader{PK: "SESSION", SK: "1", RowType: "SESSION"},
+		RowTTLHeader: RowTTLHeader{ExpiresAt: NewExpiresAt(time.Now().Add(-time.Hour))},
+	}
+	live := ttlRow{RowHeader: RowHeader{PK: "SESSION", SK: "2", RowType: "SESSION"}}
+	forever := ttlRow{RowHeader: RowHeader{PK: "SESSION", SK: "3", RowType: "SESSION"}}
+
+	if err := client.Put(ctx, expired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.Put(ctx, live, WithTTL(time.Hour)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.Put(ctx, forever); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("Get filters expired rows", func(t *testing.T) {
+		var got ttlRow
+		if err := client.Get(ctx, "SESSION", "1", &got); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got: %v", err)
+		}
+
+		if err := client.GetWithOptions(ctx, "SESSION", "1", &got, WithFilterExpired(false)); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if !got.ExpiresAt.Expired(time.Now()) {
+			t.Errorf("expected an expired row, got: %v", got.ExpiresAt.Time())
+		}
+	})
+
+	t.Run("Put WithTTL", func(t *testing.T) {
+		var got ttlRow
+		if err := client.Get(ctx, "SESSION", "2", &got); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if until := time.Until(got.ExpiresAt.Time()); until < 59*time.Minute || until > time.Hour {
+			t.Errorf("unexpected expiry: %v", got.ExpiresAt.Time())
+		}
+	})
+
+	t.Run("Query drops expired rows", func(t *testing.T) {
+		var got []ttlRow
+		if err := client.Query(ctx, KeyPkOnly("SESSION"), &got); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 2 || got[0].SK != "2" || got[1].SK != "3" {
+			t.Errorf("unexpected rows: %+v", got)
+		}
+	})
+
+	t.Run("Update WithTTL", func(t *testing.T) {
+		if err := client.Update(ctx, "SESSION", "3", WithTTL(time.Minute)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var got ttlRow
+		if err := client.Get(ctx, "SESSION", "3", &got); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.ExpiresAt == 0 {
+			t.Errorf("expected ExpiresAt to be set")
+		}
+	})
+}
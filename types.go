@@ -43,3 +43,24 @@ type RowGSI5Header struct {
 	GSI5PK string
 	GSI5SK string
 }
+
+// RowLSI1Header is the sort key of LSI1. LSIs share the table partition key, PK.
+type RowLSI1Header struct {
+	LSI1SK string
+}
+
+type RowLSI2Header struct {
+	LSI2SK string
+}
+
+type RowLSI3Header struct {
+	LSI3SK string
+}
+
+type RowLSI4Header struct {
+	LSI4SK string
+}
+
+type RowLSI5Header struct {
+	LSI5SK string
+}
@@ -0,0 +1,198 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// schemaVersionColumn holds the shape version of a row. Rows without it are at version 1.
+const schemaVersionColumn = "SchemaVersion"
+
+// RowSchemaHeader is embedded next to RowHeader in rows that are upgraded on read by Upcasters.
+type RowSchemaHeader struct {
+	SchemaVersion int `dynamodbav:",omitempty"`
+}
+
+// Upcaster upgrades an item of one RowType from one schema version to the next, e.g. by renaming an attribute.
+type Upcaster func(ctx context.Context, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error)
+
+// Upcasters upgrade old rows to the current shape of their RowType when Get and Query read them, so a shape can
+// change without rewriting the table first. Put and TransactPuts stamp new rows with the current version.
+type Upcasters struct {
+	// WriteBack writes upgraded rows back to the table with a Put conditioned on every attribute the row was read
+	// with being unchanged, so a write in between is not lost. Rows read from an index are not written back, as
+	// an index may not project every attribute.
+	WriteBack bool
+
+	// OnWriteBackError, if set, is called when writing back fails for a reason other than the row changing.
+	// A failed write back does not fail the read.
+	OnWriteBackError func(err error)
+
+	mu         sync.RWMutex
+	byRowType  map[string]map[int]Upcaster
+	currentVer map[string]int
+}
+
+// Register adds the upcaster that upgrades rowType rows from version from to from+1. Versions start at 1.
+func (u *Upcasters) Register(rowType string, from int, fn Upcaster) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if from < 1 {
+		return &InvalidArgumentError{err: fmt.Errorf("Register: version must be at least 1, got %d", from)}
+	}
+	if _, ok := u.byRowType[rowType][from]; ok {
+		return &InvalidArgumentError{err: fmt.Errorf("Register: %s version %d is already registered", rowType, from)}
+	}
+
+	if u.byRowType == nil {
+		u.byRowType = map[string]map[int]Upcaster{}
+		u.currentVer = map[string]int{}
+	}
+	if u.byRowType[rowType] == nil {
+		u.byRowType[rowType] = map[int]Upcaster{}
+	}
+	u.byRowType[rowType][from] = fn
+	if from+1 > u.currentVer[rowType] {
+		u.currentVer[rowType] = from + 1
+	}
+	return nil
+}
+
+// Current returns the version rows of rowType are upgraded to, or 0 if it has no upcasters.
+func (u *Upcasters) Current(rowType string) int {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.currentVer[rowType]
+}
+
+func (u *Upcasters) upcaster(rowType string, from int) (Upcaster, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	fn, ok := u.byRowType[rowType][from]
+	return fn, ok
+}
+
+func rowTypeOf(item map[string]types.AttributeValue) string {
+	if rowType, ok := item["RowType"].(*types.AttributeValueMemberS); ok {
+		return rowType.Value
+	}
+	return ""
+}
+
+func schemaVersionOf(item map[string]types.AttributeValue) (int, error) {
+	n, ok := item[schemaVersionColumn].(*types.AttributeValueMemberN)
+	if !ok {
+		return 1, nil
+	}
+	return strconv.Atoi(n.Value)
+}
+
+// stampSchemaVersion sets the current version on a row to write, unless the row sets its own.
+func (c *Client) stampSchemaVersion(item map[string]types.AttributeValue) {
+	if c.Upcasters == nil {
+		return
+	}
+	if _, ok := item[schemaVersionColumn]; ok {
+		return
+	}
+	if current := c.Upcasters.Current(rowTypeOf(item)); current > 0 {
+		item[schemaVersionColumn] = &types.AttributeValueMemberN{Value: strconv.Itoa(current)}
+	}
+}
+
+// readImage returns a copy of an item as it was read from the table, for writing it back after upcasting, or
+// nil if the Client does not write back. Decoding replaces attributes in place, so it must be taken first.
+func (c *Client) readImage(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	if c.Upcasters == nil || !c.Upcasters.WriteBack {
+		return nil
+	}
+	image := make(map[string]types.AttributeValue, len(item))
+	for k, v := range item {
+		image[k] = v
+	}
+	return image
+}
+
+// upcastItem upgrades a decoded item to the current version of its RowType, and writes it back if read, the
+// item as it was stored, is not nil.
+func (c *Client) upcastItem(ctx context.Context, item, read map[string]types.AttributeValue, rowType reflect.Type) (map[string]types.AttributeValue, error) {
+	if c.Upcasters == nil {
+		return item, nil
+	}
+
+	name := rowTypeOf(item)
+	current := c.Upcasters.Current(name)
+	version, err := schemaVersionOf(item)
+	if err != nil {
+		return nil, &InternalError{err: fmt.Errorf("%s: %w", schemaVersionColumn, err)}
+	}
+	if version >= current {
+		return item, nil
+	}
+
+	upgraded := item
+	for ; version < current; version++ {
+		fn, ok := c.Upcasters.upcaster(name, version)
+		if !ok {
+			return nil, &InternalError{err: fmt.Errorf("no upcaster for %s version %d", name, version)}
+		}
+		if upgraded, err = fn(ctx, upgraded); err != nil {
+			return nil, fmt.Errorf("upcast %s version %d: %w", name, version, err)
+		}
+		if upgraded == nil {
+			return nil, &InternalError{err: fmt.Errorf("upcaster for %s version %d returned no item", name, version)}
+		}
+		upgraded[schemaVersionColumn] = &types.AttributeValueMemberN{Value: strconv.Itoa(version + 1)}
+	}
+
+	if read != nil && !isDeleted(upgraded) {
+		if err := c.writeBack(ctx, upgraded, read, rowType); err != nil && c.Upcasters.OnWriteBackError != nil {
+			c.Upcasters.OnWriteBackError(err)
+		}
+	}
+
+	return upgraded, nil
+}
+
+// writeBack puts an upgraded item if the row is unchanged since it was read. An update in between need not
+// change the schema version, so the condition checks every attribute.
+func (c *Client) writeBack(ctx context.Context, item, read map[string]types.AttributeValue, rowType reflect.Type) error {
+	stored := make(map[string]types.AttributeValue, len(item))
+	for k, v := range item {
+		stored[k] = v
+	}
+	if err := c.encodeItem(ctx, stored, rowType); err != nil {
+		return fmt.Errorf("write back: %w", err)
+	}
+
+	expr, err := expression.NewBuilder().WithCondition(UnchangedCondition(read)).Build()
+	if err != nil {
+		return fmt.Errorf("write back: expression builder: %w", err)
+	}
+
+	_, err = c.Ddb.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 &c.Table,
+		Item:                      stored,
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}, c.rateLimit(ctx)...)
+	if err != nil {
+		var condFailedErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condFailedErr) {
+			// the row was changed since it was read
+			return nil
+		}
+		return fmt.Errorf("write back: PutItem: %w", err)
+	}
+	return nil
+}
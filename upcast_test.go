@@ -0,0 +1,157 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type profileV1 struct {
+	RowHeader
+	FullName string `dynamodbav:",omitempty"`
+}
+
+type profileV3 struct {
+	RowHeader
+	RowSchemaHeader
+	Name  string `dynamodbav:",omitempty"`
+	Email string `dynamodbav:",omitempty"`
+}
+
+func TestUpcasters(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newTestClient(t, TableSpec{}, nil)
+	ctx := context.Background()
+
+	for _, id := range []string{"1", "2"} {
+		row := profileV1{RowHeader: RowHeader{PK: "USER#" + id, SK: "PROFILE", RowType: "PROFILE"}, FullName: "user " + id}
+		if err := client.Put(ctx, row); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	upcasters := &Upcasters{WriteBack: true, OnWriteBackError: func(err error) { t.Errorf("unexpected error: %v", err) }}
+	renameFullName := func(_ context.Context, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+		item["Name"] = item["FullName"]
+		delete(item, "FullName")
+		return item, nil
+	}
+	addEmail := func(_ context.Context, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+		item["Email"] = &types.AttributeValueMemberS{Value: "unknown"}
+		return item, nil
+	}
+	if err := upcasters.Register("PROFILE", 2, addEmail); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := upcasters.Register("PROFILE", 1, renameFullName); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := upcasters.Register("PROFILE", 1, renameFullName); err == nil {
+		t.Errorf("expected an error for a duplicate version")
+	}
+	if current := upcasters.Current("PROFILE"); current != 3 {
+		t.Errorf("expected version 3, got: %d", current)
+	}
+	client.Upcasters = upcasters
+
+	t.Run("Get upgrades and writes back", func(t *testing.T) {
+		var got profileV3
+		if err := client.Get(ctx, "USER#1", "PROFILE", &got); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.Name != "user 1" || got.Email != "unknown" || got.SchemaVersion != 3 {
+			t.Errorf("unexpected row: %+v", got)
+		}
+
+		item := rawItem(t, client, "USER#1", "PROFILE")
+		if version, ok := item[schemaVersionColumn].(*types.AttributeValueMemberN); !ok || version.Value != "3" {
+			t.Errorf("expected the row to be written back, got: %#v", item)
+		}
+		if _, ok := item["FullName"]; ok {
+			t.Errorf("expected FullName to be removed, got: %#v", item)
+		}
+	})
+
+	t.Run("Query upgrades", func(t *testing.T) {
+		var rows []profileV3
+		if err := client.Query(ctx, KeyPkOnly("USER#2"), &rows); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(rows) != 1 || rows[0].Name != "user 2" || rows[0].SchemaVersion != 3 {
+			t.Errorf("unexpected rows: %+v", rows)
+		}
+	})
+
+	t.Run("write back does not overwrite an update", func(t *testing.T) {
+		row := profileV1{RowHeader: RowHeader{PK: "USER#4", SK: "PROFILE", RowType: "PROFILE"}, FullName: "user 4"}
+		plain := &Client{Ddb: client.Ddb, Table: client.Table}
+		if err := plain.Put(ctx, row); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := plain.Update(ctx, "USER#4", "PROFILE", WithFieldUpdates(map[string]any{"Logins": 1})); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// the upcaster runs between the read and the write back, so an update from it lands in between
+		racing := &Upcasters{WriteBack: true, OnWriteBackError: func(err error) { t.Errorf("unexpected error: %v", err) }}
+		if err := racing.Register("PROFILE", 1, func(ctx context.Context, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+			if err := plain.Update(ctx, "USER#4", "PROFILE", WithFieldUpdates(map[string]any{"Logins": 5})); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			return renameFullName(ctx, item)
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		other := &Client{Ddb: client.Ddb, Table: client.Table, Upcasters: racing}
+		var got profileV3
+		if err := other.Get(ctx, "USER#4", "PROFILE", &got); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.Name != "user 4" || got.SchemaVersion != 2 {
+			t.Errorf("unexpected row: %+v", got)
+		}
+
+		item := rawItem(t, client, "USER#4", "PROFILE")
+		if logins, ok := item["Logins"].(*types.AttributeValueMemberN); !ok || logins.Value != "5" {
+			t.Errorf("expected the update to be kept, got: %#v", item)
+		}
+		if _, ok := item[schemaVersionColumn]; ok {
+			t.Errorf("expected the row not to be written back, got: %#v", item)
+		}
+	})
+
+	t.Run("Put stamps the current version", func(t *testing.T) {
+		row := profileV3{RowHeader: RowHeader{PK: "USER#3", SK: "PROFILE", RowType: "PROFILE"}, Name: "user 3"}
+		if err := client.Put(ctx, row); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var got profileV3
+		if err := client.Get(ctx, "USER#3", "PROFILE", &got); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.SchemaVersion != 3 || got.Email != "" {
+			t.Errorf("expected the row not to be upgraded, got: %+v", got)
+		}
+	})
+
+	t.Run("failing upcaster", func(t *testing.T) {
+		failing := &Upcasters{}
+		if err := failing.Register("PROFILE", 3, func(context.Context, map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+			return nil, errors.New("failed")
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// USER#3 is at version 3, which this registry upgrades
+		other := &Client{Ddb: client.Ddb, Table: client.Table, Upcasters: failing}
+		var got profileV3
+		if err := other.Get(ctx, "USER#3", "PROFILE", &got); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+}